@@ -30,13 +30,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/health"
 	_ "github.com/GoogleCloudPlatform/kubernetes/pkg/healthz"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
 	kconfig "github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/config"
+	registryetcd "github.com/GoogleCloudPlatform/kubernetes/pkg/registry/etcd"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/tools"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	verflag "github.com/GoogleCloudPlatform/kubernetes/pkg/version/flag"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/volume"
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/golang/glog"
@@ -55,13 +58,19 @@ var (
 	address            = flag.String("address", "127.0.0.1", "The address for the info server to serve on (set to 0.0.0.0 or \"\" for all interfaces)")
 	port               = flag.Uint("port", 10250, "The port for the info server to serve on")
 	hostnameOverride   = flag.String("hostname_override", "", "If non-empty, will use this string as identification instead of the actual hostname.")
+	cloudProvider      = flag.String("cloud_provider", "", "If non-empty, the provider for cloud services, which names this host unless -hostname_override is set.")
 	dockerEndpoint     = flag.String("docker_endpoint", "", "If non-empty, use this for the docker endpoint to communicate with")
 	etcdServerList     util.StringList
+	allowedHostPaths   util.StringList
+	postMountCommands  util.StringList
 	rootDirectory      = flag.String("root_dir", defaultRootDir, "Directory path for managing kubelet files (volume mounts,etc).")
+	skipPDDetach       = flag.Bool("skip_pd_detach", false, "If true, GCE persistent disks are unmounted but left attached to this host when their pods go away, so they can be checked by hand. For troubleshooting only.")
 )
 
 func init() {
 	flag.Var(&etcdServerList, "etcd_servers", "List of etcd servers to watch (http://ip:port), comma separated")
+	flag.Var(&allowedHostPaths, "allowed_host_paths", "If set, the only host paths that hostDir volumes may expose, and their descendants, comma separated")
+	flag.Var(&postMountCommands, "allowed_post_mount_commands", "Commands, named exactly as volumes name them, that volumes may run as root on this host after being set up, comma separated. None by default.")
 }
 
 func getDockerEndpoint() string {
@@ -80,6 +89,9 @@ func getDockerEndpoint() string {
 
 func getHostname() string {
 	hostname := []byte(*hostnameOverride)
+	if string(hostname) == "" && *cloudProvider != "" {
+		hostname = []byte(getCloudNodeName())
+	}
 	if string(hostname) == "" {
 		// Note: We use exec here instead of os.Hostname() because we
 		// want the FQDN, and this is the easiest way to get it.
@@ -92,6 +104,28 @@ func getHostname() string {
 	return strings.TrimSpace(string(hostname))
 }
 
+// getCloudNodeName returns the name the cloud provider gives this host, or ""
+// if it can't name hosts.
+func getCloudNodeName() string {
+	cloud, err := cloudprovider.GetCloudProvider(*cloudProvider)
+	if err != nil {
+		glog.Fatalf("Couldn't init cloud provider %q: %v", *cloudProvider, err)
+	}
+	if cloud == nil {
+		glog.Fatalf("Unknown cloud provider: %s", *cloudProvider)
+	}
+	namer, ok := cloud.(cloudprovider.CurrentNodeNamer)
+	if !ok {
+		glog.Infof("Cloud provider %q can't name this host, using its hostname", *cloudProvider)
+		return ""
+	}
+	name, err := namer.CurrentNodeName()
+	if err != nil {
+		glog.Fatalf("Couldn't get the node name from cloud provider %q: %v", *cloudProvider, err)
+	}
+	return name
+}
+
 func main() {
 	flag.Parse()
 	util.InitLogs()
@@ -102,6 +136,12 @@ func main() {
 
 	etcd.SetLogger(util.NewLogger("etcd "))
 
+	if len(allowedHostPaths) > 0 {
+		volume.SetAllowedHostPaths(allowedHostPaths)
+	}
+	volume.SetSkipPDDetach(*skipPDDetach)
+	volume.SetAllowedPostMountCommands(postMountCommands)
+
 	dockerClient, err := docker.NewClient(getDockerEndpoint())
 	if err != nil {
 		glog.Fatal("Couldn't connect to docker.")
@@ -139,6 +179,8 @@ func main() {
 		glog.Infof("Watching for etcd configs at %v", etcdServerList)
 		etcdClient = etcd.NewClient(etcdServerList)
 		kconfig.NewSourceEtcd(kconfig.EtcdKeyForHost(hostname), etcdClient, cfg.Channel("etcd"))
+		// Glusterfs volumes name the service whose endpoints are their servers.
+		volume.SetEndpointsGetter(registryetcd.NewRegistry(etcdClient))
 	}
 
 	// TODO: block until all sources have delivered at least one update to the channel, or break the sync loop
@@ -151,6 +193,7 @@ func main() {
 		etcdClient,
 		*rootDirectory,
 		*syncFrequency)
+	volume.SetEventRecorder(k)
 
 	health.AddHealthChecker("exec", health.NewExecHealthChecker(k))
 	health.AddHealthChecker("http", health.NewHTTPHealthChecker(&http.Client{}))
@@ -73,6 +73,25 @@ type Volume struct {
 	// This is optional for now. If not specified, the Volume is implied to be an EmptyDir.
 	// This implied behavior is deprecated and will be removed in a future version.
 	Source *VolumeSource `yaml:"source" json:"source"`
+	// Optional: Command run on the host after the volume is first set up,
+	// with the volume's path appended as its last argument. It runs once each
+	// time the volume is set up for the pod. If it fails the volume is torn
+	// down again. The command must be one the kubelet's administrator allowed.
+	PostMountCommand []string `yaml:"postMountCommand,omitempty" json:"postMountCommand,omitempty"`
+	// Optional: Options for mounting the volume into the pod, e.g. "nodev",
+	// "nosuid" or "noatime". Host directories aren't mounted by the kubelet
+	// and can't have options.
+	MountOptions []string `yaml:"mountOptions,omitempty" json:"mountOptions,omitempty"`
+	// Optional: SELinux context to label the volume with, e.g.
+	// "system_u:object_r:svirt_sandbox_file_t:s0", so containers can use it
+	// on hosts in enforcing mode. Only empty directories and persistent disks
+	// are labeled.
+	SELinuxContext string `yaml:"selinuxContext,omitempty" json:"selinuxContext,omitempty"`
+	// Optional: Group ID that owns the volume. The volume is made group
+	// writable and setgid so files created in it belong to the group, which
+	// lets containers that don't run as root write to it. Only empty
+	// directories and persistent disks are supported.
+	FSGroup *int64 `yaml:"fsGroup,omitempty" json:"fsGroup,omitempty"`
 }
 
 type VolumeSource struct {
@@ -85,14 +104,221 @@ type VolumeSource struct {
 	HostDirectory *HostDirectory `yaml:"hostDir" json:"hostDir"`
 	// EmptyDirectory represents a temporary directory that shares a pod's lifetime.
 	EmptyDirectory *EmptyDirectory `yaml:"emptyDir" json:"emptyDir"`
+	// GCEPersistentDisk represents a GCE Disk resource that is attached to a
+	// kubelet's host machine and then exposed to the pod.
+	GCEPersistentDisk *GCEPersistentDisk `yaml:"persistentDisk" json:"persistentDisk"`
+	// RamDisk represents a fixed-size, memory-backed directory that shares a
+	// pod's lifetime. Its size counts against the node's memory, not its disk.
+	RamDisk *RamDisk `yaml:"ramDisk" json:"ramDisk"`
+	// ISCSI represents an iSCSI LUN that is attached to a kubelet's host
+	// machine and then exposed to the pod.
+	ISCSI *ISCSIDisk `yaml:"iscsi" json:"iscsi"`
+	// AWSElasticBlockStore represents an AWS EBS volume that is attached to a
+	// kubelet's host machine and then exposed to the pod.
+	AWSElasticBlockStore *AWSElasticBlockStore `yaml:"awsElasticBlockStore" json:"awsElasticBlockStore"`
+	// Glusterfs represents a Glusterfs volume that is mounted on the
+	// kubelet's host machine and exposed to the pod.
+	Glusterfs *Glusterfs `yaml:"glusterfs" json:"glusterfs"`
+	// Secret represents a secret whose data is written as files to a
+	// memory-backed directory that shares the pod's lifetime.
+	Secret *SecretSource `yaml:"secret" json:"secret"`
+	// RBD represents a Ceph RBD image that is mapped on the kubelet's host
+	// machine and then exposed to the pod.
+	RBD *RBDImage `yaml:"rbd" json:"rbd"`
+	// AzureDisk represents an Azure managed data disk that is attached to a
+	// kubelet's host machine and then exposed to the pod.
+	AzureDisk *AzureDisk `yaml:"azureDisk" json:"azureDisk"`
+	// CephFS represents a Ceph filesystem that is mounted on the kubelet's
+	// host machine and then exposed to the pod.
+	CephFS *CephFS `yaml:"cephfs" json:"cephfs"`
+	// Flocker represents a Flocker dataset that the Flocker control service
+	// has made available on the kubelet's host machine, exposed to the pod.
+	Flocker *Flocker `yaml:"flocker" json:"flocker"`
 }
 
 // Bare host directory volume.
 type HostDirectory struct {
 	Path string `yaml:"path" json:"path"`
+	// Optional: Defaults to false (read/write). A read-only host directory
+	// can't be written through by any of the pod's containers.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+type EmptyDirectory struct {
+	// Optional: What type of storage medium should back this directory.
+	// The default is "" which means to use the node's default medium.
+	Medium StorageType `yaml:"medium,omitempty" json:"medium,omitempty"`
+	// Optional: Maximum size in bytes of the directory. Only the "Memory"
+	// medium can enforce a limit. The default of 0 means no limit.
+	SizeLimit int64 `yaml:"sizeLimit,omitempty" json:"sizeLimit,omitempty"`
+	// Optional: Permission bits of the directory, e.g. 0755 to let a
+	// non-root container traverse it. Defaults to 0750.
+	DirMode uint32 `yaml:"dirMode,omitempty" json:"dirMode,omitempty"`
+}
+
+// AWSElasticBlockStore represents an EBS volume in the kubelet's availability zone.
+type AWSElasticBlockStore struct {
+	// Unique ID of the EBS volume, e.g. "vol-0a1b2c3d".
+	VolumeID string `yaml:"volumeID" json:"volumeID"`
+	// Optional: Filesystem type to mount. An unformatted volume is
+	// formatted with this type before its first mount.
+	// Ex. "ext4", "xfs"
+	FSType string `yaml:"fsType,omitempty" json:"fsType,omitempty"`
+	// Optional: Partition on the volume to mount. If omitted, the whole
+	// device is mounted.
+	Partition int `yaml:"partition,omitempty" json:"partition,omitempty"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+// Glusterfs represents a volume served by a Glusterfs cluster.
+type Glusterfs struct {
+	// Required: Name of the endpoints object listing the cluster's servers.
+	EndpointsName string `yaml:"endpoints" json:"endpoints"`
+	// Required: Name of the Glusterfs volume.
+	Path string `yaml:"path" json:"path"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+// SecretSource names the secret to expose as a volume. Each of its keys
+// becomes a file of the same name.
+type SecretSource struct {
+	// Required: Name of the secret.
+	Name string `yaml:"name" json:"name"`
 }
 
-type EmptyDirectory struct{}
+// RBDImage represents an image in a Ceph RBD pool.
+type RBDImage struct {
+	// Required: Addresses of the Ceph monitors, as IP or IP:port.
+	CephMonitors []string `yaml:"monitors" json:"monitors"`
+	// Optional: Pool the image is in. Defaults to "rbd".
+	RBDPool string `yaml:"pool,omitempty" json:"pool,omitempty"`
+	// Required: Name of the image.
+	RBDImage string `yaml:"image" json:"image"`
+	// Optional: Filesystem type to mount. An unformatted image is
+	// formatted with this type before its first mount.
+	// Ex. "ext4", "xfs"
+	FSType string `yaml:"fsType,omitempty" json:"fsType,omitempty"`
+	// Optional: Ceph user to map the image as. Defaults to "admin".
+	RadosUser string `yaml:"user,omitempty" json:"user,omitempty"`
+	// Optional: Path to the user's keyring on the host. Defaults to
+	// "/etc/ceph/keyring".
+	Keyring string `yaml:"keyring,omitempty" json:"keyring,omitempty"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts. Images mapped read/write are
+	// locked so that no other host can map them read/write too.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+// CephFS represents a path in a Ceph filesystem.
+type CephFS struct {
+	// Required: Addresses of the Ceph monitors, as IP or IP:port.
+	Monitors []string `yaml:"monitors" json:"monitors"`
+	// Optional: Path within the filesystem to mount. Defaults to "/".
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Optional: Ceph user to mount as. Defaults to "admin".
+	User string `yaml:"user,omitempty" json:"user,omitempty"`
+	// Optional: Path to a file on the host holding the user's secret key.
+	SecretFile string `yaml:"secretFile,omitempty" json:"secretFile,omitempty"`
+	// Optional: The user's secret key, if SecretFile isn't set. Without
+	// either the filesystem is mounted without authentication.
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+// Flocker represents a dataset managed by the Flocker control service.
+type Flocker struct {
+	// Required: Name of the dataset, as given in its metadata.
+	DatasetName string `yaml:"datasetName" json:"datasetName"`
+}
+
+// AzureDisk represents an Azure data disk.
+type AzureDisk struct {
+	// Required: Name of the data disk.
+	DiskName string `yaml:"diskName" json:"diskName"`
+	// Required: URI of the data disk's blob or managed disk resource.
+	DataDiskURI string `yaml:"diskURI" json:"diskURI"`
+	// Optional: Host caching mode: "None", "ReadOnly" or "ReadWrite".
+	// Defaults to "ReadWrite".
+	CachingMode string `yaml:"cachingMode,omitempty" json:"cachingMode,omitempty"`
+	// Optional: Filesystem type to mount. An unformatted disk is formatted
+	// with this type before its first mount.
+	// Ex. "ext4", "xfs"
+	FSType string `yaml:"fsType,omitempty" json:"fsType,omitempty"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+// ISCSIDisk represents a LUN of an iSCSI target.
+type ISCSIDisk struct {
+	// Required: The target's portal, as IP or IP:port.
+	TargetPortal string `yaml:"targetPortal" json:"targetPortal"`
+	// Required: The target's iSCSI Qualified Name.
+	IQN string `yaml:"iqn" json:"iqn"`
+	// Optional: The LUN number on the target. Defaults to 0.
+	Lun int `yaml:"lun,omitempty" json:"lun,omitempty"`
+	// Optional: Filesystem type to mount. An unformatted LUN is formatted
+	// with this type before its first mount.
+	// Ex. "ext4", "xfs"
+	FSType string `yaml:"fsType,omitempty" json:"fsType,omitempty"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+// RamDisk is a memory-backed directory whose size is strictly enforced.
+type RamDisk struct {
+	// Required: Size in bytes of the ramdisk. Writes beyond it fail.
+	SizeBytes int64 `yaml:"sizeBytes" json:"sizeBytes"`
+}
+
+// StorageType defines ways that storage can be allocated to a volume.
+type StorageType string
+
+const (
+	StorageTypeDefault StorageType = ""       // use whatever the default is for the node
+	StorageTypeMemory  StorageType = "Memory" // use memory (tmpfs)
+)
+
+// GCEPersistentDisk represents a Persistent Disk resource in Google Compute Engine.
+//
+// A GCE PD must exist before mounting to a container. The disk must
+// also be in the same GCE project and zone as the kubelet. A GCE PD
+// can only be mounted as read/write once.
+type GCEPersistentDisk struct {
+	// Unique name of the PD resource. Used to identify the disk in GCE
+	PDName string `yaml:"pdName" json:"pdName"`
+	// Optional: Filesystem type to mount: "ext3", "ext4" or "xfs".
+	// Defaults to "ext4".
+	// An unformatted disk is formatted with this type before its first mount.
+	FSType string `yaml:"fsType,omitempty" json:"fsType,omitempty"`
+	// Optional: Partition on the disk to mount.
+	// If omitted, kubelet will attempt to mount the device name.
+	// Ex. For /dev/sda1, this field is "1", for /dev/sda, this field is 0 or empty.
+	Partition int `yaml:"partition,omitempty" json:"partition,omitempty"`
+	// Optional: Defaults to false (read/write). ReadOnly here will force
+	// the ReadOnly setting in VolumeMounts.
+	ReadOnly bool `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+	// Optional: Size in GB of the disk to create if no disk named PDName
+	// exists yet. If omitted, the disk must already exist.
+	SizeGB int64 `yaml:"sizeGB,omitempty" json:"sizeGB,omitempty"`
+	// Optional: Type of the disk to create, "pd-standard" or "pd-ssd".
+	// Defaults to "pd-standard". Only used when the disk is created.
+	DiskType string `yaml:"diskType,omitempty" json:"diskType,omitempty"`
+	// Optional: Only apply the volume's FSGroup to the root of the disk
+	// rather than to everything on it. Avoids slow pod starts for disks
+	// holding many files that already have the right ownership.
+	SkipFSGroupRecursion bool `yaml:"skipFSGroupRecursion,omitempty" json:"skipFSGroupRecursion,omitempty"`
+	// Optional: Permission bits given to the root of the disk's filesystem
+	// when it's mounted read/write. Unset leaves the disk's own mode.
+	DirMode uint32 `yaml:"dirMode,omitempty" json:"dirMode,omitempty"`
+}
 
 // Port represents a network port in a single container
 type Port struct {
@@ -202,7 +428,10 @@ type Event struct {
 	Event     string             `json:"event,omitempty"`
 	Manifest  *ContainerManifest `json:"manifest,omitempty"`
 	Container *Container         `json:"container,omitempty"`
-	Timestamp int64              `json:"timestamp"`
+	// Message describes why the event happened, such as the error of a
+	// failed operation.
+	Message   string `json:"message,omitempty"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 // The below types are used by kube_client and api_server.
@@ -318,6 +547,8 @@ type ServiceList struct {
 type Service struct {
 	JSONBase `json:",inline" yaml:",inline"`
 	Port     int `json:"port,omitempty" yaml:"port,omitempty"`
+	// Optional: Defaults to "TCP".
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
 
 	// This service's labels.
 	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
@@ -325,6 +556,13 @@ type Service struct {
 	// This service will route traffic to pods having labels matching this selector.
 	Selector                   map[string]string `json:"selector,omitempty" yaml:"selector,omitempty"`
 	CreateExternalLoadBalancer bool              `json:"createExternalLoadBalancer,omitempty" yaml:"createExternalLoadBalancer,omitempty"`
+	// Optional: How the external load balancer picks the host for a
+	// connection: "NONE", "CLIENT_IP" or "CLIENT_IP_PROTO". Defaults to
+	// "NONE". It can't be changed once the load balancer is created.
+	SessionAffinity string `json:"sessionAffinity,omitempty" yaml:"sessionAffinity,omitempty"`
+	// Optional: A reserved static IP for the external load balancer. An
+	// ephemeral IP is allocated if it is empty.
+	LoadBalancerIP string `json:"loadBalancerIP,omitempty" yaml:"loadBalancerIP,omitempty"`
 
 	// ContainerPort is the name of the port on the container to direct traffic to.
 	// Optional, if unspecified use the first port on the container.
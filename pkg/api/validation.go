@@ -17,6 +17,8 @@ limitations under the License.
 package api
 
 import (
+	"fmt"
+	"net"
 	"strings"
 
 	errs "github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
@@ -35,6 +37,18 @@ func validateVolumes(volumes []Volume) (util.StringSet, errs.ErrorList) {
 		if vol.Source != nil {
 			el = validateSource(vol.Source).Prefix("source")
 		}
+		if vol.PostMountCommand != nil && (len(vol.PostMountCommand) == 0 || len(vol.PostMountCommand[0]) == 0) {
+			el = append(el, errs.NewRequired("postMountCommand", vol.PostMountCommand))
+		}
+		el = append(el, validateMountOptions(vol).Prefix("mountOptions")...)
+		el = append(el, validateSELinuxContext(vol).Prefix("selinuxContext")...)
+		if vol.FSGroup != nil {
+			if vol.Source != nil && vol.Source.EmptyDirectory == nil && vol.Source.GCEPersistentDisk == nil {
+				el = append(el, errs.NewNotSupported("fsGroup", *vol.FSGroup))
+			} else if *vol.FSGroup < 0 {
+				el = append(el, errs.NewInvalid("fsGroup", *vol.FSGroup))
+			}
+		}
 		if len(vol.Name) == 0 {
 			el = append(el, errs.NewRequired("name", vol.Name))
 		} else if !util.IsDNSLabel(vol.Name) {
@@ -60,7 +74,59 @@ func validateSource(source *VolumeSource) errs.ErrorList {
 	}
 	if source.EmptyDirectory != nil {
 		numVolumes++
-		//EmptyDirs have nothing to validate
+		allErrs = append(allErrs, validateEmptyDir(source.EmptyDirectory).Prefix("emptyDirectory")...)
+	}
+	if source.GCEPersistentDisk != nil {
+		numVolumes++
+		allErrs = append(allErrs, validateGCEPersistentDisk(source.GCEPersistentDisk).Prefix("persistentDisk")...)
+	}
+	if source.RamDisk != nil {
+		numVolumes++
+		allErrs = append(allErrs, validateRamDisk(source.RamDisk).Prefix("ramDisk")...)
+	}
+	if source.ISCSI != nil {
+		numVolumes++
+		allErrs = append(allErrs, validateISCSIDisk(source.ISCSI).Prefix("iscsi")...)
+	}
+	if source.AWSElasticBlockStore != nil {
+		numVolumes++
+		// No cloud provider can attach EBS volumes yet, so a pod using one
+		// could never start.
+		allErrs = append(allErrs, errs.NewNotSupported("awsElasticBlockStore", source.AWSElasticBlockStore))
+		allErrs = append(allErrs, validateAWSElasticBlockStore(source.AWSElasticBlockStore).Prefix("awsElasticBlockStore")...)
+	}
+	if source.Glusterfs != nil {
+		numVolumes++
+		allErrs = append(allErrs, validateGlusterfs(source.Glusterfs).Prefix("glusterfs")...)
+	}
+	if source.Secret != nil {
+		numVolumes++
+		// The kubelet has no store to fetch secrets from yet, so a pod
+		// using one could never start.
+		allErrs = append(allErrs, errs.NewNotSupported("secret", source.Secret))
+		allErrs = append(allErrs, validateSecretSource(source.Secret).Prefix("secret")...)
+	}
+	if source.RBD != nil {
+		numVolumes++
+		allErrs = append(allErrs, validateRBDImage(source.RBD).Prefix("rbd")...)
+	}
+	if source.AzureDisk != nil {
+		numVolumes++
+		// No cloud provider can attach Azure disks yet, so a pod using one
+		// could never start.
+		allErrs = append(allErrs, errs.NewNotSupported("azureDisk", source.AzureDisk))
+		allErrs = append(allErrs, validateAzureDisk(source.AzureDisk).Prefix("azureDisk")...)
+	}
+	if source.CephFS != nil {
+		numVolumes++
+		allErrs = append(allErrs, validateCephFS(source.CephFS).Prefix("cephfs")...)
+	}
+	if source.Flocker != nil {
+		numVolumes++
+		// The kubelet has no Flocker control service client yet, so a pod
+		// using one could never start.
+		allErrs = append(allErrs, errs.NewNotSupported("flocker", source.Flocker))
+		allErrs = append(allErrs, validateFlocker(source.Flocker).Prefix("flocker")...)
 	}
 	if numVolumes != 1 {
 		allErrs = append(allErrs, errs.NewInvalid("", source))
@@ -68,6 +134,43 @@ func validateSource(source *VolumeSource) errs.ErrorList {
 	return allErrs
 }
 
+func validateMountOptions(vol *Volume) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if len(vol.MountOptions) > 0 && vol.Source != nil && vol.Source.HostDirectory != nil {
+		allErrs = append(allErrs, errs.NewNotSupported("", vol.MountOptions))
+	}
+	for i, option := range vol.MountOptions {
+		if len(option) == 0 || strings.ContainsAny(option, ", ") {
+			allErrs = append(allErrs, errs.NewInvalid(fmt.Sprintf("[%d]", i), option))
+		}
+	}
+	return allErrs
+}
+
+// validateSELinuxContext checks that the context has at least the user, role
+// and type fields and is only set on volumes the kubelet can label.
+func validateSELinuxContext(vol *Volume) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if len(vol.SELinuxContext) == 0 {
+		return allErrs
+	}
+	if vol.Source != nil && vol.Source.EmptyDirectory == nil && vol.Source.GCEPersistentDisk == nil {
+		allErrs = append(allErrs, errs.NewNotSupported("", vol.SELinuxContext))
+	}
+	parts := strings.SplitN(vol.SELinuxContext, ":", 4)
+	if len(parts) < 3 || strings.ContainsAny(vol.SELinuxContext, "\" \t") {
+		allErrs = append(allErrs, errs.NewInvalid("", vol.SELinuxContext))
+	} else {
+		for _, part := range parts[:3] {
+			if len(part) == 0 {
+				allErrs = append(allErrs, errs.NewInvalid("", vol.SELinuxContext))
+				break
+			}
+		}
+	}
+	return allErrs
+}
+
 func validateHostDir(hostDir *HostDirectory) errs.ErrorList {
 	allErrs := errs.ErrorList{}
 	if hostDir.Path == "" {
@@ -76,6 +179,151 @@ func validateHostDir(hostDir *HostDirectory) errs.ErrorList {
 	return allErrs
 }
 
+var supportedStorageTypes = util.NewStringSet(string(StorageTypeDefault), string(StorageTypeMemory))
+
+func validateEmptyDir(emptyDir *EmptyDirectory) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if !supportedStorageTypes.Has(string(emptyDir.Medium)) {
+		allErrs = append(allErrs, errs.NewNotSupported("medium", emptyDir.Medium))
+	}
+	if emptyDir.SizeLimit < 0 {
+		allErrs = append(allErrs, errs.NewInvalid("sizeLimit", emptyDir.SizeLimit))
+	}
+	if emptyDir.DirMode&^0777 != 0 {
+		allErrs = append(allErrs, errs.NewInvalid("dirMode", emptyDir.DirMode))
+	}
+	return allErrs
+}
+
+var supportedDiskTypes = util.NewStringSet("", "pd-standard", "pd-ssd")
+
+// SupportedPDFSTypes are the filesystems GCE persistent disks can be
+// formatted with and mounted as. An empty FSType means the kubelet's default.
+var SupportedPDFSTypes = util.NewStringSet("ext3", "ext4", "xfs")
+
+func validateGCEPersistentDisk(PD *GCEPersistentDisk) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if PD.PDName == "" {
+		allErrs = append(allErrs, errs.NewRequired("pdName", PD.PDName))
+	}
+	if PD.SizeGB < 0 {
+		allErrs = append(allErrs, errs.NewInvalid("sizeGB", PD.SizeGB))
+	}
+	if !supportedDiskTypes.Has(PD.DiskType) {
+		allErrs = append(allErrs, errs.NewNotSupported("diskType", PD.DiskType))
+	}
+	if PD.Partition < 0 {
+		allErrs = append(allErrs, errs.NewInvalid("partition", PD.Partition))
+	}
+	if PD.FSType != "" && !SupportedPDFSTypes.Has(PD.FSType) {
+		allErrs = append(allErrs, errs.NewNotSupported("fsType", PD.FSType))
+	}
+	if PD.DirMode&^0777 != 0 {
+		allErrs = append(allErrs, errs.NewInvalid("dirMode", PD.DirMode))
+	}
+	return allErrs
+}
+
+func validateISCSIDisk(disk *ISCSIDisk) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if disk.TargetPortal == "" {
+		allErrs = append(allErrs, errs.NewRequired("targetPortal", disk.TargetPortal))
+	}
+	if disk.IQN == "" {
+		allErrs = append(allErrs, errs.NewRequired("iqn", disk.IQN))
+	}
+	if disk.Lun < 0 || disk.Lun > 255 {
+		allErrs = append(allErrs, errs.NewInvalid("lun", disk.Lun))
+	}
+	return allErrs
+}
+
+func validateAWSElasticBlockStore(ebs *AWSElasticBlockStore) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if ebs.VolumeID == "" {
+		allErrs = append(allErrs, errs.NewRequired("volumeID", ebs.VolumeID))
+	}
+	if ebs.Partition < 0 {
+		allErrs = append(allErrs, errs.NewInvalid("partition", ebs.Partition))
+	}
+	return allErrs
+}
+
+func validateGlusterfs(glusterfs *Glusterfs) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if glusterfs.EndpointsName == "" {
+		allErrs = append(allErrs, errs.NewRequired("endpoints", glusterfs.EndpointsName))
+	}
+	if glusterfs.Path == "" {
+		allErrs = append(allErrs, errs.NewRequired("path", glusterfs.Path))
+	}
+	return allErrs
+}
+
+func validateSecretSource(secret *SecretSource) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if secret.Name == "" {
+		allErrs = append(allErrs, errs.NewRequired("name", secret.Name))
+	}
+	return allErrs
+}
+
+func validateRBDImage(rbd *RBDImage) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if len(rbd.CephMonitors) == 0 {
+		allErrs = append(allErrs, errs.NewRequired("monitors", rbd.CephMonitors))
+	}
+	if rbd.RBDImage == "" {
+		allErrs = append(allErrs, errs.NewRequired("image", rbd.RBDImage))
+	}
+	return allErrs
+}
+
+func validateCephFS(cephfs *CephFS) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if len(cephfs.Monitors) == 0 {
+		allErrs = append(allErrs, errs.NewRequired("monitors", cephfs.Monitors))
+	}
+	if cephfs.Secret != "" && cephfs.SecretFile != "" {
+		allErrs = append(allErrs, errs.NewInvalid("secret", "<hidden>"))
+	}
+	return allErrs
+}
+
+func validateFlocker(flocker *Flocker) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if flocker.DatasetName == "" {
+		allErrs = append(allErrs, errs.NewRequired("datasetName", flocker.DatasetName))
+	}
+	return allErrs
+}
+
+var supportedAzureCachingModes = util.NewStringSet("", "None", "ReadOnly", "ReadWrite")
+
+func validateAzureDisk(disk *AzureDisk) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if disk.DiskName == "" {
+		allErrs = append(allErrs, errs.NewRequired("diskName", disk.DiskName))
+	}
+	if disk.DataDiskURI == "" {
+		allErrs = append(allErrs, errs.NewRequired("diskURI", disk.DataDiskURI))
+	}
+	if !supportedAzureCachingModes.Has(disk.CachingMode) {
+		allErrs = append(allErrs, errs.NewNotSupported("cachingMode", disk.CachingMode))
+	}
+	return allErrs
+}
+
+func validateRamDisk(ramDisk *RamDisk) errs.ErrorList {
+	allErrs := errs.ErrorList{}
+	if ramDisk.SizeBytes == 0 {
+		allErrs = append(allErrs, errs.NewRequired("sizeBytes", ramDisk.SizeBytes))
+	} else if ramDisk.SizeBytes < 0 {
+		allErrs = append(allErrs, errs.NewInvalid("sizeBytes", ramDisk.SizeBytes))
+	}
+	return allErrs
+}
+
 var supportedPortProtocols = util.NewStringSet("TCP", "UDP")
 
 func validatePorts(ports []Port) errs.ErrorList {
@@ -255,6 +503,8 @@ func ValidatePod(pod *Pod) errs.ErrorList {
 	return allErrs
 }
 
+var supportedSessionAffinities = util.NewStringSet("", "NONE", "CLIENT_IP", "CLIENT_IP_PROTO")
+
 // ValidateService tests if required fields in the service are set.
 func ValidateService(service *Service) errs.ErrorList {
 	allErrs := errs.ErrorList{}
@@ -266,9 +516,20 @@ func ValidateService(service *Service) errs.ErrorList {
 	if !util.IsValidPortNum(service.Port) {
 		allErrs = append(allErrs, errs.NewInvalid("Service.Port", service.Port))
 	}
+	if len(service.Protocol) == 0 {
+		service.Protocol = "TCP"
+	} else if !supportedPortProtocols.Has(strings.ToUpper(service.Protocol)) {
+		allErrs = append(allErrs, errs.NewNotSupported("protocol", service.Protocol))
+	}
 	if labels.Set(service.Selector).AsSelector().Empty() {
 		allErrs = append(allErrs, errs.NewRequired("selector", service.Selector))
 	}
+	if !supportedSessionAffinities.Has(service.SessionAffinity) {
+		allErrs = append(allErrs, errs.NewNotSupported("sessionAffinity", service.SessionAffinity))
+	}
+	if service.LoadBalancerIP != "" && net.ParseIP(service.LoadBalancerIP) == nil {
+		allErrs = append(allErrs, errs.NewInvalid("loadBalancerIP", service.LoadBalancerIP))
+	}
 	return allErrs
 }
 
@@ -33,17 +33,29 @@ func expectPrefix(t *testing.T, prefix string, errs errors.ErrorList) {
 }
 
 func TestValidateVolumes(t *testing.T) {
+	gid, negativeGID := int64(2000), int64(-1)
 	successCase := []Volume{
 		{Name: "abc"},
-		{Name: "123", Source: &VolumeSource{HostDirectory: &HostDirectory{"/mnt/path2"}}},
-		{Name: "abc-123", Source: &VolumeSource{HostDirectory: &HostDirectory{"/mnt/path3"}}},
-		{Name: "empty", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{}}},
+		{Name: "123", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/path2"}}},
+		{Name: "abc-123", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/path3"}}},
+		{Name: "empty", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{DirMode: 0755}}},
+		{Name: "tmpfs", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{Medium: StorageTypeMemory}}},
+		{Name: "gcepd", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", FSType: "ext4", SizeGB: 10, DiskType: "pd-ssd", DirMode: 0700}}},
+		{Name: "ramdisk", Source: &VolumeSource{RamDisk: &RamDisk{SizeBytes: 64 * 1024 * 1024}}},
+		{Name: "init", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{}}, PostMountCommand: []string{"mkdir", "-p"}},
+		{Name: "iscsi", Source: &VolumeSource{ISCSI: &ISCSIDisk{TargetPortal: "10.0.0.1:3260", IQN: "iqn.2014-10.com.example:storage", Lun: 1}}},
+		{Name: "options", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{Medium: StorageTypeMemory}}, MountOptions: []string{"nodev", "nosuid"}},
+		{Name: "gluster", Source: &VolumeSource{Glusterfs: &Glusterfs{EndpointsName: "glusterfs-cluster", Path: "kube_vol", ReadOnly: true}}},
+		{Name: "rbd", Source: &VolumeSource{RBD: &RBDImage{CephMonitors: []string{"10.0.0.1:6789"}, RBDImage: "foo", FSType: "ext4"}}},
+		{Name: "cephfs", Source: &VolumeSource{CephFS: &CephFS{Monitors: []string{"10.0.0.1:6789", "10.0.0.2"}, Path: "/shared", SecretFile: "/etc/ceph/admin.secret"}}},
+		{Name: "fsgroup", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", SkipFSGroupRecursion: true}}, FSGroup: &gid},
+		{Name: "selinux", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd"}}, SELinuxContext: "system_u:object_r:svirt_sandbox_file_t:s0:c1,c2"},
 	}
 	names, errs := validateVolumes(successCase)
 	if len(errs) != 0 {
 		t.Errorf("expected success: %v", errs)
 	}
-	if len(names) != 4 || !names.HasAll("abc", "123", "abc-123", "empty") {
+	if len(names) != 15 || !names.HasAll("abc", "123", "abc-123", "empty", "tmpfs", "gcepd", "ramdisk", "init", "iscsi", "options", "selinux", "fsgroup", "gluster", "rbd", "cephfs") {
 		t.Errorf("wrong names result: %v", names)
 	}
 
@@ -52,10 +64,38 @@ func TestValidateVolumes(t *testing.T) {
 		T errors.ValidationErrorType
 		F string
 	}{
-		"zero-length name":     {[]Volume{{Name: ""}}, errors.ValidationErrorTypeRequired, "[0].name"},
-		"name > 63 characters": {[]Volume{{Name: strings.Repeat("a", 64)}}, errors.ValidationErrorTypeInvalid, "[0].name"},
-		"name not a DNS label": {[]Volume{{Name: "a.b.c"}}, errors.ValidationErrorTypeInvalid, "[0].name"},
-		"name not unique":      {[]Volume{{Name: "abc"}, {Name: "abc"}}, errors.ValidationErrorTypeDuplicate, "[1].name"},
+		"zero-length name":         {[]Volume{{Name: ""}}, errors.ValidationErrorTypeRequired, "[0].name"},
+		"name > 63 characters":     {[]Volume{{Name: strings.Repeat("a", 64)}}, errors.ValidationErrorTypeInvalid, "[0].name"},
+		"name not a DNS label":     {[]Volume{{Name: "a.b.c"}}, errors.ValidationErrorTypeInvalid, "[0].name"},
+		"name not unique":          {[]Volume{{Name: "abc"}, {Name: "abc"}}, errors.ValidationErrorTypeDuplicate, "[1].name"},
+		"missing pdName":           {[]Volume{{Name: "abc", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{}}}}, errors.ValidationErrorTypeRequired, "[0].source.persistentDisk.pdName"},
+		"negative sizeLimit":       {[]Volume{{Name: "abc", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{SizeLimit: -1}}}}, errors.ValidationErrorTypeInvalid, "[0].source.emptyDirectory.sizeLimit"},
+		"negative sizeGB":          {[]Volume{{Name: "abc", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", SizeGB: -1}}}}, errors.ValidationErrorTypeInvalid, "[0].source.persistentDisk.sizeGB"},
+		"unsupported diskType":     {[]Volume{{Name: "abc", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", DiskType: "pd-tape"}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.persistentDisk.diskType"},
+		"missing sizeBytes":        {[]Volume{{Name: "abc", Source: &VolumeSource{RamDisk: &RamDisk{}}}}, errors.ValidationErrorTypeRequired, "[0].source.ramDisk.sizeBytes"},
+		"negative sizeBytes":       {[]Volume{{Name: "abc", Source: &VolumeSource{RamDisk: &RamDisk{SizeBytes: -1}}}}, errors.ValidationErrorTypeInvalid, "[0].source.ramDisk.sizeBytes"},
+		"empty postMountCommand":   {[]Volume{{Name: "abc", PostMountCommand: []string{}}}, errors.ValidationErrorTypeRequired, "[0].postMountCommand"},
+		"missing iqn":              {[]Volume{{Name: "abc", Source: &VolumeSource{ISCSI: &ISCSIDisk{TargetPortal: "10.0.0.1"}}}}, errors.ValidationErrorTypeRequired, "[0].source.iscsi.iqn"},
+		"invalid lun":              {[]Volume{{Name: "abc", Source: &VolumeSource{ISCSI: &ISCSIDisk{TargetPortal: "10.0.0.1", IQN: "iqn.2014-10.com.example:storage", Lun: 256}}}}, errors.ValidationErrorTypeInvalid, "[0].source.iscsi.lun"},
+		"hostDir mountOptions":     {[]Volume{{Name: "abc", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/path"}}, MountOptions: []string{"nodev"}}}, errors.ValidationErrorTypeNotSupported, "[0].mountOptions"},
+		"invalid mountOption":      {[]Volume{{Name: "abc", MountOptions: []string{"nodev,nosuid"}}}, errors.ValidationErrorTypeInvalid, "[0].mountOptions[0]"},
+		"hostDir selinuxContext":   {[]Volume{{Name: "abc", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/path"}}, SELinuxContext: "system_u:object_r:svirt_sandbox_file_t"}}, errors.ValidationErrorTypeNotSupported, "[0].selinuxContext"},
+		"invalid selinuxContext":   {[]Volume{{Name: "abc", SELinuxContext: "svirt_sandbox_file_t"}}, errors.ValidationErrorTypeInvalid, "[0].selinuxContext"},
+		"hostDir fsGroup":          {[]Volume{{Name: "abc", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/path"}}, FSGroup: &gid}}, errors.ValidationErrorTypeNotSupported, "[0].fsGroup"},
+		"negative fsGroup":         {[]Volume{{Name: "abc", FSGroup: &negativeGID}}, errors.ValidationErrorTypeInvalid, "[0].fsGroup"},
+		"unsupported ebs source":   {[]Volume{{Name: "abc", Source: &VolumeSource{AWSElasticBlockStore: &AWSElasticBlockStore{VolumeID: "vol-0a1b2c3d", FSType: "ext4", Partition: 1}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.awsElasticBlockStore"},
+		"missing glusterfs path":   {[]Volume{{Name: "abc", Source: &VolumeSource{Glusterfs: &Glusterfs{EndpointsName: "glusterfs-cluster"}}}}, errors.ValidationErrorTypeRequired, "[0].source.glusterfs.path"},
+		"unsupported secret":       {[]Volume{{Name: "abc", Source: &VolumeSource{Secret: &SecretSource{Name: "tls-certs"}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.secret"},
+		"missing rbd monitors":     {[]Volume{{Name: "abc", Source: &VolumeSource{RBD: &RBDImage{RBDImage: "foo"}}}}, errors.ValidationErrorTypeRequired, "[0].source.rbd.monitors"},
+		"unsupported azure source": {[]Volume{{Name: "abc", Source: &VolumeSource{AzureDisk: &AzureDisk{DiskName: "data", DataDiskURI: "https://example.blob.core.windows.net/vhds/data.vhd", CachingMode: "ReadOnly"}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.azureDisk"},
+		"missing cephfs monitors":  {[]Volume{{Name: "abc", Source: &VolumeSource{CephFS: &CephFS{Path: "/shared"}}}}, errors.ValidationErrorTypeRequired, "[0].source.cephfs.monitors"},
+		"two cephfs secrets":       {[]Volume{{Name: "abc", Source: &VolumeSource{CephFS: &CephFS{Monitors: []string{"10.0.0.1"}, Secret: "key", SecretFile: "/etc/ceph/admin.secret"}}}}, errors.ValidationErrorTypeInvalid, "[0].source.cephfs.secret"},
+		"unsupported flocker":      {[]Volume{{Name: "abc", Source: &VolumeSource{Flocker: &Flocker{DatasetName: "my-dataset"}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.flocker"},
+		"negative pd partition":    {[]Volume{{Name: "abc", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", Partition: -1}}}}, errors.ValidationErrorTypeInvalid, "[0].source.persistentDisk.partition"},
+		"unsupported pd fsType":    {[]Volume{{Name: "abc", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", FSType: "btrfs"}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.persistentDisk.fsType"},
+		"setuid dir mode":          {[]Volume{{Name: "abc", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{DirMode: 04755}}}}, errors.ValidationErrorTypeInvalid, "[0].source.emptyDirectory.dirMode"},
+		"large pd dir mode":        {[]Volume{{Name: "abc", Source: &VolumeSource{GCEPersistentDisk: &GCEPersistentDisk{PDName: "my-pd", DirMode: 01000}}}}, errors.ValidationErrorTypeInvalid, "[0].source.persistentDisk.dirMode"},
+		"unsupported medium":       {[]Volume{{Name: "abc", Source: &VolumeSource{EmptyDirectory: &EmptyDirectory{Medium: "Tape"}}}}, errors.ValidationErrorTypeNotSupported, "[0].source.emptyDirectory.medium"},
 	}
 	for k, v := range errorCases {
 		_, errs := validateVolumes(v.V)
@@ -74,6 +114,49 @@ func TestValidateVolumes(t *testing.T) {
 	}
 }
 
+func TestValidateAWSElasticBlockStore(t *testing.T) {
+	ebs := &AWSElasticBlockStore{VolumeID: "vol-0a1b2c3d", FSType: "ext4", Partition: 1}
+	if errs := validateAWSElasticBlockStore(ebs); len(errs) != 0 {
+		t.Errorf("expected success: %v", errs)
+	}
+	errs := validateAWSElasticBlockStore(&AWSElasticBlockStore{})
+	if len(errs) != 1 || errs[0].(errors.ValidationError).Type != errors.ValidationErrorTypeRequired || errs[0].(errors.ValidationError).Field != "volumeID" {
+		t.Errorf("expected a required volumeID, got %v", errs)
+	}
+}
+
+func TestValidateSecretSource(t *testing.T) {
+	if errs := validateSecretSource(&SecretSource{Name: "tls-certs"}); len(errs) != 0 {
+		t.Errorf("expected success: %v", errs)
+	}
+	errs := validateSecretSource(&SecretSource{})
+	if len(errs) != 1 || errs[0].(errors.ValidationError).Type != errors.ValidationErrorTypeRequired || errs[0].(errors.ValidationError).Field != "name" {
+		t.Errorf("expected a required name, got %v", errs)
+	}
+}
+
+func TestValidateFlocker(t *testing.T) {
+	if errs := validateFlocker(&Flocker{DatasetName: "my-dataset"}); len(errs) != 0 {
+		t.Errorf("expected success: %v", errs)
+	}
+	errs := validateFlocker(&Flocker{})
+	if len(errs) != 1 || errs[0].(errors.ValidationError).Type != errors.ValidationErrorTypeRequired || errs[0].(errors.ValidationError).Field != "datasetName" {
+		t.Errorf("expected a required datasetName, got %v", errs)
+	}
+}
+
+func TestValidateAzureDisk(t *testing.T) {
+	disk := &AzureDisk{DiskName: "data", DataDiskURI: "https://example.blob.core.windows.net/vhds/data.vhd", CachingMode: "ReadOnly"}
+	if errs := validateAzureDisk(disk); len(errs) != 0 {
+		t.Errorf("expected success: %v", errs)
+	}
+	disk.CachingMode = "WriteBack"
+	errs := validateAzureDisk(disk)
+	if len(errs) != 1 || errs[0].(errors.ValidationError).Type != errors.ValidationErrorTypeNotSupported || errs[0].(errors.ValidationError).Field != "cachingMode" {
+		t.Errorf("expected an unsupported cachingMode, got %v", errs)
+	}
+}
+
 func TestValidatePorts(t *testing.T) {
 	successCase := []Port{
 		{Name: "abc", ContainerPort: 80, HostPort: 80, Protocol: "TCP"},
@@ -223,8 +306,8 @@ func TestValidateManifest(t *testing.T) {
 		{
 			Version: "v1beta1",
 			ID:      "abc",
-			Volumes: []Volume{{Name: "vol1", Source: &VolumeSource{HostDirectory: &HostDirectory{"/mnt/vol1"}}},
-				{Name: "vol2", Source: &VolumeSource{HostDirectory: &HostDirectory{"/mnt/vol2"}}}},
+			Volumes: []Volume{{Name: "vol1", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/vol1"}}},
+				{Name: "vol2", Source: &VolumeSource{HostDirectory: &HostDirectory{Path: "/mnt/vol2"}}}},
 			Containers: []Container{
 				{
 					Name:       "abc",
@@ -366,6 +449,59 @@ func TestValidateService(t *testing.T) {
 	if len(errs) != 3 {
 		t.Errorf("Unexpected error list: %#v", errs)
 	}
+
+	service := &Service{
+		Port:     53,
+		JSONBase: JSONBase{ID: "foo"},
+		Selector: map[string]string{
+			"foo": "bar",
+		},
+	}
+	errs = ValidateService(service)
+	if len(errs) != 0 {
+		t.Errorf("Unexpected non-zero error list: %#v", errs)
+	}
+	if service.Protocol != "TCP" {
+		t.Errorf("Expected the protocol to default to TCP, got %q", service.Protocol)
+	}
+
+	service.Protocol = "UDP"
+	errs = ValidateService(service)
+	if len(errs) != 0 {
+		t.Errorf("Unexpected non-zero error list: %#v", errs)
+	}
+
+	service.Protocol = "SCTP"
+	errs = ValidateService(service)
+	if len(errs) != 1 {
+		t.Errorf("Unexpected error list: %#v", errs)
+	}
+
+	service.Protocol = "TCP"
+	service.SessionAffinity = "CLIENT_IP"
+	errs = ValidateService(service)
+	if len(errs) != 0 {
+		t.Errorf("Unexpected non-zero error list: %#v", errs)
+	}
+
+	service.SessionAffinity = "STICKY"
+	errs = ValidateService(service)
+	if len(errs) != 1 {
+		t.Errorf("Unexpected error list: %#v", errs)
+	}
+
+	service.SessionAffinity = ""
+	service.LoadBalancerIP = "1.2.3.4"
+	errs = ValidateService(service)
+	if len(errs) != 0 {
+		t.Errorf("Unexpected non-zero error list: %#v", errs)
+	}
+
+	service.LoadBalancerIP = "1.2.3"
+	errs = ValidateService(service)
+	if len(errs) != 1 {
+		t.Errorf("Unexpected error list: %#v", errs)
+	}
 }
 
 func TestValidateReplicationController(t *testing.T) {
@@ -17,6 +17,8 @@ limitations under the License.
 package cloudprovider
 
 import (
+	"context"
+	"errors"
 	"net"
 )
 
@@ -30,27 +32,85 @@ type Interface interface {
 	Zones() (Zones, bool)
 }
 
+// SessionAffinity is how a load balancer picks the host for a connection.
+type SessionAffinity string
+
+const (
+	// SessionAffinityNone spreads connections across hosts. It is the
+	// default when no affinity is given.
+	SessionAffinityNone SessionAffinity = "NONE"
+	// SessionAffinityClientIP sends connections from a client IP to the same host.
+	SessionAffinityClientIP SessionAffinity = "CLIENT_IP"
+	// SessionAffinityClientIPProto sends connections from a client IP with
+	// the same protocol to the same host.
+	SessionAffinityClientIPProto SessionAffinity = "CLIENT_IP_PROTO"
+)
+
 // TCPLoadBalancer is an abstract, pluggable interface for TCP load balancers.
 type TCPLoadBalancer interface {
 	// TCPLoadBalancerExists returns whether the specified load balancer exists.
 	// TODO: Break this up into different interfaces (LB, etc) when we have more than one type of service
 	TCPLoadBalancerExists(name, region string) (bool, error)
-	// CreateTCPLoadBalancer creates a new tcp load balancer.
-	CreateTCPLoadBalancer(name, region string, port int, hosts []string) error
-	// UpdateTCPLoadBalancer updates hosts under the specified load balancer.
-	UpdateTCPLoadBalancer(name, region string, hosts []string) error
-	// DeleteTCPLoadBalancer deletes a specified load balancer.
-	DeleteTCPLoadBalancer(name, region string) error
+	// GetTCPLoadBalancer returns the external address of the specified load
+	// balancer and whether it exists. A load balancer that doesn't exist is
+	// not an error.
+	GetTCPLoadBalancer(name, region string) (ip net.IP, exists bool, err error)
+	// CreateTCPLoadBalancer creates a new load balancer forwarding protocol
+	// ("TCP" or "UDP") traffic on ports, choosing hosts according to affinity.
+	// If externalIP is not empty the load balancer uses that address, which
+	// must already be reserved; otherwise an ephemeral address is allocated.
+	// A deadline on ctx bounds the total time spent creating it.
+	CreateTCPLoadBalancer(ctx context.Context, name, region, externalIP string, ports []int, protocol string, hosts []string, affinity SessionAffinity) error
+	// UpdateTCPLoadBalancer sets the hosts under the specified load balancer
+	// to hosts, removing any others.
+	// The session affinity can't be updated; the load balancer must be
+	// deleted and created again to change it.
+	// Cancelling ctx stops the update and returns ctx.Err().
+	UpdateTCPLoadBalancer(ctx context.Context, name, region string, hosts []string) error
+	// DeleteTCPLoadBalancer deletes a specified load balancer. Cancelling ctx
+	// stops the deletion and returns ctx.Err().
+	DeleteTCPLoadBalancer(ctx context.Context, name, region string) error
 }
 
+// ErrInstanceNotFound is returned, possibly wrapped, by Instances methods
+// when the named instance doesn't exist.
+var ErrInstanceNotFound = errors.New("instance not found")
+
 // Instances is an abstract, pluggable interface for sets of instances.
 type Instances interface {
 	// IPAddress returns an IP address of the specified instance.
 	IPAddress(name string) (net.IP, error)
+	// ExternalID returns the cloud provider's identifier for the specified
+	// instance, which doesn't change for the life of the instance. An error
+	// wrapping ErrInstanceNotFound is returned if the instance doesn't exist.
+	ExternalID(name string) (string, error)
 	// List lists instances that match 'filter' which is a regular expression which must match the entire instance name (fqdn)
 	List(filter string) ([]string, error)
 }
 
+// CurrentNodeNamer is implemented by cloud providers that can name the
+// instance the program is running on.
+type CurrentNodeNamer interface {
+	// CurrentNodeName returns the name of this instance as Instances.List
+	// gives it, so a node registering itself is found under that name.
+	CurrentNodeName() (string, error)
+}
+
+// NodeResources is the capacity of an instance.
+type NodeResources struct {
+	// CPUs is the number of cores the instance has.
+	CPUs int64
+	// MemoryBytes is the instance's memory, in bytes.
+	MemoryBytes int64
+}
+
+// NodeResourcesGetter is implemented by cloud providers that can report the
+// capacity of their instances, so it is known before the node reports it.
+type NodeResourcesGetter interface {
+	// GetNodeResources returns the capacity of the named instance.
+	GetNodeResources(name string) (*NodeResources, error)
+}
+
 // Zone represents the location of a particular machine
 type Zone struct {
 	FailureDomain string
@@ -61,4 +121,8 @@ type Zone struct {
 type Zones interface {
 	// GetZone returns the Zone containing the current failure zone and locality region that the program is running in
 	GetZone() (Zone, error)
+	// GetZoneByInstance returns the Zone of the named instance, which may be
+	// in a different zone than the program. An error wrapping
+	// ErrInstanceNotFound is returned if the instance doesn't exist.
+	GetZoneByInstance(name string) (Zone, error)
 }
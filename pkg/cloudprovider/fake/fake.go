@@ -17,22 +17,47 @@ limitations under the License.
 package fake_cloud
 
 import (
+	"context"
 	"net"
 	"regexp"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
 )
 
-// FakeCloud is a test-double implementation of Interface, TCPLoadBalancer and Instances. It is useful for testing.
+// FakeBalancer records the arguments of a call to CreateTCPLoadBalancer.
+type FakeBalancer struct {
+	Name       string
+	Region     string
+	ExternalIP string
+	Ports      []int
+	Protocol   string
+	Hosts      []string
+	Affinity   cloudprovider.SessionAffinity
+}
+
+// FakeCloud is a test-double implementation of Interface, TCPLoadBalancer, Instances and Zones. It is useful for testing.
 type FakeCloud struct {
 	Exists   bool
 	Err      error
 	Calls    []string
 	IP       net.IP
 	Machines []string
+	// IPs maps instance names to the addresses IPAddress returns. Names
+	// missing from it get IP.
+	IPs map[string]net.IP
+	// ExternalIDs maps instance names to the IDs ExternalID returns. Names
+	// missing from it aren't found.
+	ExternalIDs map[string]string
+	// Balancers records the load balancers created, in order.
+	Balancers []FakeBalancer
+	// InstanceZones maps instance names to the zones GetZoneByInstance
+	// returns. Names missing from it aren't found.
+	InstanceZones map[string]cloudprovider.Zone
 	cloudprovider.Zone
 }
 
+var _ cloudprovider.Interface = &FakeCloud{}
+
 func (f *FakeCloud) addCall(desc string) {
 	f.Calls = append(f.Calls, desc)
 }
@@ -65,23 +90,31 @@ func (f *FakeCloud) TCPLoadBalancerExists(name, region string) (bool, error) {
 	return f.Exists, f.Err
 }
 
+// GetTCPLoadBalancer is a stub implementation of TCPLoadBalancer.GetTCPLoadBalancer.
+// It returns IP as the address of any load balancer.
+func (f *FakeCloud) GetTCPLoadBalancer(name, region string) (net.IP, bool, error) {
+	return f.IP, f.Exists, f.Err
+}
+
 // CreateTCPLoadBalancer is a test-spy implementation of TCPLoadBalancer.CreateTCPLoadBalancer.
-// It adds an entry "create" into the internal method call record.
-func (f *FakeCloud) CreateTCPLoadBalancer(name, region string, port int, hosts []string) error {
+// It adds an entry "create" into the internal method call record and its
+// arguments to Balancers.
+func (f *FakeCloud) CreateTCPLoadBalancer(ctx context.Context, name, region, externalIP string, ports []int, protocol string, hosts []string, affinity cloudprovider.SessionAffinity) error {
 	f.addCall("create")
+	f.Balancers = append(f.Balancers, FakeBalancer{name, region, externalIP, ports, protocol, hosts, affinity})
 	return f.Err
 }
 
 // UpdateTCPLoadBalancer is a test-spy implementation of TCPLoadBalancer.UpdateTCPLoadBalancer.
 // It adds an entry "update" into the internal method call record.
-func (f *FakeCloud) UpdateTCPLoadBalancer(name, region string, hosts []string) error {
+func (f *FakeCloud) UpdateTCPLoadBalancer(ctx context.Context, name, region string, hosts []string) error {
 	f.addCall("update")
 	return f.Err
 }
 
 // DeleteTCPLoadBalancer is a test-spy implementation of TCPLoadBalancer.DeleteTCPLoadBalancer.
 // It adds an entry "delete" into the internal method call record.
-func (f *FakeCloud) DeleteTCPLoadBalancer(name, region string) error {
+func (f *FakeCloud) DeleteTCPLoadBalancer(ctx context.Context, name, region string) error {
 	f.addCall("delete")
 	return f.Err
 }
@@ -90,9 +123,26 @@ func (f *FakeCloud) DeleteTCPLoadBalancer(name, region string) error {
 // It adds an entry "ip-address" into the internal method call record.
 func (f *FakeCloud) IPAddress(instance string) (net.IP, error) {
 	f.addCall("ip-address")
+	if ip, found := f.IPs[instance]; found {
+		return ip, f.Err
+	}
 	return f.IP, f.Err
 }
 
+// ExternalID is a test-spy implementation of Instances.ExternalID.
+// It adds an entry "external-id" into the internal method call record.
+func (f *FakeCloud) ExternalID(instance string) (string, error) {
+	f.addCall("external-id")
+	if f.Err != nil {
+		return "", f.Err
+	}
+	id, found := f.ExternalIDs[instance]
+	if !found {
+		return "", cloudprovider.ErrInstanceNotFound
+	}
+	return id, nil
+}
+
 // List is a test-spy implementation of Instances.List.
 // It adds an entry "list" into the internal method call record.
 func (f *FakeCloud) List(filter string) ([]string, error) {
@@ -110,3 +160,17 @@ func (f *FakeCloud) GetZone() (cloudprovider.Zone, error) {
 	f.addCall("get-zone")
 	return f.Zone, f.Err
 }
+
+// GetZoneByInstance is a test-spy implementation of Zones.GetZoneByInstance.
+// It adds an entry "get-zone-by-instance" into the internal method call record.
+func (f *FakeCloud) GetZoneByInstance(name string) (cloudprovider.Zone, error) {
+	f.addCall("get-zone-by-instance")
+	if f.Err != nil {
+		return cloudprovider.Zone{}, f.Err
+	}
+	zone, found := f.InstanceZones[name]
+	if !found {
+		return cloudprovider.Zone{}, cloudprovider.ErrInstanceNotFound
+	}
+	return zone, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"code.google.com/p/goauth2/compute/serviceaccount"
+	"code.google.com/p/goauth2/oauth/jwt"
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+)
+
+// credentialsEnv names a JSON key file used when Config doesn't name one.
+const credentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// serviceAccountKey is the part of a service account's JSON key file needed
+// to authorize as it.
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// newClient returns the client API calls are authorized with: config's
+// Client, a client for the service account whose JSON key is in config's
+// CredentialsFile or $GOOGLE_APPLICATION_CREDENTIALS, or else a client for
+// the instance's own service account.
+func newClient(config *Config) (*http.Client, error) {
+	if config.Client != nil {
+		return config.Client, nil
+	}
+	credentialsFile := config.CredentialsFile
+	if credentialsFile == "" {
+		credentialsFile = os.Getenv(credentialsEnv)
+	}
+	if credentialsFile != "" {
+		return newCredentialsClient(credentialsFile)
+	}
+	return serviceaccount.NewClient(&serviceaccount.Options{})
+}
+
+// newCredentialsClient returns a client authorized as the service account
+// whose JSON key is in the named file.
+func newCredentialsClient(credentialsFile string) (*http.Client, error) {
+	data, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid credentials in %s: %v", credentialsFile, err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("invalid credentials in %s: not a service account key", credentialsFile)
+	}
+	token := jwt.NewToken(key.ClientEmail, compute.ComputeScope, []byte(key.PrivateKey))
+	transport, err := jwt.NewTransport(token)
+	if err != nil {
+		return nil, err
+	}
+	return transport.Client(), nil
+}
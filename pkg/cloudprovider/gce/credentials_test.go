@@ -0,0 +1,66 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNewClientUsesConfiguredClient(t *testing.T) {
+	client := &http.Client{}
+	got, err := newClient(&Config{Client: client, CredentialsFile: "/does/not/exist"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != client {
+		t.Errorf("expected the configured client to be used")
+	}
+}
+
+func TestNewClientInvalidCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gce-credentials")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"garbage.json":  "not json",
+		"user-key.json": `{"type": "authorized_user", "client_id": "me"}`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, name := range []string{"garbage.json", "user-key.json", "missing.json"} {
+		if _, err := newClient(&Config{CredentialsFile: path.Join(dir, name)}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	defer os.Setenv(credentialsEnv, os.Getenv(credentialsEnv))
+	os.Setenv(credentialsEnv, path.Join(dir, "garbage.json"))
+	config := &Config{ProjectID: "my-project", Zone: "us-central1-b", InstanceID: "my-instance"}
+	if _, err := NewGCECloud(config); err == nil {
+		t.Errorf("expected an error for invalid credentials named by %s", credentialsEnv)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"fmt"
+)
+
+// diskPerformance describes how a disk type's performance scales with its
+// size. IOPS and throughput grow linearly with size up to a per-disk cap.
+type diskPerformance struct {
+	diskType string
+	// iopsPerGB and maxIops bound read IOPS.
+	iopsPerGB float64
+	maxIops   int
+	// throughputPerGB and maxThroughput bound throughput in MB/s.
+	throughputPerGB float64
+	maxThroughput   int
+}
+
+func (p diskPerformance) iops(sizeGB int) int {
+	return minInt(int(p.iopsPerGB*float64(sizeGB)), p.maxIops)
+}
+
+func (p diskPerformance) throughput(sizeGB int) int {
+	return minInt(int(p.throughputPerGB*float64(sizeGB)), p.maxThroughput)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// diskPerformanceByCost lists the disk types CreateDisk supports, cheapest first.
+var diskPerformanceByCost = []diskPerformance{
+	{diskType: DiskTypeStandard, iopsPerGB: 0.75, maxIops: 3000, throughputPerGB: 0.12, maxThroughput: 180},
+	{diskType: DiskTypeSSD, iopsPerGB: 30, maxIops: 10000, throughputPerGB: 0.48, maxThroughput: 240},
+}
+
+// SelectDiskType returns the cheapest disk type available in zone that, at
+// sizeGB, provides at least minIops read IOPS and minThroughput MB/s.
+func (gce *GCECloud) SelectDiskType(sizeGB int, minIops, minThroughput int, zone string) (string, error) {
+	if sizeGB <= 0 {
+		return "", fmt.Errorf("invalid disk size: %dGB", sizeGB)
+	}
+	list, err := gce.service.DiskTypes.List(gce.projectID, zone).Do()
+	if err != nil {
+		return "", err
+	}
+	available := map[string]bool{}
+	for _, diskType := range list.Items {
+		available[diskType.Name] = true
+	}
+	for _, perf := range diskPerformanceByCost {
+		if !available[perf.diskType] {
+			continue
+		}
+		if perf.iops(sizeGB) >= minIops && perf.throughput(sizeGB) >= minThroughput {
+			return perf.diskType, nil
+		}
+	}
+	return "", fmt.Errorf("no disk type in %s provides %d IOPS and %d MB/s at %dGB", zone, minIops, minThroughput, sizeGB)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"net/http"
+	"testing"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+)
+
+func TestSelectDiskType(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/diskTypes": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.DiskTypeList{Items: []*compute.DiskType{
+				{Name: "pd-standard"}, {Name: "pd-ssd"},
+			}})
+		},
+		"GET /zones/us-central1-f/diskTypes": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.DiskTypeList{Items: []*compute.DiskType{
+				{Name: "pd-standard"},
+			}})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		sizeGB        int
+		minIops       int
+		minThroughput int
+		zone          string
+		expected      string
+		expectErr     bool
+	}{
+		{name: "low IOPS", sizeGB: 500, minIops: 300, minThroughput: 50, zone: "us-central1-b", expected: DiskTypeStandard},
+		{name: "high IOPS", sizeGB: 100, minIops: 3000, zone: "us-central1-b", expected: DiskTypeSSD},
+		{name: "too small for the IOPS", sizeGB: 10, minIops: 3000, zone: "us-central1-b", expectErr: true},
+		{name: "SSD unavailable", sizeGB: 100, minIops: 3000, zone: "us-central1-f", expectErr: true},
+		{name: "no size", sizeGB: 0, zone: "us-central1-b", expectErr: true},
+	}
+	for _, test := range tests {
+		diskType, err := gce.SelectDiskType(test.sizeGB, test.minIops, test.minThroughput, test.zone)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", test.name, diskType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if diskType != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, diskType)
+		}
+	}
+}
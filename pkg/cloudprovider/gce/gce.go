@@ -17,39 +17,104 @@ limitations under the License.
 package gce_cloud
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"os/exec"
+	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"code.google.com/p/goauth2/compute/serviceaccount"
 	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"code.google.com/p/google-api-go-client/googleapi"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/wait"
+	"github.com/golang/glog"
 )
 
 // GCECloud is an implementation of Interface, TCPLoadBalancer and Instances for Google Compute Engine.
 type GCECloud struct {
-	service    *compute.Service
-	projectID  string
-	zone       string
+	service *compute.Service
+	// client is the authorized client service uses, for requests the
+	// generated client can't make.
+	client    *http.Client
+	projectID string
+	zone      string
+	// region, if set, is the region of the cluster, which GetZone reports
+	// instead of the region of zone.
+	region     string
+	instanceID string
 	instanceRE string
+	// fqdnSuffix, if set, is appended to instance names by List instead of
+	// the host's own domain.
+	fqdnSuffix string
+	// nodeTags and nodeLabels, if set, are the network tags and labels an
+	// instance must all have for List to return it.
+	nodeTags   []string
+	nodeLabels map[string]string
+	// metadata caches values read by Metadata.
+	metadata *metadataCache
+	// healthCheck, if set, is attached to the target pools of new load balancers.
+	healthCheck *HealthCheck
+
+	// instanceZones caches the zones of instances by name.
+	zoneLock      sync.Mutex
+	instanceZones map[string]string
+
+	// machineTypes caches machine types by "<zone>/<name>"; they don't change.
+	machineTypeLock sync.Mutex
+	machineTypes    map[string]*compute.MachineType
+}
+
+// HealthCheck configures the HTTP health check GCE uses to decide which
+// instances in a target pool receive traffic.
+type HealthCheck struct {
+	// RequestPath is the path requested from each instance, e.g. "/healthz".
+	RequestPath string
+	// Port is the port the request is sent to.
+	Port int
 }
 
 func init() {
-	cloudprovider.RegisterCloudProvider("gce", func() (cloudprovider.Interface, error) { return newGCECloud() })
+	err := cloudprovider.RegisterCloudProvider("gce", func() (cloudprovider.Interface, error) { return NewGCECloud(nil) })
+	if err != nil {
+		glog.Fatal(err)
+	}
 }
 
-func getProjectAndZone() (string, string, error) {
+// metadataURL is the root of the GCE metadata server. A variable so tests can replace it.
+var metadataURL = "http://metadata/computeMetadata/v1"
+
+// metadataTimeout bounds getMetadata so a hung metadata server can't block
+// callers such as NewGCECloud forever. A variable so tests can shorten it.
+var metadataTimeout = 10 * time.Second
+
+// getMetadata fetches url from the metadata server, giving up after
+// metadataTimeout.
+func getMetadata(url string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+	value, _, err := getMetadataWithContext(ctx, url)
+	return value, err
+}
+
+// getMetadataWithContext fetches url from the metadata server, returning the
+// value and its ETag. The request is abandoned when ctx is cancelled. There is
+// no other timeout, as long-polling requests wait for a change indefinitely.
+func getMetadataWithContext(ctx context.Context, url string) (string, string, error) {
 	client := http.Client{}
-	url := "http://metadata/computeMetadata/v1/instance/zone"
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", "", err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Add("X-Google-Metadata-Request", "True")
 	res, err := client.Do(req)
 	if err != nil {
@@ -60,20 +125,96 @@ func getProjectAndZone() (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
-	parts := strings.Split(string(data), "/")
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("metadata request for %s failed with status %d: %s", url, res.StatusCode, string(data))
+	}
+	return string(data), res.Header.Get("ETag"), nil
+}
+
+func getProjectAndZone() (string, string, error) {
+	url := metadataURL + "/instance/zone"
+	result, err := instanceMetadata.get(url)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(result, "/")
 	if len(parts) != 4 {
-		return "", "", fmt.Errorf("Unexpected response: %s", string(data))
+		return "", "", fmt.Errorf("Unexpected response: %s", result)
 	}
 	return parts[1], parts[3], nil
 }
 
-// newGCECloud creates a new instance of GCECloud.
-func newGCECloud() (*GCECloud, error) {
-	projectID, zone, err := getProjectAndZone()
+func getInstanceID() (string, error) {
+	url := metadataURL + "/instance/hostname"
+	result, err := instanceMetadata.get(url)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	parts := strings.Split(result, ".")
+	if len(parts) == 0 {
+		return "", fmt.Errorf("Unexpected response: %s", result)
 	}
-	client, err := serviceaccount.NewClient(&serviceaccount.Options{})
+	return parts[0], nil
+}
+
+// Config holds the settings of a GCECloud that would otherwise be read from
+// the metadata server, for running outside of GCE.
+type Config struct {
+	ProjectID string
+	Zone      string
+	// Region is the region of the cluster, where its load balancers are
+	// created. Defaults to the region of Zone; set it when the cluster spans
+	// zones so the region doesn't depend on which instance reads it.
+	Region string
+	// InstanceID is the name of the instance disks are attached to.
+	InstanceID string
+	// Client is the authorized client used for API calls. If nil, the
+	// service account whose JSON key is in CredentialsFile is used.
+	Client *http.Client
+	// CredentialsFile is the path to a service account's JSON key, for
+	// running outside of GCE. Defaults to $GOOGLE_APPLICATION_CREDENTIALS;
+	// if neither is set, the instance's service account is used.
+	CredentialsFile string
+	// MetadataTTL is how long Metadata caches values. Defaults to a minute.
+	MetadataTTL time.Duration
+	// FQDNSuffix is the domain List appends to instance names, e.g.
+	// "c.my-project.internal". If empty, it is found by resolving the
+	// host's name.
+	FQDNSuffix string
+	// NodeTags and NodeLabels select the instances of the project that are
+	// nodes of the cluster: List only returns instances having all of the
+	// network tags and labels. If both are empty every instance is a node.
+	NodeTags   []string
+	NodeLabels map[string]string
+}
+
+// NewGCECloud creates a new instance of GCECloud. Settings missing from
+// config, which may be nil, are read from the metadata server.
+func NewGCECloud(config *Config) (*GCECloud, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	projectID, zone := config.ProjectID, config.Zone
+	if projectID == "" || zone == "" {
+		metadataProjectID, metadataZone, err := getProjectAndZone()
+		if err != nil {
+			return nil, err
+		}
+		if projectID == "" {
+			projectID = metadataProjectID
+		}
+		if zone == "" {
+			zone = metadataZone
+		}
+	}
+	instanceID := config.InstanceID
+	if instanceID == "" {
+		var err error
+		if instanceID, err = getInstanceID(); err != nil {
+			return nil, err
+		}
+	}
+	client, err := newClient(config)
 	if err != nil {
 		return nil, err
 	}
@@ -81,13 +222,30 @@ func newGCECloud() (*GCECloud, error) {
 	if err != nil {
 		return nil, err
 	}
+	metadataTTL := config.MetadataTTL
+	if metadataTTL == 0 {
+		metadataTTL = defaultMetadataTTL
+	}
 	return &GCECloud{
-		service:   svc,
-		projectID: projectID,
-		zone:      zone,
+		service:    svc,
+		client:     client,
+		projectID:  projectID,
+		zone:       zone,
+		region:     config.Region,
+		instanceID: instanceID,
+		fqdnSuffix: config.FQDNSuffix,
+		nodeTags:   config.NodeTags,
+		nodeLabels: config.NodeLabels,
+		metadata:   newMetadataCache(metadataTTL),
 	}, nil
 }
 
+// SetHealthCheck makes load balancers created after the call only send
+// traffic to instances passing check. A nil check turns health checking off.
+func (gce *GCECloud) SetHealthCheck(check *HealthCheck) {
+	gce.healthCheck = check
+}
+
 // TCPLoadBalancer returns an implementation of TCPLoadBalancer for Google Compute Engine.
 func (gce *GCECloud) TCPLoadBalancer() (cloudprovider.TCPLoadBalancer, bool) {
 	return gce, true
@@ -104,146 +262,809 @@ func (gce *GCECloud) Zones() (cloudprovider.Zones, bool) {
 }
 
 func makeHostLink(projectID, zone, host string) string {
-	ix := strings.Index(host, ".")
-	if ix != -1 {
-		host = host[:ix]
-	}
 	return fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/zones/%s/instances/%s",
-		projectID, zone, host)
+		projectID, zone, instanceName(host))
 }
 
-func (gce *GCECloud) makeTargetPool(name, region string, hosts []string) (string, error) {
+// makeTargetPool creates the target pool of a load balancer. Hosts may be in
+// any zone of region, but GCE doesn't allow them outside it.
+func (gce *GCECloud) makeTargetPool(ctx context.Context, name, region string, hosts []string, affinity cloudprovider.SessionAffinity) (string, error) {
 	var instances []string
 	for _, host := range hosts {
-		instances = append(instances, makeHostLink(gce.projectID, gce.zone, host))
+		zone, err := gce.GetInstanceZone(host)
+		if err != nil {
+			return "", err
+		}
+		if zoneRegion, err := getGceRegion(zone); err != nil || zoneRegion != region {
+			return "", fmt.Errorf("host %s in zone %s can't be in a target pool in region %s", host, zone, region)
+		}
+		instances = append(instances, makeHostLink(gce.projectID, zone, host))
 	}
 	pool := &compute.TargetPool{
-		Name:      name,
-		Instances: instances,
+		Name:            name,
+		Instances:       instances,
+		SessionAffinity: string(affinity),
 	}
-	_, err := gce.service.TargetPools.Insert(gce.projectID, region, pool).Do()
+	if gce.healthCheck != nil {
+		link, err := gce.ensureHealthCheck(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		pool.HealthChecks = []string{link}
+	}
+	op, err := retryOp(ctx, "create target pool "+name, http.StatusConflict, func() (*compute.Operation, error) {
+		return gce.service.TargetPools.Insert(gce.projectID, region, pool).Do()
+	})
 	if err != nil {
 		return "", err
 	}
+	if err = gce.waitForRegionOpIfAny(ctx, op, region); err != nil {
+		return "", err
+	}
 	link := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/regions/%s/targetPools/%s", gce.projectID, region, name)
 	return link, nil
 }
 
-func (gce *GCECloud) waitForRegionOp(op *compute.Operation, region string) error {
+func makeHealthCheckName(name string) string {
+	return fmt.Sprintf("k8s-hc-%s", name)
+}
+
+// ensureHealthCheck creates the HTTP health check for the named load balancer
+// from gce.healthCheck, updating an existing one of the same name, and
+// returns its URL.
+func (gce *GCECloud) ensureHealthCheck(ctx context.Context, name string) (string, error) {
+	check := &compute.HttpHealthCheck{
+		Name:        makeHealthCheckName(name),
+		Description: fmt.Sprintf("KubernetesAutoGenerated for load balancer %s", name),
+		RequestPath: gce.healthCheck.RequestPath,
+		Port:        int64(gce.healthCheck.Port),
+	}
+	op, err := retryOp(ctx, "create health check "+check.Name, http.StatusConflict, func() (*compute.Operation, error) {
+		return gce.service.HttpHealthChecks.Insert(gce.projectID, check).Do()
+	})
+	if isHTTPErrorCode(err, http.StatusConflict) {
+		op, err = retryOp(ctx, "update health check "+check.Name, 0, func() (*compute.Operation, error) {
+			return gce.service.HttpHealthChecks.Update(gce.projectID, check.Name, check).Do()
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	if op != nil {
+		if err = gce.waitForGlobalOp(ctx, op); err != nil {
+			return "", err
+		}
+	}
+	link := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/global/httpHealthChecks/%s", gce.projectID, check.Name)
+	return link, nil
+}
+
+// deleteHealthCheck removes the health check created for the named load
+// balancer. It is not an error if there is none, as health checking may not
+// have been enabled when the load balancer was created.
+func (gce *GCECloud) deleteHealthCheck(ctx context.Context, name string) error {
+	op, err := retryOp(ctx, "delete health check "+makeHealthCheckName(name), 0, func() (*compute.Operation, error) {
+		return gce.service.HttpHealthChecks.Delete(gce.projectID, makeHealthCheckName(name)).Do()
+	})
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return gce.waitForGlobalOp(ctx, op)
+}
+
+func makeFirewallName(name string) string {
+	return fmt.Sprintf("k8s-fw-%s", name)
+}
+
+// getInstanceTags returns the union of the network tags of hosts.
+func (gce *GCECloud) getInstanceTags(hosts []string) ([]string, error) {
+	tags := map[string]bool{}
+	for _, host := range hosts {
+		instance, _, err := gce.getInstance(host)
+		if err != nil {
+			return nil, err
+		}
+		if instance.Tags == nil {
+			continue
+		}
+		for _, tag := range instance.Tags.Items {
+			tags[tag] = true
+		}
+	}
+	var result []string
+	for tag := range tags {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ensureFirewall opens ports on the instances carrying the tags of hosts. If
+// none of the hosts are tagged the rule applies to the whole network. An
+// existing rule of the same name is updated in place, so it is safe to call
+// repeatedly.
+func (gce *GCECloud) ensureFirewall(ctx context.Context, name string, ports []int, protocol string, hosts []string) error {
+	tags, err := gce.getInstanceTags(hosts)
+	if err != nil {
+		return err
+	}
+	allowed := make([]string, len(ports))
+	for i, port := range ports {
+		allowed[i] = strconv.Itoa(port)
+	}
+	firewall := &compute.Firewall{
+		Name:         makeFirewallName(name),
+		Description:  fmt.Sprintf("KubernetesAutoGenerated for load balancer %s", name),
+		Network:      fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/global/networks/default", gce.projectID),
+		SourceRanges: []string{"0.0.0.0/0"},
+		TargetTags:   tags,
+		Allowed: []*compute.FirewallAllowed{
+			{
+				IPProtocol: strings.ToLower(protocol),
+				Ports:      allowed,
+			},
+		},
+	}
+	op, err := retryOp(ctx, "create firewall "+firewall.Name, http.StatusConflict, func() (*compute.Operation, error) {
+		return gce.service.Firewalls.Insert(gce.projectID, firewall).Do()
+	})
+	if isHTTPErrorCode(err, http.StatusConflict) {
+		op, err = retryOp(ctx, "update firewall "+firewall.Name, 0, func() (*compute.Operation, error) {
+			return gce.service.Firewalls.Update(gce.projectID, firewall.Name, firewall).Do()
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if op == nil {
+		return nil
+	}
+	return gce.waitForGlobalOp(ctx, op)
+}
+
+// deleteFirewall removes the firewall rule created for the named load
+// balancer. A rule that is already gone is not an error.
+func (gce *GCECloud) deleteFirewall(ctx context.Context, name string) error {
+	op, err := retryOp(ctx, "delete firewall "+makeFirewallName(name), 0, func() (*compute.Operation, error) {
+		return gce.service.Firewalls.Delete(gce.projectID, makeFirewallName(name)).Do()
+	})
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return gce.waitForGlobalOp(ctx, op)
+}
+
+// Polling parameters for waiting on GCE operations. Variables so tests can shorten them.
+var (
+	operationPollInterval    = time.Second
+	operationMaxPollInterval = 10 * time.Second
+	operationTimeout         = 5 * time.Minute
+)
+
+// OperationError is returned when a GCE operation finishes unsuccessfully.
+// It carries the error codes GCE reported, e.g. "QUOTA_EXCEEDED".
+type OperationError struct {
+	Operation string
+	Errors    []*compute.OperationErrorErrors
+}
+
+func (e *OperationError) Error() string {
+	var msgs []string
+	for _, opErr := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", opErr.Code, opErr.Message))
+	}
+	return fmt.Sprintf("operation %s failed: %s", e.Operation, strings.Join(msgs, "; "))
+}
+
+// HasCode returns true if any of the operation's errors has the given code.
+func (e *OperationError) HasCode(code string) bool {
+	for _, opErr := range e.Errors {
+		if opErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForOp polls op with getOperation until it is DONE, backing off
+// exponentially from operationPollInterval up to operationMaxPollInterval.
+// The wait is bounded by ctx: if ctx has no deadline one of operationTimeout
+// is applied. context.DeadlineExceeded is returned as soon as the next poll
+// would land past the deadline, rather than sleeping until it passes. An
+// *OperationError is returned if the operation finished with errors.
+func waitForOp(ctx context.Context, op *compute.Operation, getOperation func(name string) (*compute.Operation, error)) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, operationTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	interval := operationPollInterval
 	pollOp := op
 	for pollOp.Status != "DONE" {
+		if time.Now().Add(interval).After(deadline) {
+			return context.DeadlineExceeded
+		}
+		if err := sleepWithContext(ctx, interval); err != nil {
+			return err
+		}
+		interval *= 2
+		if interval > operationMaxPollInterval {
+			interval = operationMaxPollInterval
+		}
 		var err error
-		time.Sleep(time.Second * 10)
-		pollOp, err = gce.service.RegionOperations.Get(gce.projectID, region, op.Name).Do()
+		pollOp, err = getOperation(op.Name)
 		if err != nil {
 			return err
 		}
 	}
+	if pollOp.Error != nil && len(pollOp.Error.Errors) > 0 {
+		return &OperationError{Operation: op.Name, Errors: pollOp.Error.Errors}
+	}
 	return nil
 }
 
+func (gce *GCECloud) waitForRegionOp(ctx context.Context, op *compute.Operation, region string) error {
+	return waitForOp(ctx, op, func(name string) (*compute.Operation, error) {
+		return gce.service.RegionOperations.Get(gce.projectID, region, name).Do()
+	})
+}
+
+// waitForRegionOpIfAny is waitForRegionOp for an operation retryOp may have
+// found already done, returning nil if op is nil.
+func (gce *GCECloud) waitForRegionOpIfAny(ctx context.Context, op *compute.Operation, region string) error {
+	if op == nil {
+		return nil
+	}
+	return gce.waitForRegionOp(ctx, op, region)
+}
+
+func (gce *GCECloud) waitForZoneOp(ctx context.Context, op *compute.Operation, zone string) error {
+	return waitForOp(ctx, op, func(name string) (*compute.Operation, error) {
+		return gce.service.ZoneOperations.Get(gce.projectID, zone, name).Do()
+	})
+}
+
+func (gce *GCECloud) waitForGlobalOp(ctx context.Context, op *compute.Operation) error {
+	return waitForOp(ctx, op, func(name string) (*compute.Operation, error) {
+		return gce.service.GlobalOperations.Get(gce.projectID, name).Do()
+	})
+}
+
+// isHTTPErrorCode returns true if err is a GCE API error with the given HTTP status code.
+func isHTTPErrorCode(err error, code int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == code
+}
+
+// ErrInstanceNotFound is cloudprovider.ErrInstanceNotFound, returned wrapped
+// by the methods here that look up an instance.
+var ErrInstanceNotFound = cloudprovider.ErrInstanceNotFound
+
+// ErrDiskNotFound is returned, wrapped, by the disk methods when the named
+// disk doesn't exist.
+var ErrDiskNotFound = errors.New("disk not found")
+
+// wrapNotFound returns an error wrapping sentinel, with the given description,
+// if err is a GCE API 404, so callers can tell a resource that is gone from a
+// failure worth retrying. Any other err is returned unchanged.
+func wrapNotFound(err, sentinel error, format string, args ...interface{}) error {
+	if !isHTTPErrorCode(err, http.StatusNotFound) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", sentinel, fmt.Sprintf(format, args...))
+}
+
 // TCPLoadBalancerExists is an implementation of TCPLoadBalancer.TCPLoadBalancerExists.
+// A load balancer exists if its forwarding rule does.
 func (gce *GCECloud) TCPLoadBalancerExists(name, region string) (bool, error) {
-	_, err := gce.service.ForwardingRules.Get(gce.projectID, region, name).Do()
-	return false, err
+	err := retryAPICall(context.Background(), "get forwarding rule "+name, func() error {
+		_, err := gce.service.ForwardingRules.Get(gce.projectID, region, name).Do()
+		return err
+	})
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetTCPLoadBalancer is an implementation of TCPLoadBalancer.GetTCPLoadBalancer.
+// The address is read from the load balancer's forwarding rule.
+func (gce *GCECloud) GetTCPLoadBalancer(name, region string) (net.IP, bool, error) {
+	var rule *compute.ForwardingRule
+	err := retryAPICall(context.Background(), "get forwarding rule "+name, func() (err error) {
+		rule, err = gce.service.ForwardingRules.Get(gce.projectID, region, name).Do()
+		return err
+	})
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	ip, err := parseIP(rule.IPAddress)
+	if err != nil {
+		return nil, true, err
+	}
+	return ip, true, nil
 }
 
 // CreateTCPLoadBalancer is an implementation of TCPLoadBalancer.CreateTCPLoadBalancer.
-func (gce *GCECloud) CreateTCPLoadBalancer(name, region string, port int, hosts []string) error {
-	pool, err := gce.makeTargetPool(name, region, hosts)
+// A deadline on ctx bounds the whole sequence of pool, forwarding rule and
+// firewall changes, not each step separately; steps not yet started when it
+// expires are skipped and context.DeadlineExceeded is returned.
+// The affinity is set on the target pool, where GCE doesn't allow changing it.
+// A non-empty externalIP must be a static address reserved in region.
+// A forwarding rule takes a single port range, so ports must be contiguous;
+// otherwise an error is returned before anything is created.
+func (gce *GCECloud) CreateTCPLoadBalancer(ctx context.Context, name, region, externalIP string, ports []int, protocol string, hosts []string, affinity cloudprovider.SessionAffinity) error {
+	protocol = strings.ToUpper(protocol)
+	if protocol != "TCP" && protocol != "UDP" {
+		return fmt.Errorf("unsupported load balancer protocol: %q", protocol)
+	}
+	portRange, err := makePortRange(ports)
+	if err != nil {
+		return err
+	}
+	if externalIP != "" && net.ParseIP(externalIP) == nil {
+		return fmt.Errorf("invalid load balancer IP address: %q", externalIP)
+	}
+	switch affinity {
+	case "", cloudprovider.SessionAffinityNone, cloudprovider.SessionAffinityClientIP, cloudprovider.SessionAffinityClientIPProto:
+	default:
+		return fmt.Errorf("unsupported session affinity: %q", affinity)
+	}
+	pool, err := gce.makeTargetPool(ctx, name, region, hosts, affinity)
 	if err != nil {
 		return err
 	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 	req := &compute.ForwardingRule{
 		Name:       name,
-		IPProtocol: "TCP",
-		PortRange:  strconv.Itoa(port),
+		IPAddress:  externalIP,
+		IPProtocol: protocol,
+		PortRange:  portRange,
 		Target:     pool,
 	}
-	_, err = gce.service.ForwardingRules.Insert(gce.projectID, region, req).Do()
-	return err
+	op, err := retryOp(ctx, "create forwarding rule "+name, http.StatusConflict, func() (*compute.Operation, error) {
+		return gce.service.ForwardingRules.Insert(gce.projectID, region, req).Do()
+	})
+	if err != nil {
+		return err
+	}
+	if err = gce.waitForRegionOpIfAny(ctx, op, region); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return gce.ensureFirewall(ctx, name, ports, protocol, hosts)
+}
+
+// makePortRange returns the forwarding rule port range of ports, e.g. "80"
+// or "8080-8081", or an error if ports leave a gap a range would cover.
+func makePortRange(ports []int) (string, error) {
+	if len(ports) == 0 {
+		return "", errors.New("no load balancer ports given")
+	}
+	low, high := ports[0], ports[0]
+	given := map[int]bool{}
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return "", fmt.Errorf("invalid load balancer port: %d", port)
+		}
+		if port < low {
+			low = port
+		}
+		if port > high {
+			high = port
+		}
+		given[port] = true
+	}
+	if len(given) != high-low+1 {
+		return "", fmt.Errorf("load balancer ports %v are not contiguous", ports)
+	}
+	if low == high {
+		return strconv.Itoa(low), nil
+	}
+	return fmt.Sprintf("%d-%d", low, high), nil
+}
+
+// InstanceUpdateError reports the hosts whose target pool membership could not
+// be updated. Updates for all other hosts were applied.
+type InstanceUpdateError struct {
+	// Failed maps each host that could not be updated to the error returned for it.
+	Failed map[string]error
+}
+
+// Hosts returns the sorted names of the hosts that failed to update.
+func (e *InstanceUpdateError) Hosts() []string {
+	hosts := make([]string, 0, len(e.Failed))
+	for host := range e.Failed {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (e *InstanceUpdateError) Error() string {
+	var msgs []string
+	for _, host := range e.Hosts() {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", host, e.Failed[host]))
+	}
+	return fmt.Sprintf("failed to update %d target pool instance(s): %s", len(e.Failed), strings.Join(msgs, "; "))
 }
 
 // UpdateTCPLoadBalancer is an implementation of TCPLoadBalancer.UpdateTCPLoadBalancer.
-func (gce *GCECloud) UpdateTCPLoadBalancer(name, region string, hosts []string) error {
-	var refs []*compute.InstanceReference
+// The target pool is changed to hold exactly hosts: hosts missing from it are
+// added and instances no longer among hosts are removed, so nodes that left
+// the cluster stop receiving traffic. Every change is attempted even if some
+// fail; failures are reported together as an *InstanceUpdateError so the
+// caller can retry just those hosts. If ctx is cancelled the remaining
+// changes are skipped and ctx.Err() is returned.
+func (gce *GCECloud) UpdateTCPLoadBalancer(ctx context.Context, name, region string, hosts []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var pool *compute.TargetPool
+	err := retryAPICall(ctx, "get target pool "+name, func() (err error) {
+		pool, err = gce.service.TargetPools.Get(gce.projectID, region, name).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// Members are keyed by zone and instance name, as links may differ in form.
+	members := map[string]string{}
+	for _, link := range pool.Instances {
+		members[instanceLinkKey(link)] = link
+	}
+	failed := map[string]error{}
+	// Instances whose zone couldn't be found aren't known to be gone, so
+	// they are left in the pool.
+	unknown := map[string]bool{}
 	for _, host := range hosts {
-		refs = append(refs, &compute.InstanceReference{host})
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		zone, err := gce.GetInstanceZone(host)
+		if err != nil {
+			failed[host] = err
+			unknown[instanceName(host)] = true
+			continue
+		}
+		link := makeHostLink(gce.projectID, zone, host)
+		key := instanceLinkKey(link)
+		if _, found := members[key]; found {
+			delete(members, key)
+			continue
+		}
+		req := &compute.TargetPoolsAddInstanceRequest{
+			Instances: []*compute.InstanceReference{{Instance: link}},
+		}
+		op, err := retryOp(ctx, "add "+host+" to target pool "+name, 0, func() (*compute.Operation, error) {
+			return gce.service.TargetPools.AddInstance(gce.projectID, region, name, req).Do()
+		})
+		if err == nil {
+			err = gce.waitForRegionOp(ctx, op, region)
+		}
+		if err != nil {
+			failed[host] = err
+		}
+	}
+	var departed []string
+	for key := range members {
+		departed = append(departed, key)
+	}
+	sort.Strings(departed)
+	for _, key := range departed {
+		link := members[key]
+		instance := path.Base(link)
+		if unknown[instance] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		req := &compute.TargetPoolsRemoveInstanceRequest{
+			Instances: []*compute.InstanceReference{{Instance: link}},
+		}
+		op, err := retryOp(ctx, "remove "+instance+" from target pool "+name, 0, func() (*compute.Operation, error) {
+			return gce.service.TargetPools.RemoveInstance(gce.projectID, region, name, req).Do()
+		})
+		if err == nil {
+			err = gce.waitForRegionOp(ctx, op, region)
+		}
+		if err != nil {
+			failed[instance] = err
+		}
 	}
-	req := &compute.TargetPoolsAddInstanceRequest{
-		Instances: refs,
+	if len(failed) > 0 {
+		return &InstanceUpdateError{Failed: failed}
 	}
+	return nil
+}
 
-	_, err := gce.service.TargetPools.AddInstance(gce.projectID, region, name, req).Do()
-	return err
+// instanceLinkKey returns the zone and name of the instance a link refers
+// to, e.g. "us-central1-b/my-instance" for .../zones/us-central1-b/instances/my-instance.
+func instanceLinkKey(link string) string {
+	return path.Base(path.Dir(path.Dir(link))) + "/" + path.Base(link)
 }
 
 // DeleteTCPLoadBalancer is an implementation of TCPLoadBalancer.DeleteTCPLoadBalancer.
-func (gce *GCECloud) DeleteTCPLoadBalancer(name, region string) error {
-	_, err := gce.service.ForwardingRules.Delete(gce.projectID, region, name).Do()
+// If ctx is cancelled the remaining steps are skipped and ctx.Err() is
+// returned; deleting again later finishes the job, as parts already deleted
+// are skipped.
+func (gce *GCECloud) DeleteTCPLoadBalancer(ctx context.Context, name, region string) error {
+	op, err := retryOp(ctx, "delete forwarding rule "+name, 0, func() (*compute.Operation, error) {
+		return gce.service.ForwardingRules.Delete(gce.projectID, region, name).Do()
+	})
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		op, err = nil, nil
+	}
 	if err != nil {
 		return err
 	}
-	_, err = gce.service.TargetPools.Delete(gce.projectID, region, name).Do()
-	return err
+	// The target pool can't be deleted while the forwarding rule still uses it.
+	if err = gce.waitForRegionOpIfAny(ctx, op, region); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	op, err = retryOp(ctx, "delete target pool "+name, 0, func() (*compute.Operation, error) {
+		return gce.service.TargetPools.Delete(gce.projectID, region, name).Do()
+	})
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		op, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	// Likewise the health check can't be deleted while the pool uses it.
+	if err = gce.waitForRegionOpIfAny(ctx, op, region); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = gce.deleteHealthCheck(ctx, name); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return gce.deleteFirewall(ctx, name)
 }
 
 // IPAddress is an implementation of Instances.IPAddress.
+// The external IP of the instance's first network interface is returned, or
+// its internal IP if it has no external one, as in clusters without public IPs.
 func (gce *GCECloud) IPAddress(instance string) (net.IP, error) {
-	res, err := gce.service.Instances.Get(gce.projectID, gce.zone, instance).Do()
+	iface, err := gce.getNetworkInterface(instance)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range iface.AccessConfigs {
+		if config.NatIP != "" {
+			return parseIP(config.NatIP)
+		}
+	}
+	glog.V(2).Infof("Instance %s has no external IP, using its internal IP", instance)
+	return parseIP(iface.NetworkIP)
+}
+
+// InternalIPAddress returns the internal IP of the instance's first network
+// interface, even if it also has an external IP.
+func (gce *GCECloud) InternalIPAddress(instance string) (net.IP, error) {
+	iface, err := gce.getNetworkInterface(instance)
+	if err != nil {
+		return nil, err
+	}
+	return parseIP(iface.NetworkIP)
+}
+
+// ExternalID is an implementation of Instances.ExternalID. It returns the
+// numeric ID GCE assigned the instance, which unlike its name isn't reused
+// when the instance is deleted and another created in its place.
+func (gce *GCECloud) ExternalID(instance string) (string, error) {
+	res, _, err := gce.getInstance(instance)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(res.Id, 10), nil
+}
+
+func (gce *GCECloud) getNetworkInterface(instance string) (*compute.NetworkInterface, error) {
+	res, _, err := gce.getInstance(instance)
 	if err != nil {
 		return nil, err
 	}
-	ip := net.ParseIP(res.NetworkInterfaces[0].AccessConfigs[0].NatIP)
+	if len(res.NetworkInterfaces) == 0 || res.NetworkInterfaces[0] == nil {
+		return nil, fmt.Errorf("instance %s has no network interfaces", instance)
+	}
+	return res.NetworkInterfaces[0], nil
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
 	if ip == nil {
-		return nil, fmt.Errorf("Invalid network IP: %s", res.NetworkInterfaces[0].AccessConfigs[0].NatIP)
+		return nil, fmt.Errorf("Invalid network IP: %s", s)
 	}
 	return ip, nil
 }
 
-// This is hacky, compute the delta between hostame and hostname -f
+// Host name lookups used by fqdnSuffix. Variables so tests can replace them.
+var (
+	osHostname  = os.Hostname
+	lookupCNAME = net.LookupCNAME
+)
+
+// fqdnSuffix returns the domain of the host, the part of its fully qualified
+// name after the host name, in lower case. An unqualified host name is
+// resolved, with the resolver's search domains, to find its canonical name.
 func fqdnSuffix() (string, error) {
-	fullHostname, err := exec.Command("hostname", "-f").Output()
+	hostname, err := osHostname()
 	if err != nil {
 		return "", err
 	}
-	hostname, err := exec.Command("hostname").Output()
+	hostname = strings.ToLower(hostname)
+	if parts := strings.SplitN(hostname, ".", 2); len(parts) == 2 {
+		return parts[1], nil
+	}
+	cname, err := lookupCNAME(hostname)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve the fully qualified name of %s: %v", hostname, err)
+	}
+	fqdn := strings.TrimSuffix(strings.ToLower(cname), ".")
+	if fqdn == hostname {
+		return "", nil
+	}
+	if !strings.HasPrefix(fqdn, hostname+".") {
+		return "", fmt.Errorf("canonical name %s is not a fully qualified name of %s", fqdn, hostname)
+	}
+	return fqdn[len(hostname)+1:], nil
+}
+
+// nodeNameSuffix returns what is appended to instance names to make node
+// names: the fqdn suffix with a leading dot, or nothing if there is none.
+func (gce *GCECloud) nodeNameSuffix() (string, error) {
+	suffix := gce.fqdnSuffix
+	if suffix == "" {
+		var err error
+		if suffix, err = fqdnSuffix(); err != nil {
+			return "", err
+		}
+	}
+	if len(suffix) > 0 {
+		suffix = "." + suffix
+	}
+	return suffix, nil
+}
+
+// CurrentNodeName is an implementation of cloudprovider.CurrentNodeNamer. The
+// name is the one List gives for this instance.
+func (gce *GCECloud) CurrentNodeName() (string, error) {
+	suffix, err := gce.nodeNameSuffix()
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(string(fullHostname)[len(string(hostname)):]), nil
+	return gce.instanceID + suffix, nil
 }
 
-// List is an implementation of Instances.List.
+// List is an implementation of Instances.List. Only instances with the
+// configured node tags and labels are listed.
 func (gce *GCECloud) List(filter string) ([]string, error) {
 	// GCE gives names without their fqdn suffix, so get that here for appending.
 	// This is needed because the kubelet looks for its jobs in /registry/hosts/<fqdn>/pods
 	// We should really just replace this convention, with a negotiated naming protocol for kubelet's
 	// to register with the master.
-	suffix, err := fqdnSuffix()
+	suffix, err := gce.nodeNameSuffix()
 	if err != nil {
 		return []string{}, err
 	}
-	if len(suffix) > 0 {
-		suffix = "." + suffix
-	}
-	listCall := gce.service.Instances.List(gce.projectID, gce.zone)
-	if len(filter) > 0 {
-		listCall = listCall.Filter("name eq " + filter)
-	}
-	res, err := listCall.Do()
+	names, err := gce.listInstanceNames(filter)
 	if err != nil {
 		return nil, err
 	}
 	var instances []string
-	for _, instance := range res.Items {
-		instances = append(instances, instance.Name+suffix)
+	for _, name := range names {
+		instances = append(instances, name+suffix)
 	}
 	return instances, nil
 }
 
+// listInstanceNames returns the names of the nodes in the zone whose names
+// match filter, following every page of results.
+func (gce *GCECloud) listInstanceNames(filter string) ([]string, error) {
+	var names []string
+	pageToken := ""
+	for {
+		listCall := gce.service.Instances.List(gce.projectID, gce.zone)
+		if expr := makeInstanceFilter(filter, gce.nodeLabels); len(expr) > 0 {
+			listCall = listCall.Filter(expr)
+		}
+		if pageToken != "" {
+			listCall = listCall.PageToken(pageToken)
+		}
+		var res *compute.InstanceList
+		err := retryAPICall(context.Background(), "list instances", func() (err error) {
+			res, err = listCall.Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range res.Items {
+			if hasTags(instance, gce.nodeTags) {
+				names = append(names, instance.Name)
+			}
+		}
+		if res.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = res.NextPageToken
+	}
+}
+
+// makeInstanceFilter returns the filter expression selecting instances whose
+// names match the regular expression nameFilter, if any, and that have every
+// label in labels. Several conditions are each parenthesized, which GCE ANDs.
+func makeInstanceFilter(nameFilter string, labels map[string]string) string {
+	var exprs []string
+	if len(nameFilter) > 0 {
+		exprs = append(exprs, "name eq "+nameFilter)
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		exprs = append(exprs, fmt.Sprintf("labels.%s eq %s", key, regexp.QuoteMeta(labels[key])))
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	for i := range exprs {
+		exprs[i] = "(" + exprs[i] + ")"
+	}
+	return strings.Join(exprs, " ")
+}
+
+// hasTags returns true if instance has every network tag in tags. Tags are
+// a list, which filter expressions can't match, so they are checked here.
+func hasTags(instance *compute.Instance, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		if instance.Tags != nil {
+			for _, item := range instance.Tags.Items {
+				if item == tag {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func (gce *GCECloud) GetZone() (cloudprovider.Zone, error) {
-	region, err := getGceRegion(gce.zone)
+	region, err := gce.GetRegion()
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
@@ -253,6 +1074,22 @@ func (gce *GCECloud) GetZone() (cloudprovider.Zone, error) {
 	}, nil
 }
 
+// GetRegion returns the region of the cluster: the configured region, or
+// else the region of this instance's zone.
+func (gce *GCECloud) GetRegion() (string, error) {
+	if gce.region != "" {
+		return gce.region, nil
+	}
+	return getGceRegion(gce.zone)
+}
+
+// ProjectID returns the project the cluster runs in: the configured
+// project, or else this instance's project. Together with GetZone it is
+// enough to build the URL of any resource of the cluster.
+func (gce *GCECloud) ProjectID() string {
+	return gce.projectID
+}
+
 // gce zone names are of the form: ${region-name}-${ix}.
 // For example "us-central1-b" has a region of "us-central1".
 // So we look for the last '-' and trim to just before that.
@@ -263,3 +1100,262 @@ func getGceRegion(zone string) (string, error) {
 	}
 	return zone[:ix], nil
 }
+
+// ErrDiskAlreadyExists is returned by CreateDisk when a disk with the requested name already exists.
+var ErrDiskAlreadyExists = errors.New("disk already exists")
+
+// Disk types accepted by CreateDisk.
+const (
+	DiskTypeStandard = "pd-standard"
+	DiskTypeSSD      = "pd-ssd"
+)
+
+// CreateDisk creates a disk of sizeGB and diskType in the instance's zone
+// and waits for the creation to complete. An empty diskType means
+// DiskTypeStandard. If the disk already exists, CreateDisk waits for it to be
+// ready and returns ErrDiskAlreadyExists.
+func (gce *GCECloud) CreateDisk(name string, sizeGB int64, diskType string) error {
+	if sizeGB <= 0 {
+		return fmt.Errorf("invalid size for disk %s: %dGB", name, sizeGB)
+	}
+	if diskType == "" {
+		diskType = DiskTypeStandard
+	}
+	if diskType != DiskTypeStandard && diskType != DiskTypeSSD {
+		return fmt.Errorf("unsupported type for disk %s: %q", name, diskType)
+	}
+	disk := &compute.Disk{
+		Name:   name,
+		SizeGb: sizeGB,
+		Type:   fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/zones/%s/diskTypes/%s", gce.projectID, gce.zone, diskType),
+	}
+	var op *compute.Operation
+	err := retryAPICall(context.Background(), "create disk "+name, func() (err error) {
+		op, err = gce.service.Disks.Insert(gce.projectID, gce.zone, disk).Do()
+		return err
+	})
+	if isHTTPErrorCode(err, http.StatusConflict) {
+		// Another caller may still be creating it.
+		if err := gce.waitForDiskReady(name); err != nil {
+			return err
+		}
+		return ErrDiskAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	return gce.waitForZoneOp(context.Background(), op, gce.zone)
+}
+
+// DeleteDisk deletes the named disk in the instance's zone and waits for the
+// deletion to complete. The disk must not be attached to any instance. An
+// error wrapping ErrDiskNotFound is returned if the disk doesn't exist.
+func (gce *GCECloud) DeleteDisk(name string) error {
+	var op *compute.Operation
+	err := retryAPICall(context.Background(), "delete disk "+name, func() (err error) {
+		op, err = gce.service.Disks.Delete(gce.projectID, gce.zone, name).Do()
+		return err
+	})
+	if err != nil {
+		return wrapNotFound(err, ErrDiskNotFound, "%s in zone %s", name, gce.zone)
+	}
+	return gce.waitForZoneOp(context.Background(), op, gce.zone)
+}
+
+// CreateSnapshot snapshots the named disk in the instance's zone and waits for
+// the snapshot to be taken. The disk may be in use; writes that haven't been
+// flushed to it aren't included.
+func (gce *GCECloud) CreateSnapshot(diskName, snapshotName string) error {
+	snapshot := &compute.Snapshot{Name: snapshotName}
+	var op *compute.Operation
+	err := retryAPICall(context.Background(), "snapshot disk "+diskName, func() (err error) {
+		op, err = gce.service.Disks.CreateSnapshot(gce.projectID, gce.zone, diskName, snapshot).Do()
+		return err
+	})
+	if err != nil {
+		return wrapNotFound(err, ErrDiskNotFound, "can't snapshot disk %s: it does not exist in zone %s", diskName, gce.zone)
+	}
+	return gce.waitForZoneOp(context.Background(), op, gce.zone)
+}
+
+// DeleteSnapshot deletes the named snapshot and waits for the deletion to
+// complete.
+func (gce *GCECloud) DeleteSnapshot(name string) error {
+	var op *compute.Operation
+	err := retryAPICall(context.Background(), "delete snapshot "+name, func() (err error) {
+		op, err = gce.service.Snapshots.Delete(gce.projectID, name).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return gce.waitForGlobalOp(context.Background(), op)
+}
+
+func (gce *GCECloud) waitForDiskReady(name string) error {
+	return wait.Poll(operationPollInterval, operationTimeout, func() (bool, error) {
+		disk, err := gce.getDisk(name)
+		if err != nil {
+			return false, err
+		}
+		return disk.Status == "READY", nil
+	})
+}
+
+// getDisk returns the named disk in the instance's zone or, failing that,
+// the regional disk of that name in the instance's region.
+func (gce *GCECloud) getDisk(diskName string) (*compute.Disk, error) {
+	disk := &compute.Disk{}
+	if err := gce.getZonalOrRegionalDisk(diskName, disk); err != nil {
+		return nil, err
+	}
+	return disk, nil
+}
+
+// GetDiskType returns the type of the named disk in the instance's zone, e.g.
+// DiskTypeSSD.
+func (gce *GCECloud) GetDiskType(diskName string) (string, error) {
+	disk, err := gce.getDisk(diskName)
+	if err != nil {
+		return "", err
+	}
+	return diskTypeName(disk.Type), nil
+}
+
+// diskTypeName returns the name of a disk type from its URL.
+func diskTypeName(typeURL string) string {
+	return path.Base(typeURL)
+}
+
+// GetDiskLabels returns the labels of the named disk in the instance's zone
+// or region. The vendored compute client predates disk labels, so the disk is
+// requested directly.
+func (gce *GCECloud) GetDiskLabels(diskName string) (map[string]string, error) {
+	var disk struct {
+		Labels map[string]string `json:"labels"`
+	}
+	if err := gce.getZonalOrRegionalDisk(diskName, &disk); err != nil {
+		return nil, err
+	}
+	return disk.Labels, nil
+}
+
+// convertDiskToAttachedDisk describes disk for attaching. Type is the kind of
+// attachment, which is always PERSISTENT; the disk's own type, as returned by
+// GetDiskType, stays with the disk. A regional disk is attached from its region.
+func (gce *GCECloud) convertDiskToAttachedDisk(disk *compute.Disk, readWrite string) *compute.AttachedDisk {
+	source := "https://" + path.Join("www.googleapis.com/compute/v1/projects/", gce.projectID, "zones", gce.zone, "disks", disk.Name)
+	if region := diskRegion(disk); region != "" {
+		source = "https://" + path.Join("www.googleapis.com/compute/v1/projects/", gce.projectID, "regions", region, "disks", disk.Name)
+	}
+	return &compute.AttachedDisk{
+		DeviceName: disk.Name,
+		Kind:       disk.Kind,
+		Mode:       readWrite,
+		Source:     source,
+		Type:       "PERSISTENT",
+	}
+}
+
+// ErrDiskInUse is returned, wrapped, by AttachDisk when the disk is attached
+// to another instance in a mode that conflicts with the requested one.
+var ErrDiskInUse = errors.New("disk is in use by another instance")
+
+// diskWithUsers is a disk with the links of the instances it is attached to.
+// The vendored compute client predates the users field, so such disks are
+// requested directly.
+type diskWithUsers struct {
+	compute.Disk
+	Users []string `json:"users"`
+}
+
+// checkDiskUsers returns an error wrapping ErrDiskInUse if disk can't be
+// attached to this instance in the requested mode. A disk may be attached
+// read-only to any number of instances, but read-write only to one. attached
+// is true if the disk is already attached to this instance in a mode that
+// serves the request, as after a SetUp that failed once the disk was attached.
+func (gce *GCECloud) checkDiskUsers(disk *diskWithUsers, readOnly bool) (attached bool, err error) {
+	for _, user := range disk.Users {
+		// Links end in .../zones/<zone>/instances/<name>.
+		name, zone := path.Base(user), path.Base(path.Dir(path.Dir(user)))
+		var instance *compute.Instance
+		err := retryAPICall(context.Background(), "get instance "+name, func() (err error) {
+			instance, err = gce.service.Instances.Get(gce.projectID, zone, name).Do()
+			return err
+		})
+		if err != nil {
+			return false, wrapNotFound(err, ErrInstanceNotFound, "%s using disk %s in zone %s", name, disk.Name, zone)
+		}
+		mode := ""
+		for _, attachedDisk := range instance.Disks {
+			if path.Base(attachedDisk.Source) == disk.Name {
+				mode = attachedDisk.Mode
+				break
+			}
+		}
+		if name == gce.instanceID && zone == gce.zone {
+			if mode == "READ_ONLY" && !readOnly {
+				return false, fmt.Errorf("%w: %s can't be attached read-write, it is already attached read-only to this instance", ErrDiskInUse, disk.Name)
+			}
+			attached = true
+			continue
+		}
+		if mode == "READ_WRITE" {
+			return false, fmt.Errorf("%w: %s is already attached read-write to %s", ErrDiskInUse, disk.Name, name)
+		}
+		if !readOnly {
+			return false, fmt.Errorf("%w: %s can't be attached read-write, it is already attached read-only to %s", ErrDiskInUse, disk.Name, name)
+		}
+	}
+	return attached, nil
+}
+
+// AttachDisk attaches the named disk to the instance the kubelet is running on
+// and waits for the attachment to complete. The disk's current attachments
+// are checked first, so a conflicting mode is reported with the instance
+// holding the disk instead of as GCE's generic failure. A disk already
+// attached to this instance in a suitable mode is left as it is, since GCE
+// rejects attaching it again. The disk may be zonal or regional. An error
+// wrapping ErrDiskNotFound is returned if the disk doesn't exist.
+func (gce *GCECloud) AttachDisk(diskName string, readOnly bool) error {
+	disk := &diskWithUsers{}
+	if err := gce.getZonalOrRegionalDisk(diskName, disk); err != nil {
+		return err
+	}
+	attached, err := gce.checkDiskUsers(disk, readOnly)
+	if err != nil {
+		return err
+	}
+	if attached {
+		glog.V(1).Infof("Disk %s is already attached to %s", diskName, gce.instanceID)
+		return nil
+	}
+	readWrite := "READ_WRITE"
+	if readOnly {
+		readWrite = "READ_ONLY"
+	}
+	attachedDisk := gce.convertDiskToAttachedDisk(&disk.Disk, readWrite)
+	var op *compute.Operation
+	err = retryAPICall(context.Background(), "attach disk "+diskName, func() (err error) {
+		op, err = gce.service.Instances.AttachDisk(gce.projectID, gce.zone, gce.instanceID, attachedDisk).Do()
+		return err
+	})
+	if err != nil {
+		return wrapNotFound(err, ErrInstanceNotFound, "%s in zone %s", gce.instanceID, gce.zone)
+	}
+	return gce.waitForZoneOp(context.Background(), op, gce.zone)
+}
+
+// DetachDisk detaches the disk with the given device name from the instance
+// the kubelet is running on and waits for the detachment to complete.
+func (gce *GCECloud) DetachDisk(devicePath string) error {
+	var op *compute.Operation
+	err := retryAPICall(context.Background(), "detach disk "+devicePath, func() (err error) {
+		op, err = gce.service.Instances.DetachDisk(gce.projectID, gce.zone, gce.instanceID, devicePath).Do()
+		return err
+	})
+	if err != nil {
+		return wrapNotFound(err, ErrInstanceNotFound, "%s in zone %s", gce.instanceID, gce.zone)
+	}
+	return gce.waitForZoneOp(context.Background(), op, gce.zone)
+}
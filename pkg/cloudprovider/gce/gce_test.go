@@ -17,9 +17,72 @@ limitations under the License.
 package gce_cloud
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
 )
 
+// newTestGCECloud returns a GCECloud whose API calls are served by handler.
+func newTestGCECloud(t *testing.T, handler http.Handler) (*GCECloud, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	svc, err := compute.New(http.DefaultClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.BasePath = server.URL + "/"
+	return &GCECloud{
+		service:    svc,
+		client:     http.DefaultClient,
+		projectID:  "my-project",
+		zone:       "us-central1-b",
+		instanceID: "my-instance",
+	}, server
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	writeJSON(w, code, map[string]interface{}{"error": map[string]interface{}{"code": code, "message": http.StatusText(code)}})
+}
+
+func writeDoneOp(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &compute.Operation{Name: "op", Status: "DONE"})
+}
+
+// fakeGCE serves requests by "METHOD path", with the path relative to the
+// project, and records every request it receives.
+type fakeGCE struct {
+	t        *testing.T
+	routes   map[string]http.HandlerFunc
+	requests []string
+}
+
+func (f *fakeGCE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/my-project")
+	f.requests = append(f.requests, key)
+	if handler, ok := f.routes[key]; ok {
+		handler(w, r)
+		return
+	}
+	f.t.Errorf("unexpected request: %s", key)
+	writeError(w, http.StatusNotFound)
+}
+
 func TestGetRegion(t *testing.T) {
 	gce := &GCECloud{
 		zone: "us-central1-b",
@@ -35,4 +98,1145 @@ func TestGetRegion(t *testing.T) {
 	if zone.Region != "us-central1" {
 		t.Errorf("Unexpected region: %s", zone.Region)
 	}
+
+	// A configured region wins over the region of the zone.
+	gce.region = "us-east1"
+	if region, err := gce.GetRegion(); err != nil || region != "us-east1" {
+		t.Errorf("expected the configured region, got %q, %v", region, err)
+	}
+	if zone, err = zones.GetZone(); err != nil || zone.Region != "us-east1" || zone.FailureDomain != "us-central1-b" {
+		t.Errorf("unexpected zone: %#v, %v", zone, err)
+	}
+}
+
+func TestUpdateTCPLoadBalancerPartialFailure(t *testing.T) {
+	var added []string
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /regions/us-central1/targetPools/my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.TargetPool{Name: "my-lb"})
+		},
+		"POST /regions/us-central1/targetPools/my-lb/addInstance": func(w http.ResponseWriter, r *http.Request) {
+			var req compute.TargetPoolsAddInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			instance := req.Instances[0].Instance
+			if strings.HasSuffix(instance, "/bad-host") {
+				writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": map[string]interface{}{"code": 400, "message": "bad host"}})
+				return
+			}
+			added = append(added, instance[strings.LastIndex(instance, "/")+1:])
+			writeJSON(w, http.StatusOK, &compute.Operation{Status: "DONE"})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	// The zones are already known, so only target pool requests are made.
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b", "bad-host": "us-central1-b", "host-b": "us-central1-b"}
+
+	err := gce.UpdateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", []string{"host-a", "bad-host", "host-b.example.com"})
+	updateErr, ok := err.(*InstanceUpdateError)
+	if !ok {
+		t.Fatalf("expected an *InstanceUpdateError, got %v", err)
+	}
+	if !reflect.DeepEqual(updateErr.Hosts(), []string{"bad-host"}) {
+		t.Errorf("unexpected failed hosts: %v", updateErr.Hosts())
+	}
+	if !reflect.DeepEqual(added, []string{"host-a", "host-b"}) {
+		t.Errorf("expected the remaining hosts to be added, got %v", added)
+	}
+}
+
+func TestUpdateTCPLoadBalancerDiff(t *testing.T) {
+	link := func(zone, name string) string {
+		return makeHostLink("my-project", zone, name)
+	}
+	var added, removed []string
+	instanceOf := func(r *http.Request) string {
+		var req compute.TargetPoolsAddInstanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return path.Base(req.Instances[0].Instance)
+	}
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /regions/us-central1/targetPools/my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.TargetPool{Name: "my-lb", Instances: []string{
+				link("us-central1-b", "host-a"),
+				link("us-central1-b", "drained"),
+				link("us-central1-c", "deleted"),
+				link("us-central1-b", "unknown"),
+			}})
+		},
+		"POST /regions/us-central1/targetPools/my-lb/addInstance": func(w http.ResponseWriter, r *http.Request) {
+			added = append(added, instanceOf(r))
+			writeDoneOp(w, r)
+		},
+		"POST /regions/us-central1/targetPools/my-lb/removeInstance": func(w http.ResponseWriter, r *http.Request) {
+			removed = append(removed, instanceOf(r))
+			writeDoneOp(w, r)
+		},
+		"GET /zones/us-central1-b/instances/unknown": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusInternalServerError)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b", "host-b": "us-central1-c"}
+
+	err := gce.UpdateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", []string{"host-a", "host-b", "unknown"})
+	updateErr, ok := err.(*InstanceUpdateError)
+	if !ok || !reflect.DeepEqual(updateErr.Hosts(), []string{"unknown"}) {
+		t.Fatalf("expected only the unknown host to fail, got %v", err)
+	}
+	if !reflect.DeepEqual(added, []string{"host-b"}) {
+		t.Errorf("expected only the new host to be added, got %v", added)
+	}
+	// An instance whose zone lookup failed may still be a node, so it stays.
+	if !reflect.DeepEqual(removed, []string{"drained", "deleted"}) {
+		t.Errorf("expected the departed instances to be removed, got %v", removed)
+	}
+}
+
+func TestWaitForRegionOp(t *testing.T) {
+	defer func(interval, max time.Duration) {
+		operationPollInterval, operationMaxPollInterval = interval, max
+	}(operationPollInterval, operationMaxPollInterval)
+	operationPollInterval = time.Millisecond
+	operationMaxPollInterval = 4 * time.Millisecond
+
+	polls := 0
+	gce, server := newTestGCECloud(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/operations/op-done"):
+			status := "RUNNING"
+			if polls >= 3 {
+				status = "DONE"
+			}
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-done", Status: status})
+		case strings.HasSuffix(r.URL.Path, "/operations/op-failed"):
+			writeJSON(w, http.StatusOK, &compute.Operation{
+				Name:   "op-failed",
+				Status: "DONE",
+				Error: &compute.OperationError{Errors: []*compute.OperationErrorErrors{
+					{Code: "QUOTA_EXCEEDED", Message: "Quota 'FORWARDING_RULES' exceeded."},
+				}},
+			})
+		default:
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-stuck", Status: "RUNNING"})
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	if err := gce.waitForRegionOp(ctx, &compute.Operation{Name: "op-done", Status: "PENDING"}, "us-central1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got %d", polls)
+	}
+	err := gce.waitForRegionOp(ctx, &compute.Operation{Name: "op-failed", Status: "PENDING"}, "us-central1")
+	if opErr, ok := err.(*OperationError); !ok || !opErr.HasCode("QUOTA_EXCEEDED") {
+		t.Errorf("expected the operation error to be surfaced, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := gce.waitForRegionOp(ctx, &compute.Operation{Name: "op-stuck", Status: "PENDING"}, "us-central1"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestCreateDiskAlreadyExists(t *testing.T) {
+	defer func(interval time.Duration) { operationPollInterval = interval }(operationPollInterval)
+	operationPollInterval = time.Millisecond
+	gce, server := newTestGCECloud(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/zones/us-central1-b/disks"):
+			writeJSON(w, http.StatusConflict, map[string]interface{}{"error": map[string]interface{}{"code": 409, "message": "already exists"}})
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/zones/us-central1-b/disks/my-pd"):
+			writeJSON(w, http.StatusOK, &compute.Disk{Name: "my-pd", Status: "READY"})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	if err := gce.CreateDisk("my-pd", 10, DiskTypeStandard); err != ErrDiskAlreadyExists {
+		t.Errorf("expected ErrDiskAlreadyExists, got %v", err)
+	}
+}
+
+func TestGetDiskLabels(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"name":   "my-pd",
+				"labels": map[string]string{"io-scheduler": "none"},
+			})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	labels, err := gce.GetDiskLabels("my-pd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(labels, map[string]string{"io-scheduler": "none"}) {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+}
+
+func TestGetDiskType(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Disk{
+				Name: "my-pd",
+				Type: "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/diskTypes/pd-ssd",
+			})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	diskType, err := gce.GetDiskType("my-pd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diskType != DiskTypeSSD {
+		t.Errorf("expected disk type %s, got %s", DiskTypeSSD, diskType)
+	}
+}
+
+func TestCreateAndDeleteDisk(t *testing.T) {
+	var disk compute.Disk
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /zones/us-central1-b/disks": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&disk)
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-create", Status: "DONE"})
+		},
+		"DELETE /zones/us-central1-b/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-delete", Status: "DONE"})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.CreateDisk("my-pd", 100, DiskTypeSSD); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedType := "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/diskTypes/pd-ssd"
+	if disk.Name != "my-pd" || disk.SizeGb != 100 || disk.Type != expectedType {
+		t.Errorf("unexpected disk: %#v", disk)
+	}
+	if err := gce.DeleteDisk("my-pd"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	fake.requests = nil
+	if err := gce.CreateDisk("my-pd", 0, DiskTypeStandard); err == nil {
+		t.Errorf("expected an error for a disk without a size")
+	}
+	if err := gce.CreateDisk("my-pd", 10, "pd-tape"); err == nil {
+		t.Errorf("expected an error for an unknown disk type")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected invalid disks not to be requested, got %v", fake.requests)
+	}
+}
+
+func TestCreateAndDeleteSnapshot(t *testing.T) {
+	var snapshot compute.Snapshot
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /zones/us-central1-b/disks/my-pd/createSnapshot": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&snapshot)
+			writeDoneOp(w, r)
+		},
+		"POST /zones/us-central1-b/disks/missing-pd/createSnapshot": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"DELETE /global/snapshots/my-snapshot": writeDoneOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.CreateSnapshot("my-pd", "my-snapshot"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Name != "my-snapshot" {
+		t.Errorf("unexpected snapshot: %#v", snapshot)
+	}
+	if err := gce.DeleteSnapshot("my-snapshot"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := gce.CreateSnapshot("missing-pd", "other-snapshot")
+	if !errors.Is(err, ErrDiskNotFound) || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected an error for a missing disk, got %v", err)
+	}
+}
+
+func TestTCPLoadBalancerExists(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryInitialBackoff = backoff }(apiRetryInitialBackoff)
+	apiRetryInitialBackoff = time.Millisecond
+	flakyCalls := 0
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /regions/us-central1/forwardingRules/flaky-lb": func(w http.ResponseWriter, r *http.Request) {
+			if flakyCalls++; flakyCalls == 1 {
+				writeError(w, http.StatusServiceUnavailable)
+				return
+			}
+			writeJSON(w, http.StatusOK, &compute.ForwardingRule{Name: "flaky-lb"})
+		},
+		"GET /regions/us-central1/forwardingRules/my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.ForwardingRule{Name: "my-lb"})
+		},
+		"GET /regions/us-central1/forwardingRules/missing-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /regions/us-central1/forwardingRules/broken-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusInternalServerError)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		exists  bool
+		wantErr bool
+	}{
+		{name: "my-lb", exists: true},
+		{name: "flaky-lb", exists: true},
+		{name: "missing-lb"},
+		{name: "broken-lb", wantErr: true},
+	}
+	for _, test := range tests {
+		exists, err := gce.TCPLoadBalancerExists(test.name, "us-central1")
+		if exists != test.exists || (err != nil) != test.wantErr {
+			t.Errorf("%s: expected %v (error %v), got %v, %v", test.name, test.exists, test.wantErr, exists, err)
+		}
+	}
+}
+
+func TestGetTCPLoadBalancer(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /regions/us-central1/forwardingRules/my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.ForwardingRule{Name: "my-lb", IPAddress: "1.2.3.4"})
+		},
+		"GET /regions/us-central1/forwardingRules/missing-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	ip, exists, err := gce.GetTCPLoadBalancer("my-lb", "us-central1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists || !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Errorf("expected my-lb to exist at 1.2.3.4, got %v, %v", exists, ip)
+	}
+	if exists, err := gce.TCPLoadBalancerExists("my-lb", "us-central1"); !exists || err != nil {
+		t.Errorf("expected my-lb to exist, got %v, %v", exists, err)
+	}
+	ip, exists, err = gce.GetTCPLoadBalancer("missing-lb", "us-central1")
+	if exists || ip != nil || err != nil {
+		t.Errorf("expected missing-lb not to exist, got %v, %v, %v", ip, exists, err)
+	}
+}
+
+func TestCreateTCPLoadBalancerOperationError(t *testing.T) {
+	var requests []string
+	gce, server := newTestGCECloud(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path[strings.Index(r.URL.Path, "/regions/"):])
+		// The target pool insert is accepted but the operation fails.
+		writeJSON(w, http.StatusOK, &compute.Operation{
+			Name:   "op-pool",
+			Status: "DONE",
+			Error: &compute.OperationError{Errors: []*compute.OperationErrorErrors{
+				{Code: "QUOTA_EXCEEDED", Message: "Quota 'TARGET_POOLS' exceeded."},
+			}},
+		})
+	}))
+	defer server.Close()
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b"}
+
+	err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, "")
+	if opErr, ok := err.(*OperationError); !ok || !opErr.HasCode("QUOTA_EXCEEDED") {
+		t.Fatalf("expected a QUOTA_EXCEEDED *OperationError, got %v", err)
+	}
+	if !reflect.DeepEqual(requests, []string{"POST /regions/us-central1/targetPools"}) {
+		t.Errorf("expected creation to stop after the failed target pool insert, got %v", requests)
+	}
+}
+
+func TestCreateTCPLoadBalancerDeadline(t *testing.T) {
+	defer func(interval, max time.Duration) {
+		operationPollInterval, operationMaxPollInterval = interval, max
+	}(operationPollInterval, operationMaxPollInterval)
+	operationPollInterval = time.Millisecond
+	operationMaxPollInterval = time.Millisecond
+
+	// The target pool's operation finishes on its second poll, and the
+	// context is cancelled while the forwarding rule's is still running.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	polls := 0
+	runningOp := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: name, Status: "RUNNING"})
+		}
+	}
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools": runningOp("op-pool"),
+		"GET /regions/us-central1/operations/op-pool": func(w http.ResponseWriter, r *http.Request) {
+			polls++
+			status := "RUNNING"
+			if polls >= 2 {
+				status = "DONE"
+			}
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-pool", Status: status})
+		},
+		"POST /regions/us-central1/forwardingRules": runningOp("op-rule"),
+		"GET /regions/us-central1/operations/op-rule": func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-rule", Status: "RUNNING"})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b"}
+
+	err := gce.CreateTCPLoadBalancer(ctx, "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, "")
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	expected := []string{
+		"POST /regions/us-central1/targetPools",
+		"GET /regions/us-central1/operations/op-pool",
+		"GET /regions/us-central1/operations/op-pool",
+		"POST /regions/us-central1/forwardingRules",
+		"GET /regions/us-central1/operations/op-rule",
+	}
+	if !reflect.DeepEqual(fake.requests, expected) {
+		t.Errorf("expected creation to stop waiting on the forwarding rule, got %v", fake.requests)
+	}
+
+	// A poll that would land past the deadline isn't waited for.
+	operationPollInterval = time.Hour
+	operationMaxPollInterval = time.Hour
+	fake.requests = nil
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = gce.CreateTCPLoadBalancer(ctx, "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, "")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if expected := []string{"POST /regions/us-central1/targetPools"}; !reflect.DeepEqual(fake.requests, expected) {
+		t.Errorf("expected creation to give up without polling, got %v", fake.requests)
+	}
+}
+
+func TestTCPLoadBalancerFirewall(t *testing.T) {
+	var firewall compute.Firewall
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools":     writeDoneOp,
+		"POST /regions/us-central1/forwardingRules": writeDoneOp,
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a", Tags: &compute.Tags{Items: []string{"k8s-minion"}}})
+		},
+		"POST /global/firewalls": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusConflict)
+		},
+		"PUT /global/firewalls/k8s-fw-my-lb": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&firewall)
+			writeDoneOp(w, r)
+		},
+		"DELETE /regions/us-central1/forwardingRules/my-lb": writeDoneOp,
+		"DELETE /regions/us-central1/targetPools/my-lb":     writeDoneOp,
+		"DELETE /global/httpHealthChecks/k8s-hc-my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"DELETE /global/firewalls/k8s-fw-my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	// The firewall already exists, so it is updated rather than failing.
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{8080}, "TCP", []string{"host-a"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(firewall.Allowed) != 1 || !reflect.DeepEqual(firewall.Allowed[0].Ports, []string{"8080"}) {
+		t.Errorf("unexpected firewall rules: %#v", firewall.Allowed)
+	}
+	if !reflect.DeepEqual(firewall.TargetTags, []string{"k8s-minion"}) {
+		t.Errorf("unexpected firewall target tags: %v", firewall.TargetTags)
+	}
+	// A firewall that is already gone doesn't fail the delete.
+	if err := gce.DeleteTCPLoadBalancer(context.Background(), "my-lb", "us-central1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDeleteTCPLoadBalancerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		// Shutdown begins while the forwarding rule is deleted; the
+		// target pool must not be touched afterwards.
+		"DELETE /regions/us-central1/forwardingRules/my-lb": func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			writeDoneOp(w, r)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.DeleteTCPLoadBalancer(ctx, "my-lb", "us-central1"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Deleting again finishes the job, though the forwarding rule is gone.
+	fake.routes = map[string]http.HandlerFunc{
+		"DELETE /regions/us-central1/forwardingRules/my-lb": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"DELETE /regions/us-central1/targetPools/my-lb": writeDoneOp,
+		"DELETE /global/httpHealthChecks/k8s-hc-my-lb":  writeDoneOp,
+		"DELETE /global/firewalls/k8s-fw-my-lb":         writeDoneOp,
+	}
+	fake.requests = nil
+	if err := gce.DeleteTCPLoadBalancer(context.Background(), "my-lb", "us-central1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.requests) != 4 {
+		t.Errorf("expected the rest of the load balancer to be deleted, got %v", fake.requests)
+	}
+
+	// Likewise once the target pool is gone too.
+	fake.routes["DELETE /regions/us-central1/targetPools/my-lb"] = func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound)
+	}
+	fake.requests = nil
+	if err := gce.DeleteTCPLoadBalancer(context.Background(), "my-lb", "us-central1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.requests) != 4 {
+		t.Errorf("expected the rest of the load balancer to be deleted, got %v", fake.requests)
+	}
+}
+
+func TestUpdateTCPLoadBalancerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.UpdateTCPLoadBalancer(ctx, "my-lb", "us-central1", []string{"host-a"}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCreateUDPLoadBalancer(t *testing.T) {
+	var rule compute.ForwardingRule
+	var firewall compute.Firewall
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools": writeDoneOp,
+		"POST /regions/us-central1/forwardingRules": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&rule)
+			writeDoneOp(w, r)
+		},
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a"})
+		},
+		"POST /global/firewalls": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&firewall)
+			writeDoneOp(w, r)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{53}, "udp", []string{"host-a"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.IPProtocol != "UDP" || rule.PortRange != "53" {
+		t.Errorf("expected a UDP forwarding rule for port 53, got %#v", rule)
+	}
+	if len(firewall.Allowed) != 1 || firewall.Allowed[0].IPProtocol != "udp" {
+		t.Errorf("expected the firewall to allow udp, got %#v", firewall.Allowed)
+	}
+
+	fake.requests = nil
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{53}, "SCTP", []string{"host-a"}, ""); err == nil {
+		t.Errorf("expected an unsupported protocol to be rejected")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests for an unsupported protocol, got %v", fake.requests)
+	}
+}
+
+func TestCreateTCPLoadBalancerSessionAffinity(t *testing.T) {
+	var pool compute.TargetPool
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&pool)
+			writeDoneOp(w, r)
+		},
+		"POST /regions/us-central1/forwardingRules": writeDoneOp,
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a"})
+		},
+		"POST /global/firewalls": writeDoneOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, cloudprovider.SessionAffinityClientIP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pool.SessionAffinity != "CLIENT_IP" {
+		t.Errorf("expected CLIENT_IP session affinity, got %q", pool.SessionAffinity)
+	}
+
+	fake.requests = nil
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, "STICKY"); err == nil {
+		t.Errorf("expected an unsupported session affinity to be rejected")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests for an unsupported session affinity, got %v", fake.requests)
+	}
+}
+
+func TestCreateTCPLoadBalancerStaticIP(t *testing.T) {
+	var rule compute.ForwardingRule
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools": writeDoneOp,
+		"POST /regions/us-central1/forwardingRules": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&rule)
+			writeDoneOp(w, r)
+		},
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a"})
+		},
+		"POST /global/firewalls": writeDoneOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "1.2.3.4", []int{80}, "TCP", []string{"host-a"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.IPAddress != "1.2.3.4" {
+		t.Errorf("expected the forwarding rule to use 1.2.3.4, got %q", rule.IPAddress)
+	}
+
+	fake.requests = nil
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "not-an-ip", []int{80}, "TCP", []string{"host-a"}, ""); err == nil {
+		t.Errorf("expected an invalid IP address to be rejected")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests for an invalid IP address, got %v", fake.requests)
+	}
+}
+
+func TestCreateTCPLoadBalancerMultiplePorts(t *testing.T) {
+	var rule compute.ForwardingRule
+	var firewall compute.Firewall
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools": writeDoneOp,
+		"POST /regions/us-central1/forwardingRules": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&rule)
+			writeDoneOp(w, r)
+		},
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a"})
+		},
+		"POST /global/firewalls": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&firewall)
+			writeDoneOp(w, r)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{8081, 8080}, "TCP", []string{"host-a"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.PortRange != "8080-8081" {
+		t.Errorf("expected port range 8080-8081, got %q", rule.PortRange)
+	}
+	if len(firewall.Allowed) != 1 || !reflect.DeepEqual(firewall.Allowed[0].Ports, []string{"8081", "8080"}) {
+		t.Errorf("expected the firewall to open 8081 and 8080, got %#v", firewall.Allowed)
+	}
+
+	fake.requests = nil
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{443, 80}, "TCP", []string{"host-a"}, ""); err == nil {
+		t.Errorf("expected non-contiguous ports to be rejected")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests for non-contiguous ports, got %v", fake.requests)
+	}
+}
+
+func TestMakePortRange(t *testing.T) {
+	successCases := map[string][]int{
+		"80":        {80},
+		"8080-8081": {8081, 8080},
+		"53-55":     {53, 55, 54},
+	}
+	for expected, ports := range successCases {
+		portRange, err := makePortRange(ports)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", ports, err)
+		}
+		if portRange != expected {
+			t.Errorf("%v: expected %q, got %q", ports, expected, portRange)
+		}
+	}
+	for _, ports := range [][]int{nil, {0}, {80, 65536}, {443, 80}, {53, 55}} {
+		if _, err := makePortRange(ports); err == nil {
+			t.Errorf("%v: expected an error", ports)
+		}
+	}
+}
+
+func TestTargetPoolHealthCheck(t *testing.T) {
+	var check compute.HttpHealthCheck
+	var pool compute.TargetPool
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /global/httpHealthChecks": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&check)
+			writeDoneOp(w, r)
+		},
+		"POST /regions/us-central1/targetPools": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&pool)
+			writeDoneOp(w, r)
+		},
+		"DELETE /regions/us-central1/forwardingRules/my-lb": writeDoneOp,
+		"DELETE /regions/us-central1/targetPools/my-lb":     writeDoneOp,
+		"DELETE /global/httpHealthChecks/k8s-hc-my-lb":      writeDoneOp,
+		"DELETE /global/firewalls/k8s-fw-my-lb":             writeDoneOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.SetHealthCheck(&HealthCheck{RequestPath: "/healthz", Port: 10249})
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b"}
+
+	if _, err := gce.makeTargetPool(context.Background(), "my-lb", "us-central1", []string{"host-a"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if check.Name != "k8s-hc-my-lb" || check.RequestPath != "/healthz" || check.Port != 10249 {
+		t.Errorf("unexpected health check: %#v", check)
+	}
+	expected := []string{"https://www.googleapis.com/compute/v1/projects/my-project/global/httpHealthChecks/k8s-hc-my-lb"}
+	if !reflect.DeepEqual(pool.HealthChecks, expected) {
+		t.Errorf("expected the target pool to use %v, got %v", expected, pool.HealthChecks)
+	}
+
+	fake.requests = nil
+	if err := gce.DeleteTCPLoadBalancer(context.Background(), "my-lb", "us-central1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = []string{
+		"DELETE /regions/us-central1/forwardingRules/my-lb",
+		"DELETE /regions/us-central1/targetPools/my-lb",
+		"DELETE /global/httpHealthChecks/k8s-hc-my-lb",
+		"DELETE /global/firewalls/k8s-fw-my-lb",
+	}
+	if !reflect.DeepEqual(fake.requests, expected) {
+		t.Errorf("expected the health check to be deleted after the pool, got %v", fake.requests)
+	}
+}
+
+func TestIPAddress(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances/public": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{NetworkInterfaces: []*compute.NetworkInterface{{
+				NetworkIP:     "10.240.0.2",
+				AccessConfigs: []*compute.AccessConfig{{NatIP: "104.154.0.2"}},
+			}}})
+		},
+		"GET /zones/us-central1-b/instances/private": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{NetworkInterfaces: []*compute.NetworkInterface{{
+				NetworkIP: "10.240.0.3",
+			}}})
+		},
+		"GET /zones/us-central1-b/instances/detached": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	table := []struct {
+		instance string
+		external string
+		internal string
+	}{
+		{"public", "104.154.0.2", "10.240.0.2"},
+		{"private", "10.240.0.3", "10.240.0.3"},
+	}
+	for _, item := range table {
+		ip, err := gce.IPAddress(item.instance)
+		if err != nil || ip.String() != item.external {
+			t.Errorf("%s: expected %s, got %v (%v)", item.instance, item.external, ip, err)
+		}
+		ip, err = gce.InternalIPAddress(item.instance)
+		if err != nil || ip.String() != item.internal {
+			t.Errorf("%s: expected internal %s, got %v (%v)", item.instance, item.internal, ip, err)
+		}
+	}
+	if _, err := gce.IPAddress("detached"); err == nil {
+		t.Errorf("expected an error for an instance without network interfaces")
+	}
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryInitialBackoff = backoff }(apiRetryInitialBackoff)
+	apiRetryInitialBackoff = time.Millisecond
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound)
+	}
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/disks/missing-pd":                  notFound,
+		"GET /regions/us-central1/disks/missing-pd":                  notFound,
+		"DELETE /zones/us-central1-b/disks/missing-pd":               notFound,
+		"POST /zones/us-central1-b/instances/my-instance/detachDisk": notFound,
+		"GET /zones/us-central1-b/instances/missing":                 notFound,
+		"GET /aggregated/instances": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.InstanceAggregatedList{})
+		},
+		"GET /zones/us-central1-b/disks/broken-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusInternalServerError)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	diskCalls := map[string]func() error{
+		"AttachDisk": func() error { return gce.AttachDisk("missing-pd", false) },
+		"DeleteDisk": func() error { return gce.DeleteDisk("missing-pd") },
+		"GetDiskType": func() error {
+			_, err := gce.GetDiskType("missing-pd")
+			return err
+		},
+		"GetDiskLabels": func() error {
+			_, err := gce.GetDiskLabels("missing-pd")
+			return err
+		},
+	}
+	for name, call := range diskCalls {
+		if err := call(); !errors.Is(err, ErrDiskNotFound) {
+			t.Errorf("%s: expected ErrDiskNotFound, got %v", name, err)
+		}
+	}
+	if err := gce.DetachDisk("missing-pd"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+	if _, err := gce.IPAddress("missing"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+
+	// Other failures may be transient and are returned as they are.
+	_, err := gce.GetDiskType("broken-pd")
+	if err == nil || errors.Is(err, ErrDiskNotFound) {
+		t.Errorf("expected a server error, got %v", err)
+	}
+	if !isHTTPErrorCode(err, http.StatusInternalServerError) {
+		t.Errorf("expected the API error unchanged, got %#v", err)
+	}
+}
+
+func TestAttachDetachDiskWaitForOperation(t *testing.T) {
+	defer func(interval time.Duration) { operationPollInterval = interval }(operationPollInterval)
+	operationPollInterval = time.Millisecond
+
+	polls := map[string]int{}
+	pollOp := func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		polls[name]++
+		status := "RUNNING"
+		if polls[name] >= 2 {
+			status = "DONE"
+		}
+		writeJSON(w, http.StatusOK, &compute.Operation{Name: name, Status: status})
+	}
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Disk{Name: "my-pd"})
+		},
+		"POST /zones/us-central1-b/instances/my-instance/attachDisk": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-attach", Status: "PENDING"})
+		},
+		"POST /zones/us-central1-b/instances/my-instance/detachDisk": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Operation{Name: "op-detach", Status: "PENDING"})
+		},
+		"GET /zones/us-central1-b/operations/op-attach": pollOp,
+		"GET /zones/us-central1-b/operations/op-detach": pollOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.AttachDisk("my-pd", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls["op-attach"] != 2 {
+		t.Errorf("expected AttachDisk to wait for its operation, got %d polls", polls["op-attach"])
+	}
+	if err := gce.DetachDisk("my-pd"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls["op-detach"] != 2 {
+		t.Errorf("expected DetachDisk to wait for its operation, got %d polls", polls["op-detach"])
+	}
+}
+
+func TestAttachDiskInUse(t *testing.T) {
+	users := map[string][]string{}
+	localMode := ""
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"name": "my-pd", "users": users["my-pd"]})
+		},
+		"GET /zones/us-central1-b/instances/writer": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "writer", Disks: []*compute.AttachedDisk{
+				{Source: "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/disks/my-pd", Mode: "READ_WRITE"},
+			}})
+		},
+		"GET /zones/us-central1-b/instances/reader": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "reader", Disks: []*compute.AttachedDisk{
+				{Source: "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/disks/my-pd", Mode: "READ_ONLY"},
+			}})
+		},
+		"GET /zones/us-central1-b/instances/my-instance": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "my-instance", Disks: []*compute.AttachedDisk{
+				{Source: "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/disks/my-pd", Mode: localMode},
+			}})
+		},
+		"POST /zones/us-central1-b/instances/my-instance/attachDisk": writeDoneOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	link := func(instance string) string {
+		return "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/instances/" + instance
+	}
+
+	tests := []struct {
+		name      string
+		users     []string
+		localMode string
+		readOnly  bool
+		inUse     bool
+		attach    bool
+	}{
+		{name: "unattached", readOnly: false, attach: true},
+		{name: "attached here", users: []string{link("my-instance")}, localMode: "READ_WRITE", readOnly: false},
+		{name: "attached here read-only", users: []string{link("my-instance")}, localMode: "READ_ONLY", readOnly: true},
+		{name: "read-write attached here read-only", users: []string{link("my-instance")}, localMode: "READ_ONLY", readOnly: false, inUse: true},
+		{name: "read-only with readers", users: []string{link("reader")}, readOnly: true, attach: true},
+		{name: "read-write with readers", users: []string{link("reader")}, readOnly: false, inUse: true},
+		{name: "read-only with a writer", users: []string{link("writer")}, readOnly: true, inUse: true},
+		{name: "read-write with a writer", users: []string{link("writer")}, readOnly: false, inUse: true},
+	}
+	for _, test := range tests {
+		users["my-pd"] = test.users
+		localMode = test.localMode
+		fake.requests = nil
+		err := gce.AttachDisk("my-pd", test.readOnly)
+		if test.inUse != errors.Is(err, ErrDiskInUse) {
+			t.Errorf("%s: expected in use %v, got %v", test.name, test.inUse, err)
+		}
+		if !test.inUse && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		attached := len(fake.requests) > 0 && strings.HasSuffix(fake.requests[len(fake.requests)-1], "/attachDisk")
+		if attached != test.attach {
+			t.Errorf("%s: expected attach %v, got requests %v", test.name, test.attach, fake.requests)
+		}
+	}
+	if err := gce.AttachDisk("my-pd", true); err == nil || !strings.Contains(err.Error(), "read-write to writer") {
+		t.Errorf("expected the error to name the writer, got %v", err)
+	}
+}
+
+func TestNewGCECloudConfig(t *testing.T) {
+	var metadataRequests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadataRequests = append(metadataRequests, r.URL.Path)
+		switch r.URL.Path {
+		case "/instance/zone":
+			w.Write([]byte("projects/metadata-project/zones/us-central1-a"))
+		case "/instance/hostname":
+			w.Write([]byte("metadata-instance.c.metadata-project.internal"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { metadataURL = url }(metadataURL)
+	metadataURL = server.URL
+
+	gce, err := NewGCECloud(&Config{ProjectID: "my-project", Zone: "us-central1-b", InstanceID: "my-instance", Client: http.DefaultClient})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gce.projectID != "my-project" || gce.zone != "us-central1-b" || gce.instanceID != "my-instance" {
+		t.Errorf("expected the configured settings, got %s/%s/%s", gce.projectID, gce.zone, gce.instanceID)
+	}
+	if len(metadataRequests) != 0 {
+		t.Errorf("expected a complete config not to use metadata, got %v", metadataRequests)
+	}
+	if gce.ProjectID() != "my-project" {
+		t.Errorf("expected ProjectID() to return the configured project, got %q", gce.ProjectID())
+	}
+
+	gce, err = NewGCECloud(&Config{ProjectID: "my-project", Client: http.DefaultClient})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gce.projectID != "my-project" || gce.zone != "us-central1-a" || gce.instanceID != "metadata-instance" {
+		t.Errorf("expected missing settings to come from metadata, got %s/%s/%s", gce.projectID, gce.zone, gce.instanceID)
+	}
+}
+
+func TestListInstanceNamesPaginates(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("filter") != "name eq node-.*" {
+				t.Errorf("unexpected filter: %q", r.URL.Query().Get("filter"))
+			}
+			switch r.URL.Query().Get("pageToken") {
+			case "":
+				writeJSON(w, http.StatusOK, &compute.InstanceList{
+					Items:         []*compute.Instance{{Name: "node-1"}, {Name: "node-2"}},
+					NextPageToken: "page-2",
+				})
+			case "page-2":
+				writeJSON(w, http.StatusOK, &compute.InstanceList{
+					Items: []*compute.Instance{{Name: "node-3"}},
+				})
+			default:
+				t.Errorf("unexpected page token: %q", r.URL.Query().Get("pageToken"))
+				writeError(w, http.StatusBadRequest)
+			}
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	names, err := gce.listInstanceNames("node-.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"node-1", "node-2", "node-3"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestMakeInstanceFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected string
+	}{
+		{"", nil, ""},
+		{"node-.*", nil, "name eq node-.*"},
+		{"", map[string]string{"cluster": "prod"}, "labels.cluster eq prod"},
+		{"node-.*", map[string]string{"role": "node", "cluster": "prod.1"}, `(name eq node-.*) (labels.cluster eq prod\.1) (labels.role eq node)`},
+	}
+	for _, test := range tests {
+		if actual := makeInstanceFilter(test.name, test.labels); actual != test.expected {
+			t.Errorf("%q, %v: expected %q, got %q", test.name, test.labels, test.expected, actual)
+		}
+	}
+}
+
+func TestListNodesByTagsAndLabels(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances": func(w http.ResponseWriter, r *http.Request) {
+			if filter := r.URL.Query().Get("filter"); filter != "labels.cluster eq prod" {
+				t.Errorf("unexpected filter: %q", filter)
+			}
+			writeJSON(w, http.StatusOK, &compute.InstanceList{Items: []*compute.Instance{
+				{Name: "node-1", Tags: &compute.Tags{Items: []string{"http-server", "k8s-node"}}},
+				{Name: "bastion", Tags: &compute.Tags{Items: []string{"ssh"}}},
+				{Name: "untagged"},
+			}})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.fqdnSuffix = "c.my-project.internal"
+	gce.nodeTags = []string{"k8s-node"}
+	gce.nodeLabels = map[string]string{"cluster": "prod"}
+
+	names, err := gce.List("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"node-1.c.my-project.internal"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestFQDNSuffix(t *testing.T) {
+	defer func(hostname func() (string, error), cname func(string) (string, error)) {
+		osHostname, lookupCNAME = hostname, cname
+	}(osHostname, lookupCNAME)
+
+	tests := []struct {
+		name     string
+		hostname string
+		cname    string
+		cnameErr error
+		expected string
+		wantErr  bool
+	}{
+		{name: "qualified hostname", hostname: "Node-1.C.My-Project.Internal", expected: "c.my-project.internal"},
+		{name: "resolved", hostname: "node-1", cname: "NODE-1.c.my-project.internal.", expected: "c.my-project.internal"},
+		{name: "no domain", hostname: "node-1", cname: "node-1.", expected: ""},
+		{name: "unresolvable", hostname: "node-1", cnameErr: errors.New("no such host"), wantErr: true},
+		{name: "other host", hostname: "node-1", cname: "node-2.c.my-project.internal.", wantErr: true},
+	}
+	for _, test := range tests {
+		osHostname = func() (string, error) { return test.hostname, nil }
+		lookupCNAME = func(host string) (string, error) { return test.cname, test.cnameErr }
+		suffix, err := fqdnSuffix()
+		if test.wantErr != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.wantErr, err)
+		}
+		if suffix != test.expected {
+			t.Errorf("%s: expected suffix %q, got %q", test.name, test.expected, suffix)
+		}
+	}
+}
+
+func TestCurrentNodeName(t *testing.T) {
+	defer func(hostname func() (string, error), cname func(string) (string, error)) {
+		osHostname, lookupCNAME = hostname, cname
+	}(osHostname, lookupCNAME)
+	osHostname = func() (string, error) { return "node-1", nil }
+	lookupCNAME = func(host string) (string, error) { return "node-1.c.my-project.internal.", nil }
+
+	gce := &GCECloud{instanceID: "node-1"}
+	name, err := gce.CurrentNodeName()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "node-1.c.my-project.internal" {
+		t.Errorf("unexpected node name: %s", name)
+	}
+
+	gce.fqdnSuffix = "example.com"
+	if name, err = gce.CurrentNodeName(); err != nil || name != "node-1.example.com" {
+		t.Errorf("expected node-1.example.com, got %q, %v", name, err)
+	}
+
+	var _ cloudprovider.CurrentNodeNamer = gce
 }
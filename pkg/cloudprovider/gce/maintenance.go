@@ -0,0 +1,88 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// The value of the maintenance-event metadata key when no maintenance is scheduled.
+const NoMaintenanceEvent = "NONE"
+
+// maintenanceRetryInterval is how long WatchMaintenanceEvents waits after a
+// failed request before retrying. A variable so tests can shorten it.
+var maintenanceRetryInterval = 5 * time.Second
+
+func maintenanceEventURL() string {
+	return metadataURL + "/instance/maintenance-event"
+}
+
+// MaintenanceEvent returns the maintenance event currently scheduled for this
+// instance, e.g. "MIGRATE_ON_HOST_MAINTENANCE", or NoMaintenanceEvent.
+func MaintenanceEvent() (string, error) {
+	return getMetadata(maintenanceEventURL())
+}
+
+// WatchMaintenanceEvents long-polls the metadata server and calls onEvent
+// each time the instance's maintenance event changes. Failed requests are
+// retried. It blocks until ctx is cancelled and then returns ctx.Err().
+func WatchMaintenanceEvents(ctx context.Context, onEvent func(string)) error {
+	last, etag, err := getMetadataWithContext(ctx, maintenanceEventURL())
+	for err != nil {
+		if err := sleepWithContext(ctx, maintenanceRetryInterval); err != nil {
+			return err
+		}
+		last, etag, err = getMetadataWithContext(ctx, maintenanceEventURL())
+	}
+	for {
+		params := url.Values{}
+		params.Set("wait_for_change", "true")
+		params.Set("last_etag", etag)
+		event, newEtag, err := getMetadataWithContext(ctx, maintenanceEventURL()+"?"+params.Encode())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			glog.Errorf("Failed to watch maintenance events: %v", err)
+			if err := sleepWithContext(ctx, maintenanceRetryInterval); err != nil {
+				return err
+			}
+			continue
+		}
+		etag = newEtag
+		if event != last {
+			last = event
+			onEvent(event)
+		}
+	}
+}
+
+// sleepWithContext sleeps for d, returning ctx.Err() early if ctx is cancelled.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
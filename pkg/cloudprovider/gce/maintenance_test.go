@@ -0,0 +1,82 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatchMaintenanceEvents(t *testing.T) {
+	// Requests are answered with the next event in the sequence: one read by
+	// MaintenanceEvent, the watch's initial read, then a long-poll that
+	// returns when the value changes.
+	events := []string{NoMaintenanceEvent, NoMaintenanceEvent, "MIGRATE_ON_HOST_MAINTENANCE"}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Google-Metadata-Request") != "True" {
+			t.Errorf("missing metadata request header")
+		}
+		if requests >= 2 && r.URL.Query().Get("wait_for_change") != "true" {
+			t.Errorf("expected a long-poll request, got %s", r.URL)
+		}
+		if requests >= len(events) {
+			// Block like the metadata server does until the client gives up.
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf("etag-%d", requests))
+		fmt.Fprint(w, events[requests])
+		requests++
+	}))
+	defer server.Close()
+	defer func(url string) { metadataURL = url }(metadataURL)
+	metadataURL = server.URL
+
+	event, err := MaintenanceEvent()
+	if err != nil || event != NoMaintenanceEvent {
+		t.Fatalf("unexpected event %q, error %v", event, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 1)
+	done := make(chan error)
+	go func() {
+		done <- WatchMaintenanceEvents(ctx, func(event string) { received <- event })
+	}()
+	select {
+	case event := <-received:
+		if event != "MIGRATE_ON_HOST_MAINTENANCE" {
+			t.Errorf("unexpected event: %q", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the maintenance event")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watch did not return after cancellation")
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"sync"
+	"time"
+)
+
+// metadataCache caches values read from the metadata server. Values older
+// than ttl are fetched again; a ttl of zero keeps them for the life of the
+// process, for values such as the project that never change.
+type metadataCache struct {
+	ttl time.Duration
+	// now returns the current time. A field so tests can replace it.
+	now func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]metadataEntry
+}
+
+type metadataEntry struct {
+	value   string
+	fetched time.Time
+}
+
+func newMetadataCache(ttl time.Duration) *metadataCache {
+	return &metadataCache{ttl: ttl, now: time.Now, entries: map[string]metadataEntry{}}
+}
+
+// get returns the value at url, from the cache if it is fresh. Errors are not
+// cached. The lock isn't held while fetching, so concurrent misses may fetch
+// the same value more than once.
+func (c *metadataCache) get(url string) (string, error) {
+	c.lock.Lock()
+	entry, found := c.entries[url]
+	c.lock.Unlock()
+	if found && (c.ttl == 0 || c.now().Sub(entry.fetched) < c.ttl) {
+		return entry.value, nil
+	}
+	value, err := getMetadata(url)
+	if err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	c.entries[url] = metadataEntry{value: value, fetched: c.now()}
+	c.lock.Unlock()
+	return value, nil
+}
+
+// instanceMetadata caches the instance's project, zone and name, which are
+// read each time a GCECloud is created.
+var instanceMetadata = newMetadataCache(0)
+
+// defaultMetadataTTL is how long GCECloud.Metadata caches values by default.
+const defaultMetadataTTL = time.Minute
+
+// Metadata returns the value at path, relative to the metadata server's
+// computeMetadata/v1 root, e.g. "instance/tags". Values are cached for the
+// TTL set in the Config.
+func (gce *GCECloud) Metadata(path string) (string, error) {
+	return gce.metadata.get(metadataURL + "/" + path)
+}
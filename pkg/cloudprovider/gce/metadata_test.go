@@ -0,0 +1,82 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetadataCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, "value-%d", requests)
+	}))
+	defer server.Close()
+	defer func(url string) { metadataURL = url }(metadataURL)
+	metadataURL = server.URL
+
+	now := time.Unix(0, 0)
+	gce := &GCECloud{metadata: newMetadataCache(time.Minute)}
+	gce.metadata.now = func() time.Time { return now }
+
+	for i, test := range []struct {
+		advance  time.Duration
+		expected string
+	}{
+		{0, "value-1"},
+		{30 * time.Second, "value-1"},
+		{30 * time.Second, "value-2"},
+		{59 * time.Second, "value-2"},
+	} {
+		now = now.Add(test.advance)
+		value, err := gce.Metadata("instance/tags")
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if value != test.expected {
+			t.Errorf("%d: expected %q, got %q", i, test.expected, value)
+		}
+	}
+}
+
+func TestGetMetadataTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	defer func(timeout time.Duration) { metadataTimeout = timeout }(metadataTimeout)
+	metadataTimeout = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		_, err := getMetadata(server.URL + "/instance/zone")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected an error from a hung metadata server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("getMetadata did not time out")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"code.google.com/p/google-api-go-client/googleapi"
+	"github.com/golang/glog"
+)
+
+// regionalDisk is the part of a GCE regional disk resource used for
+// failover. The vendored compute client predates regional disks, so they are
+// requested directly.
+type regionalDisk struct {
+	Name         string   `json:"name"`
+	SelfLink     string   `json:"selfLink"`
+	ReplicaZones []string `json:"replicaZones"`
+}
+
+// FailoverRegionalDisk force-attaches the regional disk diskName to this
+// instance in targetZone, taking it away from whichever instance in the other
+// replica zone holds it. It is only safe when that zone has been lost: an
+// instance there that is still running keeps writing to a disk it no longer
+// owns. Callers must decide to fail over explicitly; nothing here does it
+// automatically. targetZone must be this instance's zone and a replica zone
+// of the disk; nothing is attached otherwise.
+func (gce *GCECloud) FailoverRegionalDisk(diskName, targetZone string) error {
+	if targetZone != gce.zone {
+		return fmt.Errorf("can't fail disk %s over to zone %s from instance %s in zone %s", diskName, targetZone, gce.instanceID, gce.zone)
+	}
+	region, err := getGceRegion(targetZone)
+	if err != nil {
+		return err
+	}
+	disk, err := gce.getRegionalDisk(region, diskName)
+	if err != nil {
+		return wrapNotFound(err, ErrDiskNotFound, "disk %s is not a regional disk in %s", diskName, region)
+	}
+	isReplica := false
+	for _, zone := range disk.ReplicaZones {
+		if path.Base(zone) == targetZone {
+			isReplica = true
+			break
+		}
+	}
+	if !isReplica {
+		return fmt.Errorf("zone %s is not a replica zone of disk %s: %v", targetZone, diskName, disk.ReplicaZones)
+	}
+
+	glog.Warningf("Forcing failover of regional disk %s to instance %s in zone %s", diskName, gce.instanceID, targetZone)
+	attachedDisk := &compute.AttachedDisk{
+		DeviceName: diskName,
+		Kind:       "compute#attachedDisk",
+		Mode:       "READ_WRITE",
+		Source:     disk.SelfLink,
+		Type:       "PERSISTENT",
+	}
+	op := &compute.Operation{}
+	url := fmt.Sprintf("%s%s/zones/%s/instances/%s/attachDisk?forceAttach=true", gce.service.BasePath, gce.projectID, targetZone, gce.instanceID)
+	err = retryAPICall(context.Background(), "force attach disk "+diskName, func() error {
+		return gce.doJSON("POST", url, attachedDisk, op)
+	})
+	if err != nil {
+		return err
+	}
+	if err := gce.waitForZoneOp(context.Background(), op, targetZone); err != nil {
+		return err
+	}
+	glog.Warningf("Regional disk %s failed over to zone %s", diskName, targetZone)
+	return nil
+}
+
+// getZonalOrRegionalDisk decodes the named disk in the instance's zone into
+// result or, if there is no such disk, the regional disk of that name in the
+// instance's region. Regional disks live in a region, not a zone, so a zonal
+// lookup never finds them.
+func (gce *GCECloud) getZonalOrRegionalDisk(diskName string, result interface{}) error {
+	url := fmt.Sprintf("%s%s/zones/%s/disks/%s", gce.service.BasePath, gce.projectID, gce.zone, diskName)
+	err := retryAPICall(context.Background(), "get disk "+diskName, func() error {
+		return gce.doJSON("GET", url, nil, result)
+	})
+	if !isHTTPErrorCode(err, http.StatusNotFound) {
+		return err
+	}
+	region, err := getGceRegion(gce.zone)
+	if err != nil {
+		return err
+	}
+	url = fmt.Sprintf("%s%s/regions/%s/disks/%s", gce.service.BasePath, gce.projectID, region, diskName)
+	err = retryAPICall(context.Background(), "get regional disk "+diskName, func() error {
+		return gce.doJSON("GET", url, nil, result)
+	})
+	if err != nil {
+		return wrapNotFound(err, ErrDiskNotFound, "%s in zone %s or region %s", diskName, gce.zone, region)
+	}
+	return nil
+}
+
+// diskRegion returns the region of disk if it is a regional disk, or "" if
+// it is zonal. Regional disk links end in .../regions/<region>/disks/<name>.
+func diskRegion(disk *compute.Disk) string {
+	scope := path.Dir(path.Dir(disk.SelfLink))
+	if path.Base(path.Dir(scope)) != "regions" {
+		return ""
+	}
+	return path.Base(scope)
+}
+
+func (gce *GCECloud) getRegionalDisk(region, diskName string) (*regionalDisk, error) {
+	disk := &regionalDisk{}
+	url := fmt.Sprintf("%s%s/regions/%s/disks/%s", gce.service.BasePath, gce.projectID, region, diskName)
+	err := retryAPICall(context.Background(), "get regional disk "+diskName, func() error {
+		return gce.doJSON("GET", url, nil, disk)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return disk, nil
+}
+
+// doJSON sends body, if any, as JSON to url and decodes the response into
+// result. API errors are returned as *googleapi.Error, as the generated
+// client does.
+func (gce *GCECloud) doJSON(method, url string, body, result interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := gce.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
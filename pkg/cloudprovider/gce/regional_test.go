@@ -0,0 +1,137 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+)
+
+func TestFailoverRegionalDisk(t *testing.T) {
+	var attached compute.AttachedDisk
+	var forceAttach string
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /regions/us-central1/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &regionalDisk{
+				Name:     "my-pd",
+				SelfLink: "https://www.googleapis.com/compute/v1/projects/my-project/regions/us-central1/disks/my-pd",
+				ReplicaZones: []string{
+					"https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-a",
+					"https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b",
+				},
+			})
+		},
+		"GET /regions/us-central1/disks/zonal-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"POST /zones/us-central1-b/instances/my-instance/attachDisk": func(w http.ResponseWriter, r *http.Request) {
+			forceAttach = r.URL.Query().Get("forceAttach")
+			json.NewDecoder(r.Body).Decode(&attached)
+			writeDoneOp(w, r)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.FailoverRegionalDisk("my-pd", "us-central1-b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if forceAttach != "true" {
+		t.Errorf("expected the disk to be force-attached, got forceAttach=%q", forceAttach)
+	}
+	expected := "https://www.googleapis.com/compute/v1/projects/my-project/regions/us-central1/disks/my-pd"
+	if attached.Source != expected || attached.Mode != "READ_WRITE" || attached.DeviceName != "my-pd" {
+		t.Errorf("unexpected attached disk: %#v", attached)
+	}
+
+	fake.requests = nil
+	if err := gce.FailoverRegionalDisk("my-pd", "us-central1-a"); err == nil {
+		t.Errorf("expected an error failing over to a zone other than the instance's")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests failing over to another zone, got %v", fake.requests)
+	}
+	gce.zone = "us-central1-f"
+	if err := gce.FailoverRegionalDisk("my-pd", "us-central1-f"); err == nil {
+		t.Errorf("expected an error failing over to a zone that isn't a replica")
+	}
+	gce.zone = "us-central1-b"
+	if err := gce.FailoverRegionalDisk("zonal-pd", "us-central1-b"); err == nil {
+		t.Errorf("expected an error failing over a disk that isn't regional")
+	}
+	for _, req := range fake.requests {
+		if strings.HasSuffix(req, "/attachDisk") {
+			t.Errorf("expected no attach for an invalid failover")
+		}
+	}
+}
+
+func TestAttachRegionalDisk(t *testing.T) {
+	var attached compute.AttachedDisk
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /regions/us-central1/disks/my-pd": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"name":     "my-pd",
+				"selfLink": "https://www.googleapis.com/compute/v1/projects/my-project/regions/us-central1/disks/my-pd",
+				"type":     "https://www.googleapis.com/compute/v1/projects/my-project/regions/us-central1/diskTypes/pd-ssd",
+				"labels":   map[string]string{"app": "db"},
+			})
+		},
+		"POST /zones/us-central1-b/instances/my-instance/attachDisk": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&attached)
+			writeDoneOp(w, r)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if err := gce.AttachDisk("my-pd", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "https://www.googleapis.com/compute/v1/projects/my-project/regions/us-central1/disks/my-pd"
+	if attached.Source != expected || attached.Mode != "READ_WRITE" {
+		t.Errorf("unexpected attached disk: %#v", attached)
+	}
+	diskType, err := gce.GetDiskType("my-pd")
+	if err != nil || diskType != DiskTypeSSD {
+		t.Errorf("expected %s, got %q (%v)", DiskTypeSSD, diskType, err)
+	}
+	labels, err := gce.GetDiskLabels("my-pd")
+	if err != nil || labels["app"] != "db" {
+		t.Errorf("expected the regional disk's labels, got %v (%v)", labels, err)
+	}
+}
+
+func TestDiskRegion(t *testing.T) {
+	tests := map[string]string{
+		"https://www.googleapis.com/compute/v1/projects/my-project/regions/us-central1/disks/my-pd": "us-central1",
+		"https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/disks/my-pd": "",
+		"": "",
+	}
+	for link, expected := range tests {
+		if region := diskRegion(&compute.Disk{SelfLink: link}); region != expected {
+			t.Errorf("%q: expected %q, got %q", link, expected, region)
+		}
+	}
+}
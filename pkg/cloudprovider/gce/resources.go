@@ -0,0 +1,67 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"path"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+)
+
+var _ cloudprovider.NodeResourcesGetter = &GCECloud{}
+
+// GetNodeResources is an implementation of
+// cloudprovider.NodeResourcesGetter.GetNodeResources. The capacity is that of
+// the instance's machine type.
+func (gce *GCECloud) GetNodeResources(name string) (*cloudprovider.NodeResources, error) {
+	instance, zone, err := gce.getInstance(name)
+	if err != nil {
+		return nil, err
+	}
+	machineType, err := gce.getMachineType(zone, path.Base(instance.MachineType))
+	if err != nil {
+		return nil, err
+	}
+	return &cloudprovider.NodeResources{
+		CPUs:        machineType.GuestCpus,
+		MemoryBytes: machineType.MemoryMb * 1024 * 1024,
+	}, nil
+}
+
+// getMachineType returns the named machine type in zone, fetching it only the
+// first time it is asked for.
+func (gce *GCECloud) getMachineType(zone, name string) (*compute.MachineType, error) {
+	key := zone + "/" + name
+	gce.machineTypeLock.Lock()
+	machineType, found := gce.machineTypes[key]
+	gce.machineTypeLock.Unlock()
+	if found {
+		return machineType, nil
+	}
+	machineType, err := gce.service.MachineTypes.Get(gce.projectID, zone, name).Do()
+	if err != nil {
+		return nil, err
+	}
+	gce.machineTypeLock.Lock()
+	if gce.machineTypes == nil {
+		gce.machineTypes = map[string]*compute.MachineType{}
+	}
+	gce.machineTypes[key] = machineType
+	gce.machineTypeLock.Unlock()
+	return machineType, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+)
+
+func TestGetNodeResources(t *testing.T) {
+	machineTypeURL := "https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/machineTypes/n1-standard-2"
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a", MachineType: machineTypeURL})
+		},
+		"GET /zones/us-central1-b/instances/host-b": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-b", MachineType: machineTypeURL})
+		},
+		"GET /zones/us-central1-b/machineTypes/n1-standard-2": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.MachineType{Name: "n1-standard-2", GuestCpus: 2, MemoryMb: 7680})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	expected := &cloudprovider.NodeResources{CPUs: 2, MemoryBytes: 7680 * 1024 * 1024}
+	for _, host := range []string{"host-a", "host-b"} {
+		resources, err := gce.GetNodeResources(host)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", host, err)
+		}
+		if !reflect.DeepEqual(resources, expected) {
+			t.Errorf("%s: expected %+v, got %+v", host, expected, resources)
+		}
+	}
+
+	// The machine type is only fetched once.
+	machineTypeRequests := 0
+	for _, request := range fake.requests {
+		if request == "GET /zones/us-central1-b/machineTypes/n1-standard-2" {
+			machineTypeRequests++
+		}
+	}
+	if machineTypeRequests != 1 {
+		t.Errorf("expected the machine type to be fetched once, got %v", fake.requests)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"code.google.com/p/google-api-go-client/googleapi"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/wait"
+	"github.com/golang/glog"
+)
+
+// Backoff parameters for retrying GCE API calls. Variables so tests can
+// shorten them.
+var (
+	apiRetryInitialBackoff = time.Second
+	apiRetryMaxBackoff     = 30 * time.Second
+	apiRetries             = 5
+)
+
+// rateLimitReasons are the reasons GCE gives for a 403 that only means the
+// project is making requests too fast. Other 403s, such as quotaExceeded,
+// won't go away by waiting.
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+}
+
+// isRetryableError returns true if err is a GCE API error that may succeed
+// if the call is made again: rate limiting, or a server error.
+func isRetryableError(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests, apiErr.Code >= 500:
+		return true
+	case apiErr.Code == http.StatusForbidden:
+		for _, item := range apiErr.Errors {
+			if rateLimitReasons[item.Reason] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryAPICall makes call, and makes it again up to apiRetries times while
+// it fails with a retryable error. Retries back off exponentially, with
+// jitter so callers limited together don't retry together, from
+// apiRetryInitialBackoff up to apiRetryMaxBackoff. Other errors are returned
+// at once, as is the last error once the retries or ctx run out.
+func retryAPICall(ctx context.Context, desc string, call func() error) error {
+	backoff := apiRetryInitialBackoff
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= apiRetries || !isRetryableError(err) {
+			return err
+		}
+		delay := wait.Jitter(backoff, 0.5)
+		glog.V(1).Infof("GCE API call to %s failed, retrying in %v: %v", desc, delay, err)
+		if sleepErr := sleepWithContext(ctx, delay); sleepErr != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > apiRetryMaxBackoff {
+			backoff = apiRetryMaxBackoff
+		}
+	}
+}
+
+// retryOp makes call, which starts an operation, with retryAPICall. An
+// attempt whose response was lost may still have made the change, so a retry
+// failing with doneCode, such as a conflict for an insert or not found for a
+// delete, means the change is made and nil is returned for both the
+// operation and the error. A doneCode of 0 means no such code.
+func retryOp(ctx context.Context, desc string, doneCode int, call func() (*compute.Operation, error)) (*compute.Operation, error) {
+	var op *compute.Operation
+	attempts := 0
+	err := retryAPICall(ctx, desc, func() (err error) {
+		attempts++
+		op, err = call()
+		return err
+	})
+	if attempts > 1 && doneCode != 0 && isHTTPErrorCode(err, doneCode) {
+		glog.V(1).Infof("GCE API call to %s was made by an earlier attempt: %v", desc, err)
+		return nil, nil
+	}
+	return op, err
+}
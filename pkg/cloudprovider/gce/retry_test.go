@@ -0,0 +1,199 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"code.google.com/p/google-api-go-client/googleapi"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"rate limited", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, true},
+		{"user rate limited", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true},
+		{"too many requests", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"server error", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"quota exceeded", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, false},
+		{"forbidden", &googleapi.Error{Code: http.StatusForbidden}, false},
+		{"not found", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"not an API error", errors.New("connection refused"), false},
+	}
+	for _, test := range tests {
+		if retryable := isRetryableError(test.err); retryable != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, retryable)
+		}
+	}
+}
+
+func TestRetryAPICall(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryInitialBackoff = backoff }(apiRetryInitialBackoff)
+	apiRetryInitialBackoff = time.Millisecond
+
+	rateLimited := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+	notFound := &googleapi.Error{Code: http.StatusNotFound}
+	tests := []struct {
+		name     string
+		errs     []error
+		expected error
+		calls    int
+	}{
+		{name: "success", calls: 1},
+		{name: "rate limited once", errs: []error{rateLimited}, calls: 2},
+		{name: "not found", errs: []error{notFound}, expected: notFound, calls: 1},
+		{name: "always rate limited", errs: []error{rateLimited, rateLimited, rateLimited, rateLimited, rateLimited, rateLimited, rateLimited}, expected: rateLimited, calls: apiRetries + 1},
+	}
+	for _, test := range tests {
+		calls := 0
+		err := retryAPICall(context.Background(), test.name, func() error {
+			calls++
+			if calls <= len(test.errs) {
+				return test.errs[calls-1]
+			}
+			return nil
+		})
+		if err != test.expected || calls != test.calls {
+			t.Errorf("%s: expected %v after %d calls, got %v after %d", test.name, test.expected, test.calls, err, calls)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := retryAPICall(ctx, "canceled", func() error {
+		calls++
+		return rateLimited
+	})
+	if err != rateLimited || calls != 1 {
+		t.Errorf("expected a canceled context to stop retrying, got %v after %d calls", err, calls)
+	}
+}
+
+func TestListRetriesRateLimit(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryInitialBackoff = backoff }(apiRetryInitialBackoff)
+	apiRetryInitialBackoff = time.Millisecond
+
+	lists := 0
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances": func(w http.ResponseWriter, r *http.Request) {
+			lists++
+			if lists == 1 {
+				writeJSON(w, http.StatusForbidden, map[string]interface{}{"error": map[string]interface{}{
+					"code":    http.StatusForbidden,
+					"message": "Rate Limit Exceeded",
+					"errors":  []map[string]string{{"reason": "rateLimitExceeded"}},
+				}})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"items": []map[string]string{{"name": "node-1"}}})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	names, err := gce.listInstanceNames("")
+	if err != nil || len(names) != 1 || names[0] != "node-1" {
+		t.Errorf("expected [node-1] once the rate limit passed, got %v (%v)", names, err)
+	}
+	if lists != 2 {
+		t.Errorf("expected the list to be retried once, got %d requests", lists)
+	}
+}
+
+func TestCreateTCPLoadBalancerRetriedInsertConflict(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryInitialBackoff = backoff }(apiRetryInitialBackoff)
+	apiRetryInitialBackoff = time.Millisecond
+
+	// Each insert's first response is lost to a server error although the
+	// resource was created, so its retry conflicts.
+	inserted := map[string]bool{}
+	insert := func(w http.ResponseWriter, r *http.Request) {
+		if inserted[r.URL.Path] {
+			writeError(w, http.StatusConflict)
+			return
+		}
+		inserted[r.URL.Path] = true
+		writeError(w, http.StatusServiceUnavailable)
+	}
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools":     insert,
+		"POST /regions/us-central1/forwardingRules": insert,
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a"})
+		},
+		"POST /global/firewalls": writeDoneOp,
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b"}
+
+	if err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A conflict on the first attempt is a load balancer that already
+	// exists, and still fails.
+	fake.routes["POST /regions/us-central1/targetPools"] = func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusConflict)
+	}
+	err := gce.CreateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", "", []int{80}, "TCP", []string{"host-a"}, "")
+	if !isHTTPErrorCode(err, http.StatusConflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+}
+
+func TestUpdateTCPLoadBalancerRetriesRateLimit(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryInitialBackoff = backoff }(apiRetryInitialBackoff)
+	apiRetryInitialBackoff = time.Millisecond
+
+	calls := map[string]int{}
+	rateLimitedOnce := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			calls[r.Method+" "+r.URL.Path]++
+			if calls[r.Method+" "+r.URL.Path] == 1 {
+				writeError(w, http.StatusTooManyRequests)
+				return
+			}
+			next(w, r)
+		}
+	}
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /regions/us-central1/targetPools/my-lb": rateLimitedOnce(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.TargetPool{Name: "my-lb"})
+		}),
+		"POST /regions/us-central1/targetPools/my-lb/addInstance": rateLimitedOnce(writeDoneOp),
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.instanceZones = map[string]string{"host-a": "us-central1-b"}
+
+	if err := gce.UpdateTCPLoadBalancer(context.Background(), "my-lb", "us-central1", []string{"host-a"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.requests) != 4 {
+		t.Errorf("expected the get and the add to be retried once each, got %v", fake.requests)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+)
+
+// instanceName returns the GCE instance name of host, which may be a fully
+// qualified domain name.
+func instanceName(host string) string {
+	if ix := strings.Index(host, "."); ix != -1 {
+		return host[:ix]
+	}
+	return host
+}
+
+// GetInstanceZone returns the zone of the named instance, which need not be
+// in the zone of this instance. Zones are cached, since an instance can't
+// move between zones; an instance recreated elsewhere under the same name
+// isn't noticed until the process restarts.
+func (gce *GCECloud) GetInstanceZone(host string) (string, error) {
+	name := instanceName(host)
+	gce.zoneLock.Lock()
+	zone, found := gce.instanceZones[name]
+	gce.zoneLock.Unlock()
+	if found {
+		return zone, nil
+	}
+	_, zone, err := gce.getInstance(name)
+	return zone, err
+}
+
+// GetZoneByInstance is an implementation of Zones.GetZoneByInstance. The zone
+// is found, and cached, as by GetInstanceZone.
+func (gce *GCECloud) GetZoneByInstance(name string) (cloudprovider.Zone, error) {
+	zone, err := gce.GetInstanceZone(name)
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	region, err := getGceRegion(zone)
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	return cloudprovider.Zone{FailureDomain: zone, Region: region}, nil
+}
+
+// getInstance returns the named instance and its zone. The cached zone of the
+// instance, or else the zone of this instance, is tried first, since most
+// clusters live in a single zone; the other zones of the project are searched
+// only if it isn't found there.
+func (gce *GCECloud) getInstance(host string) (*compute.Instance, string, error) {
+	name := instanceName(host)
+	zone := gce.zone
+	gce.zoneLock.Lock()
+	if cached, found := gce.instanceZones[name]; found {
+		zone = cached
+	}
+	gce.zoneLock.Unlock()
+
+	instance, err := gce.service.Instances.Get(gce.projectID, zone, name).Do()
+	if isHTTPErrorCode(err, http.StatusNotFound) {
+		instance, zone, err = gce.findInstance(name)
+	}
+	if errors.Is(err, cloudprovider.ErrInstanceNotFound) {
+		gce.zoneLock.Lock()
+		delete(gce.instanceZones, name)
+		gce.zoneLock.Unlock()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	gce.zoneLock.Lock()
+	if gce.instanceZones == nil {
+		gce.instanceZones = map[string]string{}
+	}
+	gce.instanceZones[name] = zone
+	gce.zoneLock.Unlock()
+	return instance, zone, nil
+}
+
+// findInstance searches every zone of the project for the named instance. An
+// error wrapping cloudprovider.ErrInstanceNotFound is returned if no zone
+// has it.
+func (gce *GCECloud) findInstance(name string) (*compute.Instance, string, error) {
+	call := gce.service.Instances.AggregatedList(gce.projectID).Filter("name eq " + name)
+	for {
+		res, err := call.Do()
+		if err != nil {
+			return nil, "", err
+		}
+		// Items are keyed by scope, e.g. "zones/us-central1-a".
+		for scope, list := range res.Items {
+			for _, instance := range list.Instances {
+				if instance.Name == name {
+					return instance, path.Base(scope), nil
+				}
+			}
+		}
+		if res.NextPageToken == "" {
+			break
+		}
+		call.PageToken(res.NextPageToken)
+	}
+	return nil, "", fmt.Errorf("%w: %s in any zone of project %s", cloudprovider.ErrInstanceNotFound, name, gce.projectID)
+}
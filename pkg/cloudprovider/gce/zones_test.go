@@ -0,0 +1,190 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce_cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	compute "code.google.com/p/google-api-go-client/compute/v1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+)
+
+func TestGetInstanceZone(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a"})
+		},
+		"GET /zones/us-central1-b/instances/host-c": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /aggregated/instances": func(w http.ResponseWriter, r *http.Request) {
+			if filter := r.URL.Query().Get("filter"); filter != "name eq host-c" {
+				t.Errorf("unexpected filter: %q", filter)
+			}
+			writeJSON(w, http.StatusOK, &compute.InstanceAggregatedList{Items: map[string]compute.InstancesScopedList{
+				"zones/us-central1-a": {},
+				"zones/us-central1-c": {Instances: []*compute.Instance{{Name: "host-c"}}},
+			}})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	for host, expected := range map[string]string{"host-a": "us-central1-b", "host-c.example.com": "us-central1-c"} {
+		zone, err := gce.GetInstanceZone(host)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", host, err)
+		}
+		if zone != expected {
+			t.Errorf("%s: expected zone %s, got %s", host, expected, zone)
+		}
+	}
+
+	// Zones are cached.
+	fake.requests = nil
+	if zone, err := gce.GetInstanceZone("host-c"); err != nil || zone != "us-central1-c" {
+		t.Errorf("expected cached zone us-central1-c, got %q, %v", zone, err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests for a cached zone, got %v", fake.requests)
+	}
+}
+
+func TestGetZoneByInstance(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /zones/us-central1-b/instances/host-x": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /aggregated/instances": func(w http.ResponseWriter, r *http.Request) {
+			list := &compute.InstanceAggregatedList{}
+			if r.URL.Query().Get("filter") == "name eq host-a" {
+				list.Items = map[string]compute.InstancesScopedList{
+					"zones/europe-west1-d": {Instances: []*compute.Instance{{Name: "host-a"}}},
+				}
+			}
+			writeJSON(w, http.StatusOK, list)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	zone, err := gce.GetZoneByInstance("host-a.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (cloudprovider.Zone{FailureDomain: "europe-west1-d", Region: "europe-west1"}); zone != expected {
+		t.Errorf("expected %+v, got %+v", expected, zone)
+	}
+	if _, err := gce.GetZoneByInstance("host-x"); !errors.Is(err, cloudprovider.ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+}
+
+func TestGetInstanceZoneNotFound(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances/host-x": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /aggregated/instances": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.InstanceAggregatedList{})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	if _, err := gce.GetInstanceZone("host-x"); !errors.Is(err, cloudprovider.ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+	if _, found := gce.instanceZones["host-x"]; found {
+		t.Errorf("expected a missing instance not to be cached")
+	}
+}
+
+func TestMakeTargetPoolMultiZone(t *testing.T) {
+	var pool compute.TargetPool
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"POST /regions/us-central1/targetPools": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&pool)
+			writeDoneOp(w, r)
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+	gce.instanceZones = map[string]string{"host-a": "us-central1-a", "host-b": "us-central1-b"}
+
+	if _, err := gce.makeTargetPool(context.Background(), "my-lb", "us-central1", []string{"host-a", "host-b"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-a/instances/host-a",
+		"https://www.googleapis.com/compute/v1/projects/my-project/zones/us-central1-b/instances/host-b",
+	}
+	if !reflect.DeepEqual(pool.Instances, expected) {
+		t.Errorf("expected instances %v, got %v", expected, pool.Instances)
+	}
+
+	// Hosts outside the region are rejected before the pool is created.
+	fake.requests = nil
+	gce.instanceZones["host-e"] = "us-east1-b"
+	if _, err := gce.makeTargetPool(context.Background(), "my-lb", "us-central1", []string{"host-a", "host-e"}, ""); err == nil {
+		t.Errorf("expected a host in another region to be rejected")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("expected no requests, got %v", fake.requests)
+	}
+}
+
+func TestExternalID(t *testing.T) {
+	fake := &fakeGCE{t: t, routes: map[string]http.HandlerFunc{
+		"GET /zones/us-central1-b/instances/host-a": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.Instance{Name: "host-a", Id: 12345678901234567890})
+		},
+		"GET /zones/us-central1-c/instances/host-c": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotFound)
+		},
+		"GET /aggregated/instances": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, &compute.InstanceAggregatedList{})
+		},
+	}}
+	gce, server := newTestGCECloud(t, fake)
+	defer server.Close()
+
+	id, err := gce.ExternalID("host-a.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "12345678901234567890" {
+		t.Errorf("unexpected external ID: %s", id)
+	}
+
+	// An instance deleted since its zone was cached isn't found anywhere.
+	gce.instanceZones["host-c"] = "us-central1-c"
+	if _, err := gce.ExternalID("host-c"); !errors.Is(err, cloudprovider.ErrInstanceNotFound) {
+		t.Errorf("expected ErrInstanceNotFound, got %v", err)
+	}
+	if _, found := gce.instanceZones["host-c"]; found {
+		t.Errorf("expected the zone of a deleted instance to be forgotten")
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package cloudprovider
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/golang/glog"
@@ -30,16 +32,17 @@ var providersMutex sync.Mutex
 var providers = make(map[string]Factory)
 
 // RegisterCloudProvider registers a cloudprovider.Factory by name.  This
-// is expected to happen during app startup.
-func RegisterCloudProvider(name string, cloud Factory) {
+// is expected to happen during app startup.  It is safe to call
+// concurrently, and returns an error if the name is already registered.
+func RegisterCloudProvider(name string, cloud Factory) error {
 	providersMutex.Lock()
 	defer providersMutex.Unlock()
-	_, found := providers[name]
-	if found {
-		glog.Fatalf("Cloud provider %q was registered twice", name)
+	if _, found := providers[name]; found {
+		return fmt.Errorf("cloud provider %q was registered twice", name)
 	}
 	glog.Infof("Registered cloud provider %q", name)
 	providers[name] = cloud
+	return nil
 }
 
 // GetCloudProvider creates an instance of the named cloud provider, or nil if
@@ -47,10 +50,23 @@ func RegisterCloudProvider(name string, cloud Factory) {
 // was known but failed to initialize.
 func GetCloudProvider(name string) (Interface, error) {
 	providersMutex.Lock()
-	defer providersMutex.Unlock()
 	f, found := providers[name]
+	providersMutex.Unlock()
 	if !found {
 		return nil, nil
 	}
+	// Initialization may be slow, so don't hold the lock while it runs.
 	return f()
 }
+
+// RegisteredCloudProviders returns the sorted names of all registered cloud providers.
+func RegisteredCloudProviders() []string {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
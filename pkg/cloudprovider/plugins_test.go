@@ -0,0 +1,91 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func fakeFactory() (Interface, error) {
+	return nil, nil
+}
+
+func unregister(names ...string) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+	for _, name := range names {
+		delete(providers, name)
+	}
+}
+
+func TestRegisterCloudProviderDuplicate(t *testing.T) {
+	defer unregister("fake-a", "fake-b")
+	if err := RegisterCloudProvider("fake-b", fakeFactory); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := RegisterCloudProvider("fake-a", fakeFactory); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := RegisterCloudProvider("fake-a", fakeFactory); err == nil {
+		t.Errorf("Expected an error registering a duplicate provider")
+	}
+	names := RegisteredCloudProviders()
+	if !reflect.DeepEqual(names, []string{"fake-a", "fake-b"}) {
+		t.Errorf("Unexpected registered providers: %v", names)
+	}
+	if cloud, err := GetCloudProvider("unknown"); cloud != nil || err != nil {
+		t.Errorf("Expected nil provider and error for an unknown name, got %v, %v", cloud, err)
+	}
+}
+
+func TestRegisterCloudProviderConcurrent(t *testing.T) {
+	const count = 50
+	var names []string
+	for i := 0; i < count; i++ {
+		names = append(names, fmt.Sprintf("concurrent-%d", i))
+	}
+	defer unregister(names...)
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*count)
+	for _, name := range names {
+		// Register every name twice so exactly one registration of each must fail.
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				errs <- RegisterCloudProvider(name, fakeFactory)
+			}(name)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	failures := 0
+	for err := range errs {
+		if err != nil {
+			failures++
+		}
+	}
+	if failures != count {
+		t.Errorf("Expected %d duplicate registrations to fail, got %d", count, failures)
+	}
+	if registered := RegisteredCloudProviders(); len(registered) != count {
+		t.Errorf("Expected %d registered providers, got %d", count, len(registered))
+	}
+}
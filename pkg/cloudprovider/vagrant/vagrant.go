@@ -26,6 +26,7 @@ import (
 	"sort"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+	"github.com/golang/glog"
 )
 
 // VagrantCloud is an implementation of Interface, TCPLoadBalancer and Instances for developer managed Vagrant cluster
@@ -37,7 +38,10 @@ type VagrantCloud struct {
 }
 
 func init() {
-	cloudprovider.RegisterCloudProvider("vagrant", func() (cloudprovider.Interface, error) { return newVagrantCloud() })
+	err := cloudprovider.RegisterCloudProvider("vagrant", func() (cloudprovider.Interface, error) { return newVagrantCloud() })
+	if err != nil {
+		glog.Fatal(err)
+	}
 }
 
 // SaltToken is an authorization token required by Salt REST API
@@ -98,6 +102,12 @@ func (v *VagrantCloud) IPAddress(instance string) (net.IP, error) {
 	return net.ParseIP(instance), nil
 }
 
+// ExternalID returns the identifier of a particular machine instance, which
+// in the vagrant env is its IP, like its name.
+func (v *VagrantCloud) ExternalID(instance string) (string, error) {
+	return instance, nil
+}
+
 // saltMinionsByRole filters a list of minions that have a matching role
 func (v *VagrantCloud) saltMinionsByRole(minions []SaltMinion, role string) []SaltMinion {
 	var filteredMinions []SaltMinion
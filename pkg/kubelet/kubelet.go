@@ -169,6 +169,11 @@ func (self *podWorkers) Run(podFullName string, action func()) {
 
 // LogEvent logs an event to the etcd backend.
 func (kl *Kubelet) LogEvent(event *api.Event) error {
+	return kl.logEvent(fmt.Sprintf("/events/%s", event.Container.Name), event)
+}
+
+// logEvent logs an event to the etcd backend under key.
+func (kl *Kubelet) logEvent(key string, event *api.Event) error {
 	if kl.etcdClient == nil {
 		return fmt.Errorf("no etcd client connection")
 	}
@@ -179,7 +184,7 @@ func (kl *Kubelet) LogEvent(event *api.Event) error {
 	}
 
 	var response *etcd.Response
-	response, err = kl.etcdClient.AddChild(fmt.Sprintf("/events/%s", event.Container.Name), string(data), 60*60*48 /* 2 days */)
+	response, err = kl.etcdClient.AddChild(key, string(data), 60*60*48 /* 2 days */)
 	// TODO(bburns) : examine response here.
 	if err != nil {
 		glog.Errorf("Error writing event: %s\n", err)
@@ -190,6 +195,23 @@ func (kl *Kubelet) LogEvent(event *api.Event) error {
 	return err
 }
 
+// RecordVolumeEvent logs volume operations as events, implementing
+// volume.EventRecorder. They are stored by pod and volume name, as volume
+// names are only unique within a pod.
+func (kl *Kubelet) RecordVolumeEvent(podID, volumeName, operation string, phase volume.EventPhase, err error) {
+	event := &api.Event{
+		Event: strings.ToUpper(fmt.Sprintf("VOLUME_%s_%s", operation, phase)),
+		Manifest: &api.ContainerManifest{
+			ID: podID,
+		},
+	}
+	if err != nil {
+		glog.Errorf("Volume %s of pod %s: %s failed: %v", volumeName, podID, operation, err)
+		event.Message = err.Error()
+	}
+	kl.logEvent(fmt.Sprintf("/events/pods/%s/volumes/%s", podID, volumeName), event)
+}
+
 func makeEnvironmentVariables(container *api.Container) []string {
 	var result []string
 	for _, value := range container.Env {
@@ -262,6 +284,12 @@ func milliCPUToShares(milliCPU int) int {
 }
 
 func (kl *Kubelet) mountExternalVolumes(manifest *api.ContainerManifest) (volumeMap, error) {
+	// Check every volume first so an invalid one doesn't leave the others set up.
+	for i := range manifest.Volumes {
+		if err := volume.ValidateVolume(&manifest.Volumes[i]); err != nil {
+			return nil, err
+		}
+	}
 	podVolumes := make(volumeMap)
 	for _, vol := range manifest.Volumes {
 		extVolume, err := volume.CreateVolumeBuilder(&vol, manifest.ID, kl.rootDirectory)
@@ -274,7 +302,7 @@ func (kl *Kubelet) mountExternalVolumes(manifest *api.ContainerManifest) (volume
 			continue
 		}
 		podVolumes[vol.Name] = extVolume
-		err = extVolume.SetUp()
+		err = volume.SetUpWithEvents(extVolume, manifest.ID, vol.Name)
 		if err != nil {
 			return nil, err
 		}
@@ -520,22 +548,39 @@ func getDesiredVolumes(pods []Pod) map[string]api.Volume {
 
 // Compares the map of current volumes to the map of desired volumes.
 // If an active volume does not have a respective desired volume, clean it up.
+// GCE persistent disks are cleaned up by volume.CleanupOrphanedPDs, which also
+// detaches disks left attached without any volume.
 func (kl *Kubelet) reconcileVolumes(pods []Pod) error {
 	desiredVolumes := getDesiredVolumes(pods)
-	currentVolumes := volume.GetCurrentVolumes(kl.rootDirectory)
-	for name, vol := range currentVolumes {
+	// Volumes that could be found are still cleaned up if others could not.
+	currentVolumes, err := volume.GetCurrentVolumes(kl.rootDirectory)
+	if err != nil {
+		glog.Errorf("Could not find all current volumes: %v", err)
+	}
+	desired := util.StringSet{}
+	for name := range desiredVolumes {
+		desired.Insert(name)
+	}
+	if pdErr := volume.CleanupOrphanedPDs(kl.rootDirectory, desired, currentVolumes); pdErr != nil {
+		glog.Infof("Could not clean up all orphaned persistent disks (%s)", pdErr)
+	}
+	for _, vol := range currentVolumes {
+		name := vol.Identifier()
+		if vol.Kind == volume.KindGCEPersistentDisk {
+			continue
+		}
 		if _, ok := desiredVolumes[name]; !ok {
 			//TODO (jonesdl) We should somehow differentiate between volumes that are supposed
 			//to be deleted and volumes that are leftover after a crash.
-			glog.Infof("Orphaned volume %s found, tearing down volume", name)
+			glog.Infof("Orphaned %s volume %s found, tearing down volume", vol.Kind, name)
 			//TODO (jonesdl) This should not block other kubelet synchronization procedures
-			err := vol.TearDown()
+			err := volume.TearDownWithEvents(vol.Cleaner, vol.PodID, vol.Name)
 			if err != nil {
 				glog.Infof("Could not tear down volume %s (%s)", name, err)
 			}
 		}
 	}
-	return nil
+	return err
 }
 
 // SyncPods synchronizes the configured list of pods (desired state) with the host current state.
@@ -613,6 +613,22 @@ func TestEventWritingError(t *testing.T) {
 	}
 }
 
+func TestRecordVolumeEvent(t *testing.T) {
+	kubelet, fakeEtcd, _ := newTestKubelet(t)
+	kubelet.RecordVolumeEvent("my-pod", "data", volume.OperationSetUp, volume.EventFailed, fmt.Errorf("mount failed"))
+	response, err := fakeEtcd.Get("/events/pods/my-pod/volumes/data/1", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var event api.Event
+	if err := json.Unmarshal([]byte(response.Node.Value), &event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Event != "VOLUME_SETUP_FAILED" || event.Manifest.ID != "my-pod" || event.Message != "mount failed" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+}
+
 func TestMakeEnvVariables(t *testing.T) {
 	container := api.Container{
 		Env: []api.EnvVar{
@@ -645,14 +661,14 @@ func TestMountExternalVolumes(t *testing.T) {
 			{
 				Name: "host-dir",
 				Source: &api.VolumeSource{
-					HostDirectory: &api.HostDirectory{"/dir/path"},
+					HostDirectory: &api.HostDirectory{Path: "/dir/path"},
 				},
 			},
 		},
 	}
 	podVolumes, _ := kubelet.mountExternalVolumes(&manifest)
 	expectedPodVolumes := make(volumeMap)
-	expectedPodVolumes["host-dir"] = &volume.HostDirectory{"/dir/path"}
+	expectedPodVolumes["host-dir"] = &volume.HostDirectory{Path: "/dir/path"}
 	if len(expectedPodVolumes) != len(podVolumes) {
 		t.Errorf("Unexpected volumes. Expected %#v got %#v.  Manifest was: %#v", expectedPodVolumes, podVolumes, manifest)
 	}
@@ -695,9 +711,9 @@ func TestMakeVolumesAndBinds(t *testing.T) {
 	}
 
 	podVolumes := volumeMap{
-		"disk":  &volume.HostDirectory{"/mnt/disk"},
-		"disk4": &volume.HostDirectory{"/mnt/host"},
-		"disk5": &volume.EmptyDirectory{"disk5", "podID", "/var/lib/kubelet"},
+		"disk":  &volume.HostDirectory{Path: "/mnt/disk"},
+		"disk4": &volume.HostDirectory{Path: "/mnt/host"},
+		"disk5": &volume.EmptyDirectory{Name: "disk5", PodID: "podID", RootDir: "/var/lib/kubelet"},
 	}
 
 	binds := makeBinds(&pod, &container, podVolumes)
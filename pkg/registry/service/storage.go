@@ -17,6 +17,7 @@ limitations under the License.
 package service
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -78,7 +79,8 @@ func (rs *RegistryStorage) Create(obj interface{}) (<-chan interface{}, error) {
 			if err != nil {
 				return nil, err
 			}
-			err = balancer.CreateTCPLoadBalancer(srv.ID, zone.Region, srv.Port, hosts)
+			affinity := cloudprovider.SessionAffinity(srv.SessionAffinity)
+			err = balancer.CreateTCPLoadBalancer(context.Background(), srv.ID, zone.Region, srv.LoadBalancerIP, []int{srv.Port}, srv.Protocol, hosts, affinity)
 			if err != nil {
 				return nil, err
 			}
@@ -200,7 +202,7 @@ func (rs *RegistryStorage) deleteExternalLoadBalancer(service *api.Service) erro
 	if err != nil {
 		return err
 	}
-	if err := balancer.DeleteTCPLoadBalancer(service.JSONBase.ID, zone.Region); err != nil {
+	if err := balancer.DeleteTCPLoadBalancer(context.Background(), service.JSONBase.ID, zone.Region); err != nil {
 		return err
 	}
 	return nil
@@ -18,6 +18,7 @@ package service
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
@@ -162,6 +163,13 @@ func TestServiceRegistryExternalService(t *testing.T) {
 	if len(fakeCloud.Calls) != 2 || fakeCloud.Calls[0] != "get-zone" || fakeCloud.Calls[1] != "create" {
 		t.Errorf("Unexpected call(s): %#v", fakeCloud.Calls)
 	}
+	if len(fakeCloud.Balancers) != 1 {
+		t.Fatalf("Expected one balancer, got %#v", fakeCloud.Balancers)
+	}
+	balancer := fakeCloud.Balancers[0]
+	if balancer.Name != "foo" || !reflect.DeepEqual(balancer.Ports, []int{6502}) || !reflect.DeepEqual(balancer.Hosts, []string{"bar", "baz", "foo"}) {
+		t.Errorf("Unexpected balancer: %#v", balancer)
+	}
 	srv, err := registry.GetService(svc.ID)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
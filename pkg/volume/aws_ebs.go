@@ -0,0 +1,292 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+	"github.com/golang/glog"
+)
+
+// How long to wait for the device of an attached EBS volume to appear.
+// Variables so tests can replace them.
+var (
+	ebsDeviceWaitTimeout  = 10 * time.Second
+	ebsDeviceWaitInterval = time.Second
+)
+
+// awsDiskUtil abstracts the provider calls that attach and detach EBS volumes.
+type awsDiskUtil interface {
+	// Attaches the volume to the kubelet's host machine and mounts it to
+	// its global path.
+	AttachDisk(ebs *AWSElasticBlockStore) error
+	// Unmounts the global mount and detaches the volume from the kubelet's
+	// host machine.
+	DetachDisk(ebs *AWSElasticBlockStore, devicePath string) error
+}
+
+// AWSElasticBlockStore volumes are EBS volumes that are attached to the
+// kubelet's host machine and exposed to the pod. Like GCE PDs, each volume is
+// mounted once per host and bind mounted into each pod using it.
+type AWSElasticBlockStore struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Unique ID of the EBS volume, used to find it in the provider.
+	VolumeID string
+	// Filesystem type, optional.
+	FSType string
+	// Specifies the partition to mount
+	Partition string
+	// Specifies whether the volume will be attached as ReadOnly.
+	ReadOnly bool
+	// Utility interface that provides API calls to the provider to attach/detach volumes.
+	util awsDiskUtil
+	// Mounter interface that provides system calls to mount the volumes.
+	mounter mounter
+	// Runner used to inspect and format the device.
+	runner commandRunner
+}
+
+func (ebs *AWSElasticBlockStore) GetPath() string {
+	return VolumeHost{RootDir: ebs.RootDir}.PodVolumeDir(ebs.PodID, KindAWSElasticBlockStore, ebs.Name)
+}
+
+// Attaches the volume and bind mounts to the volume path.
+func (ebs *AWSElasticBlockStore) SetUp() error {
+	lockName := ebsLockName(ebs.VolumeID)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	mountpoint, err := ebs.mounter.IsMountPoint(ebs.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if err := ebs.util.AttachDisk(ebs); err != nil {
+		return err
+	}
+	// Perform a bind mount to the full path to allow duplicate mounts of the same volume.
+	if err := os.MkdirAll(ebs.GetPath(), 0750); err != nil {
+		return err
+	}
+	globalPath := makeGlobalEBSPath(ebs.RootDir, ebs.VolumeID, ebs.Partition)
+	return bindMount(ebs.mounter, globalPath, ebs.GetPath(), ebs.ReadOnly, nil)
+}
+
+// Unmounts the bind mount, and detaches the volume only if it was the last
+// reference to the device on the kubelet.
+func (ebs *AWSElasticBlockStore) TearDown() error {
+	if _, err := os.Stat(ebs.GetPath()); os.IsNotExist(err) {
+		return nil
+	}
+	devicePath, _, err := ebs.mounter.RefCount(ebs)
+	if errors.Is(err, errNotMountPoint) {
+		return removeMountPoint(ebs.mounter, ebs.GetPath())
+	}
+	if err != nil {
+		return err
+	}
+	volumeID, _, err := ebs.globalMount(devicePath)
+	if err != nil {
+		return err
+	}
+	lockName := ebsLockName(volumeID)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	// The references are counted again now that no SetUp or TearDown of a
+	// partition of the volume can change them.
+	return tearDownBlockVolume(ebs, ebs.mounter, func(devicePath string) error {
+		return ebs.util.DetachDisk(ebs, devicePath)
+	})
+}
+
+// ebsLockName returns the name a volume is locked by in pdLocks. Detaching
+// affects every partition of a volume, so they share the lock.
+func ebsLockName(volumeID string) string {
+	return path.Join(KindAWSElasticBlockStore, volumeID)
+}
+
+// globalMount returns the volume ID and partition whose global mount
+// devicePath is. A cleaner doesn't know them, so they are found from the
+// mount table.
+func (ebs *AWSElasticBlockStore) globalMount(devicePath string) (string, string, error) {
+	if ebs.VolumeID != "" {
+		return ebs.VolumeID, ebs.Partition, nil
+	}
+	mounts, err := mountTable()
+	if err != nil {
+		return "", "", err
+	}
+	volumeID, partition := findGlobalEBSMount(mounts, ebs.RootDir, devicePath)
+	if volumeID == "" {
+		return "", "", fmt.Errorf("no global mount of EBS device %s", devicePath)
+	}
+	return volumeID, partition, nil
+}
+
+// makeGlobalEBSPath returns the path an EBS volume, or the given partition of
+// it, is mounted to once per host, which pod volume paths are then bind
+// mounted from. Partitions are mounted below the volume's directory, so each
+// has its own path.
+func makeGlobalEBSPath(rootDir, volumeID, partition string) string {
+	return path.Join(VolumeHost{RootDir: rootDir}.GlobalDir(KindAWSElasticBlockStore, volumeID), partition)
+}
+
+// findGlobalEBSMount returns the volume ID and partition of the global mount
+// of device, or an empty volume ID if there is none.
+func findGlobalEBSMount(mounts []mountEntry, rootDir, device string) (string, string) {
+	globalDir := makeGlobalEBSPath(rootDir, "", "")
+	if volumeID := globalMountName(mounts, globalDir, device); volumeID != "" {
+		return volumeID, ""
+	}
+	for _, mount := range mounts {
+		volumeDir := path.Dir(mount.MountPoint)
+		if mount.Device == device && path.Dir(volumeDir) == globalDir {
+			return path.Base(volumeDir), path.Base(mount.MountPoint)
+		}
+	}
+	return "", ""
+}
+
+// Interprets API volume as an AWSElasticBlockStore
+func createAWSElasticBlockStore(volume *api.Volume, podID string, rootDir string) *AWSElasticBlockStore {
+	source := volume.Source.AWSElasticBlockStore
+	partition := ""
+	if source.Partition != 0 {
+		partition = strconv.Itoa(source.Partition)
+	}
+	return &AWSElasticBlockStore{
+		Name:      volume.Name,
+		PodID:     podID,
+		RootDir:   rootDir,
+		VolumeID:  source.VolumeID,
+		FSType:    source.FSType,
+		Partition: partition,
+		ReadOnly:  source.ReadOnly,
+		util:      &AWSDiskUtil{},
+		mounter:   newMounter(),
+		runner:    &execRunner{},
+	}
+}
+
+// awsVolumes is implemented by the "aws" cloud provider to attach EBS
+// volumes to the instance the kubelet runs on.
+type awsVolumes interface {
+	// AttachDisk attaches the volume and returns the device it appears as,
+	// e.g. /dev/xvdf.
+	AttachDisk(volumeID string, readOnly bool) (string, error)
+	DetachDisk(volumeID string) error
+}
+
+type AWSDiskUtil struct{}
+
+func getAWSCloud() (awsVolumes, error) {
+	cloud, err := cloudprovider.GetCloudProvider("aws")
+	if err != nil {
+		return nil, err
+	}
+	aws, ok := cloud.(awsVolumes)
+	if !ok {
+		return nil, errors.New("AWS cloud provider is not available")
+	}
+	return aws, nil
+}
+
+// Attaches the EBS volume to the current kubelet and mounts it to its global
+// path, formatting it first if it is empty.
+func (util *AWSDiskUtil) AttachDisk(ebs *AWSElasticBlockStore) error {
+	aws, err := getAWSCloud()
+	if err != nil {
+		return err
+	}
+	devicePath, err := aws.AttachDisk(ebs.VolumeID, ebs.ReadOnly)
+	if err != nil {
+		return err
+	}
+	devicePath += ebs.Partition
+	if err := waitForDevice(devicePath, ebsDeviceWaitTimeout, ebsDeviceWaitInterval); err != nil {
+		return err
+	}
+	globalPath := makeGlobalEBSPath(ebs.RootDir, ebs.VolumeID, ebs.Partition)
+	// Only mount the volume globally once.
+	mountpoint, err := ebs.mounter.IsMountPoint(globalPath)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if !ebs.ReadOnly {
+		if err := formatIfNeeded(ebs.runner, devicePath, ebs.FSType); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(globalPath, 0750); err != nil {
+		return err
+	}
+	fstype := ebs.FSType
+	if fstype == "" {
+		fstype = defaultFSType
+	}
+	flags := uintptr(0)
+	if ebs.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	return mountNew(ebs.mounter, devicePath, globalPath, fstype, flags, "")
+}
+
+// Unmounts the global mount of the device and detaches the volume from the
+// kubelet's host machine, unless another partition of it is still mounted.
+func (util *AWSDiskUtil) DetachDisk(ebs *AWSElasticBlockStore, devicePath string) error {
+	volumeID, partition, err := ebs.globalMount(devicePath)
+	if err != nil {
+		return err
+	}
+	globalPath := makeGlobalEBSPath(ebs.RootDir, volumeID, partition)
+	if err := unmountWithRetry(ebs.mounter, globalPath, false); err != nil {
+		return err
+	}
+	if err := os.Remove(globalPath); err != nil {
+		return err
+	}
+	if partition != "" {
+		// The volume's directory is left if another partition is mounted.
+		os.Remove(path.Dir(globalPath))
+	}
+	mounted, err := mountedWithPartitions(ebs.mounter, makeGlobalEBSPath(ebs.RootDir, volumeID, ""))
+	if err != nil {
+		return err
+	}
+	if mounted {
+		glog.V(1).Infof("Other partitions of EBS volume %s are in use, leaving it attached", volumeID)
+		return nil
+	}
+	aws, err := getAWSCloud()
+	if err != nil {
+		return err
+	}
+	return aws.DetachDisk(volumeID)
+}
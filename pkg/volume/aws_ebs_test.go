@@ -0,0 +1,172 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type fakeEBSUtil struct {
+	calls []string
+}
+
+func (f *fakeEBSUtil) AttachDisk(ebs *AWSElasticBlockStore) error {
+	f.calls = append(f.calls, "attach")
+	return nil
+}
+
+func (f *fakeEBSUtil) DetachDisk(ebs *AWSElasticBlockStore, devicePath string) error {
+	f.calls = append(f.calls, "detach "+devicePath)
+	return nil
+}
+
+func TestAWSElasticBlockStore(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "AWSElasticBlockStore")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	util := &fakeEBSUtil{}
+	mounter := &FakeMounter{}
+	ebs := &AWSElasticBlockStore{
+		Name:     "data",
+		PodID:    "my-id",
+		RootDir:  tempDir,
+		VolumeID: "vol-0a1b2c3d",
+		util:     util,
+		mounter:  mounter,
+	}
+	if err := ebs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedMounts := []string{":" + ebs.GetPath(), ":" + ebs.GetPath()}
+	if !reflect.DeepEqual(mounter.Mounts, expectedMounts) {
+		t.Errorf("Expected mounts %v, got %v", expectedMounts, mounter.Mounts)
+	}
+
+	cleaner, err := CreateVolumeCleaner("aws-ebs", "data", "my-id", tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cleaner.(*AWSElasticBlockStore).util = util
+	cleaner.(*AWSElasticBlockStore).mounter = mounter
+	// The cleaner finds the volume to lock from its global mount.
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	mountTable = func() ([]mountEntry, error) {
+		return []mountEntry{{Device: "/dev/xvdf", MountPoint: makeGlobalEBSPath(tempDir, "vol-0a1b2c3d", "")}}, nil
+	}
+	// Another pod still has the volume bind mounted.
+	mounter.Device, mounter.Refs = "/dev/xvdf", 3
+	if err := cleaner.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(util.calls, []string{"attach"}) {
+		t.Errorf("Expected no detach while the volume is in use, got %v", util.calls)
+	}
+
+	if err := ebs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter.Refs = 2
+	if err := cleaner.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedCalls := []string{"attach", "attach", "detach /dev/xvdf"}
+	if !reflect.DeepEqual(util.calls, expectedCalls) {
+		t.Errorf("Expected calls %v, got %v", expectedCalls, util.calls)
+	}
+	if _, err := os.Stat(ebs.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("TearDown() did not remove %v", ebs.GetPath())
+	}
+}
+
+func TestGlobalMountName(t *testing.T) {
+	mounts := []mountEntry{
+		{Device: "/dev/xvdf", MountPoint: "/var/lib/kubelet/global/aws-ebs/vol-0a1b2c3d"},
+		{Device: "/dev/xvdf", MountPoint: "/var/lib/kubelet/pod1/volumes/aws-ebs/data"},
+	}
+	globalDir := makeGlobalEBSPath("/var/lib/kubelet", "", "")
+	if name := globalMountName(mounts, globalDir, "/dev/xvdf"); name != "vol-0a1b2c3d" {
+		t.Errorf("Expected vol-0a1b2c3d, got %q", name)
+	}
+	if name := globalMountName(mounts, globalDir, "/dev/xvdg"); name != "" {
+		t.Errorf("Expected no volume for an unmounted device, got %q", name)
+	}
+}
+
+func TestFindGlobalEBSMount(t *testing.T) {
+	mounts := []mountEntry{
+		{Device: "/dev/xvdf", MountPoint: "/var/lib/kubelet/global/aws-ebs/vol-0a1b2c3d"},
+		{Device: "/dev/xvdg1", MountPoint: "/var/lib/kubelet/global/aws-ebs/vol-1a2b3c4d/1"},
+		{Device: "/dev/xvdg2", MountPoint: "/var/lib/kubelet/global/aws-ebs/vol-1a2b3c4d/2"},
+	}
+	tests := []struct {
+		device, volumeID, partition string
+	}{
+		{"/dev/xvdf", "vol-0a1b2c3d", ""},
+		{"/dev/xvdg2", "vol-1a2b3c4d", "2"},
+		{"/dev/xvdh", "", ""},
+	}
+	for _, test := range tests {
+		volumeID, partition := findGlobalEBSMount(mounts, "/var/lib/kubelet", test.device)
+		if volumeID != test.volumeID || partition != test.partition {
+			t.Errorf("%s: expected %q and %q, got %q and %q", test.device, test.volumeID, test.partition, volumeID, partition)
+		}
+	}
+	if expected := "/var/lib/kubelet/global/aws-ebs/vol-1a2b3c4d/2"; makeGlobalEBSPath("/var/lib/kubelet", "vol-1a2b3c4d", "2") != expected {
+		t.Errorf("Expected partition 2 to be mounted at %s", expected)
+	}
+}
+
+func TestDetachEBSWithMountedPartition(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "DetachEBSPartition")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	first := makeGlobalEBSPath(tempDir, "vol-1a2b3c4d", "1")
+	second := makeGlobalEBSPath(tempDir, "vol-1a2b3c4d", "2")
+	for _, dir := range []string{first, second} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	mounter := &FakeMounter{MountPoints: map[string]bool{second: true}}
+	ebs := &AWSElasticBlockStore{
+		RootDir:   tempDir,
+		VolumeID:  "vol-1a2b3c4d",
+		Partition: "1",
+		mounter:   mounter,
+	}
+	// The volume is left attached, without asking the provider, while
+	// partition 2 is still mounted.
+	if err := (&AWSDiskUtil{}).DetachDisk(ebs, "/dev/xvdg1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(mounter.Unmounts, []string{first}) {
+		t.Errorf("Expected only %s to be unmounted, got %v", first, mounter.Unmounts)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("DetachDisk() did not remove %s", first)
+	}
+	if _, err := os.Stat(second); err != nil {
+		t.Errorf("Expected %s to be left, got %v", second, err)
+	}
+}
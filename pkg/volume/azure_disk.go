@@ -0,0 +1,269 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+)
+
+// azureDiskUtil abstracts the provider calls that attach and detach Azure
+// data disks.
+type azureDiskUtil interface {
+	// Attaches the disk to the kubelet's host machine and mounts it to its
+	// global path.
+	AttachDisk(disk *AzureDisk) error
+	// Unmounts the global mount and detaches the disk from the kubelet's
+	// host machine.
+	DetachDisk(disk *AzureDisk, devicePath string) error
+}
+
+// Where the Azure Linux agent's udev rules link data disks, as lun<N>, and
+// how long to wait for the link to appear after attaching. Variables so
+// tests can replace them.
+var (
+	azureDiskDeviceDir          = "/dev/disk/azure/scsi1"
+	azureDiskDeviceWaitTimeout  = 10 * time.Second
+	azureDiskDeviceWaitInterval = time.Second
+)
+
+// defaultAzureCachingMode is used for disks whose volume does not specify one.
+const defaultAzureCachingMode = "ReadWrite"
+
+// AzureDisk volumes are Azure data disks that are attached to the kubelet's
+// host machine and exposed to the pod. Like GCE PDs, each disk is mounted
+// once per host and bind mounted into each pod using it.
+type AzureDisk struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Name of the data disk, unique within the host's attached disks.
+	DiskName string
+	// URI of the data disk, used to attach it.
+	DiskURI string
+	// Host caching mode the disk is attached with.
+	CachingMode string
+	// Filesystem type, optional.
+	FSType string
+	// Specifies whether the disk will be mounted ReadOnly.
+	ReadOnly bool
+	// Utility interface that provides API calls to the provider to attach/detach disks.
+	util azureDiskUtil
+	// Mounter interface that provides system calls to mount the disks.
+	mounter mounter
+	// Runner used to inspect and format the device.
+	runner commandRunner
+}
+
+func (disk *AzureDisk) GetPath() string {
+	return VolumeHost{RootDir: disk.RootDir}.PodVolumeDir(disk.PodID, KindAzureDisk, disk.Name)
+}
+
+// Attaches the disk and bind mounts to the volume path.
+func (disk *AzureDisk) SetUp() error {
+	lockName := disk.lockName("")
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	mountpoint, err := disk.mounter.IsMountPoint(disk.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if err := disk.util.AttachDisk(disk); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(disk.GetPath(), 0750); err != nil {
+		return err
+	}
+	globalPath := makeGlobalAzureDiskPath(disk.RootDir, disk.DiskName)
+	return bindMount(disk.mounter, globalPath, disk.GetPath(), disk.ReadOnly, nil)
+}
+
+// Unmounts the bind mount, and detaches the disk only if it was the last
+// reference to the device on the kubelet.
+func (disk *AzureDisk) TearDown() error {
+	if _, err := os.Stat(disk.GetPath()); os.IsNotExist(err) {
+		return nil
+	}
+	devicePath, _, err := disk.mounter.RefCount(disk)
+	if errors.Is(err, errNotMountPoint) {
+		return removeMountPoint(disk.mounter, disk.GetPath())
+	}
+	if err != nil {
+		return err
+	}
+	lockName := disk.lockName(devicePath)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	// The references are counted again now that no SetUp or TearDown of the
+	// disk can change them.
+	return tearDownBlockVolume(disk, disk.mounter, func(devicePath string) error {
+		return disk.util.DetachDisk(disk, devicePath)
+	})
+}
+
+// lockName returns the name the disk mounted from devicePath is locked by in
+// pdLocks. Cleaners found on the host don't know their disk's name, so it is
+// found from the global mount of the device where possible.
+func (disk *AzureDisk) lockName(devicePath string) string {
+	diskName := disk.DiskName
+	if diskName == "" {
+		if mounts, err := mountTable(); err == nil {
+			diskName = globalMountName(mounts, makeGlobalAzureDiskPath(disk.RootDir, ""), devicePath)
+		}
+	}
+	if diskName == "" {
+		diskName = devicePath
+	}
+	return path.Join(KindAzureDisk, diskName)
+}
+
+// makeGlobalAzureDiskPath returns the path a data disk is mounted to once per
+// host, which pod volume paths are then bind mounted from.
+func makeGlobalAzureDiskPath(rootDir, diskName string) string {
+	return VolumeHost{RootDir: rootDir}.GlobalDir(KindAzureDisk, diskName)
+}
+
+// Interprets API volume as an AzureDisk
+func createAzureDisk(volume *api.Volume, podID string, rootDir string) *AzureDisk {
+	source := volume.Source.AzureDisk
+	cachingMode := source.CachingMode
+	if cachingMode == "" {
+		cachingMode = defaultAzureCachingMode
+	}
+	return &AzureDisk{
+		Name:        volume.Name,
+		PodID:       podID,
+		RootDir:     rootDir,
+		DiskName:    source.DiskName,
+		DiskURI:     source.DataDiskURI,
+		CachingMode: cachingMode,
+		FSType:      source.FSType,
+		ReadOnly:    source.ReadOnly,
+		util:        &AzureDiskUtil{},
+		mounter:     newMounter(),
+		runner:      &execRunner{},
+	}
+}
+
+// azureVolumes is implemented by the "azure" cloud provider to attach data
+// disks to the virtual machine the kubelet runs on.
+type azureVolumes interface {
+	// AttachDisk attaches the disk with the given caching mode and returns
+	// the LUN it is attached at.
+	AttachDisk(diskName, diskURI, cachingMode string) (int, error)
+	DetachDisk(diskName string) error
+}
+
+type AzureDiskUtil struct{}
+
+func getAzureCloud() (azureVolumes, error) {
+	cloud, err := cloudprovider.GetCloudProvider("azure")
+	if err != nil {
+		return nil, err
+	}
+	azure, ok := cloud.(azureVolumes)
+	if !ok {
+		return nil, errors.New("Azure cloud provider is not available")
+	}
+	return azure, nil
+}
+
+// Attaches the data disk to the current kubelet and mounts it to its global
+// path, formatting it first if it is empty.
+func (util *AzureDiskUtil) AttachDisk(disk *AzureDisk) error {
+	azure, err := getAzureCloud()
+	if err != nil {
+		return err
+	}
+	lun, err := azure.AttachDisk(disk.DiskName, disk.DiskURI, disk.CachingMode)
+	if err != nil {
+		return err
+	}
+	devicePath := path.Join(azureDiskDeviceDir, fmt.Sprintf("lun%d", lun))
+	if err := waitForDevice(devicePath, azureDiskDeviceWaitTimeout, azureDiskDeviceWaitInterval); err != nil {
+		return err
+	}
+	globalPath := makeGlobalAzureDiskPath(disk.RootDir, disk.DiskName)
+	// Only mount the disk globally once.
+	mountpoint, err := disk.mounter.IsMountPoint(globalPath)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if !disk.ReadOnly {
+		if err := formatIfNeeded(disk.runner, devicePath, disk.FSType); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(globalPath, 0750); err != nil {
+		return err
+	}
+	fstype := disk.FSType
+	if fstype == "" {
+		fstype = defaultFSType
+	}
+	flags := uintptr(0)
+	if disk.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	return mountNew(disk.mounter, devicePath, globalPath, fstype, flags, "")
+}
+
+// Unmounts the global mount of the device and detaches the disk from the
+// kubelet's host machine. A cleaner doesn't know the disk's name, so it is
+// found from the global mount of the device.
+func (util *AzureDiskUtil) DetachDisk(disk *AzureDisk, devicePath string) error {
+	diskName := disk.DiskName
+	if diskName == "" {
+		file, err := os.Open("/proc/mounts")
+		if err != nil {
+			return err
+		}
+		mounts, err := parseMounts(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		diskName = globalMountName(mounts, makeGlobalAzureDiskPath(disk.RootDir, ""), devicePath)
+		if diskName == "" {
+			return fmt.Errorf("no global mount of Azure disk device %s", devicePath)
+		}
+	}
+	globalPath := makeGlobalAzureDiskPath(disk.RootDir, diskName)
+	if err := unmountWithRetry(disk.mounter, globalPath, false); err != nil {
+		return err
+	}
+	if err := os.Remove(globalPath); err != nil {
+		return err
+	}
+	azure, err := getAzureCloud()
+	if err != nil {
+		return err
+	}
+	return azure.DetachDisk(diskName)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+type fakeAzureDiskUtil struct {
+	calls []string
+}
+
+func (f *fakeAzureDiskUtil) AttachDisk(disk *AzureDisk) error {
+	f.calls = append(f.calls, "attach "+disk.CachingMode)
+	return nil
+}
+
+func (f *fakeAzureDiskUtil) DetachDisk(disk *AzureDisk, devicePath string) error {
+	f.calls = append(f.calls, "detach "+devicePath)
+	return nil
+}
+
+func TestAzureDisk(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "AzureDisk")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	volume := &api.Volume{
+		Name:   "data",
+		Source: &api.VolumeSource{AzureDisk: &api.AzureDisk{DiskName: "data-disk", DataDiskURI: "https://example.blob.core.windows.net/vhds/data.vhd"}},
+	}
+	builder, err := CreateVolumeBuilder(volume, "my-id", tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	disk := builder.(*AzureDisk)
+	util := &fakeAzureDiskUtil{}
+	mounter := &FakeMounter{}
+	disk.util, disk.mounter = util, mounter
+	if err := disk.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedMounts := []string{":" + disk.GetPath(), ":" + disk.GetPath()}
+	if !reflect.DeepEqual(mounter.Mounts, expectedMounts) {
+		t.Errorf("Expected mounts %v, got %v", expectedMounts, mounter.Mounts)
+	}
+
+	cleaner, err := CreateVolumeCleaner("azure-disk", "data", "my-id", tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cleaner.(*AzureDisk).util = util
+	cleaner.(*AzureDisk).mounter = mounter
+	mounter.Device, mounter.Refs = "/dev/sdc", 2
+	if err := cleaner.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedCalls := []string{"attach ReadWrite", "detach /dev/sdc"}
+	if !reflect.DeepEqual(util.calls, expectedCalls) {
+		t.Errorf("Expected calls %v, got %v", expectedCalls, util.calls)
+	}
+	if _, err := os.Stat(disk.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("TearDown() did not remove %v", disk.GetPath())
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+// CephFS volumes are mounted from a Ceph filesystem by the kernel client.
+type CephFS struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Addresses of the Ceph monitors.
+	Monitors []string
+	// Path within the filesystem to mount.
+	Path string
+	// Ceph user to mount as.
+	User string
+	// Path to a file on the host holding the user's secret key.
+	SecretFile string
+	// The user's secret key, used if SecretFile isn't set.
+	Secret string
+	// Specifies whether the volume will be mounted ReadOnly.
+	ReadOnly bool
+	// MountOptions are added to the CephFS mount's options.
+	MountOptions []string
+	// Mounter interface that provides system calls to mount the volume.
+	mounter mounter
+}
+
+func (cephfs *CephFS) GetPath() string {
+	return VolumeHost{RootDir: cephfs.RootDir}.PodVolumeDir(cephfs.PodID, KindCephFS, cephfs.Name)
+}
+
+// Mounts the filesystem. The kernel client is given every monitor, but only
+// tries the others once it has reached one, so each monitor in turn is put
+// first until the mount succeeds.
+func (cephfs *CephFS) SetUp() error {
+	mountpoint, err := cephfs.mounter.IsMountPoint(cephfs.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if len(cephfs.Monitors) == 0 {
+		return fmt.Errorf("CephFS volume %s lists no monitors", cephfs.Name)
+	}
+	if err := os.MkdirAll(cephfs.GetPath(), 0750); err != nil {
+		return err
+	}
+	flags := uintptr(0)
+	if cephfs.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	optionFlags, data := parseMountOptions(cephfs.MountOptions, cephfs.authOptions()...)
+	remotePath := cephfs.Path
+	if remotePath == "" {
+		remotePath = "/"
+	}
+	for i := range cephfs.Monitors {
+		var monitors []string
+		monitors = append(monitors, cephfs.Monitors[i:]...)
+		monitors = append(monitors, cephfs.Monitors[:i]...)
+		source := strings.Join(monitors, ",") + ":" + remotePath
+		err = cephfs.mounter.Mount(source, cephfs.GetPath(), "ceph", flags|optionFlags, data)
+		if err == nil {
+			return nil
+		}
+		glog.Warningf("Failed to mount CephFS path %s from monitor %s: %v", remotePath, cephfs.Monitors[i], err)
+	}
+	os.RemoveAll(cephfs.GetPath())
+	return fmt.Errorf("mounting CephFS path %s: no monitor accepted the mount: %v", remotePath, err)
+}
+
+// authOptions returns the mount options naming the user and its secret.
+func (cephfs *CephFS) authOptions() []string {
+	user := cephfs.User
+	if user == "" {
+		user = "admin"
+	}
+	options := []string{"name=" + user}
+	if cephfs.SecretFile != "" {
+		options = append(options, "secretfile="+cephfs.SecretFile)
+	} else if cephfs.Secret != "" {
+		options = append(options, "secret="+cephfs.Secret)
+	}
+	return options
+}
+
+// Unmounts the volume and removes its directory.
+func (cephfs *CephFS) TearDown() error {
+	mountpoint, err := cephfs.mounter.IsMountPoint(cephfs.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(cephfs.mounter, cephfs.GetPath(), true); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(cephfs.GetPath())
+}
+
+// Interprets API volume as a CephFS volume
+func createCephFS(volume *api.Volume, podID string, rootDir string) *CephFS {
+	source := volume.Source.CephFS
+	return &CephFS{
+		Name:         volume.Name,
+		PodID:        podID,
+		RootDir:      rootDir,
+		Monitors:     source.Monitors,
+		Path:         source.Path,
+		User:         source.User,
+		SecretFile:   source.SecretFile,
+		Secret:       source.Secret,
+		ReadOnly:     source.ReadOnly,
+		MountOptions: volume.MountOptions,
+		mounter:      newMounter(),
+	}
+}
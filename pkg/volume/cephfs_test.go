@@ -0,0 +1,152 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCephFSSetUpTearDown(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "CephFSSetUpTearDown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &failingMounter{failSources: map[string]bool{"10.0.0.1:6789,10.0.0.2,10.0.0.3:/shared": true}}
+	cephfs := &CephFS{
+		Name:       "data",
+		PodID:      "my-id",
+		RootDir:    tempDir,
+		Monitors:   []string{"10.0.0.1:6789", "10.0.0.2", "10.0.0.3"},
+		Path:       "/shared",
+		SecretFile: "/etc/ceph/admin.secret",
+		mounter:    mounter,
+	}
+	if err := cephfs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"10.0.0.1:6789,10.0.0.2,10.0.0.3:/shared", "10.0.0.2,10.0.0.3,10.0.0.1:6789:/shared"}
+	if !reflect.DeepEqual(mounter.sources, expected) {
+		t.Errorf("Expected mounts from %v, got %v", expected, mounter.sources)
+	}
+	if expected := []string{"ceph:" + cephfs.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, mounter.Mounts)
+	}
+	if expected := []string{"name=admin,secretfile=/etc/ceph/admin.secret"}; !reflect.DeepEqual(mounter.MountData, expected) {
+		t.Errorf("Expected mount data %v, got %v", expected, mounter.MountData)
+	}
+	if err := cephfs.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{cephfs.GetPath()}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+		t.Errorf("Expected unmounts %v, got %v", expected, mounter.Unmounts)
+	}
+	if _, err := os.Stat(cephfs.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the volume path to be removed, got %v", err)
+	}
+}
+
+func TestCephFSInlineSecret(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "CephFSInlineSecret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &FakeMounter{}
+	cephfs := &CephFS{
+		Name:     "data",
+		PodID:    "my-id",
+		RootDir:  tempDir,
+		Monitors: []string{"10.0.0.1"},
+		User:     "kube",
+		Secret:   "AQBSdFhT",
+		ReadOnly: true,
+		mounter:  mounter,
+	}
+	if err := cephfs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"name=kube,secret=AQBSdFhT"}; !reflect.DeepEqual(mounter.MountData, expected) {
+		t.Errorf("Expected mount data %v, got %v", expected, mounter.MountData)
+	}
+}
+
+func TestCephFSSetUpFailures(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "CephFSSetUpFailures")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		name     string
+		monitors []string
+		fail     map[string]bool
+	}{
+		{name: "no monitors"},
+		{name: "down", monitors: []string{"10.0.0.1", "10.0.0.2"}, fail: map[string]bool{"10.0.0.1,10.0.0.2:/": true, "10.0.0.2,10.0.0.1:/": true}},
+	}
+	for _, test := range tests {
+		cephfs := &CephFS{
+			Name:     test.name,
+			PodID:    "my-id",
+			RootDir:  tempDir,
+			Monitors: test.monitors,
+			mounter:  &failingMounter{failSources: test.fail},
+		}
+		if err := cephfs.SetUp(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if _, err := os.Stat(cephfs.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no volume path, got %v", test.name, err)
+		}
+	}
+}
+
+func TestCephFSSetUpTearDownUnmounted(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "CephFSSetUpTearDownUnmounted")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &FakeMounter{}
+	cephfs := &CephFS{Name: "data", PodID: "my-id", RootDir: tempDir, Monitors: []string{"10.0.0.1"}, mounter: mounter}
+	// A directory left behind, say by a kubelet restart, is not a mount.
+	if err := os.MkdirAll(cephfs.GetPath(), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cephfs.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mounter.Unmounts) != 0 {
+		t.Errorf("Expected no unmounts of an unmounted volume, got %v", mounter.Unmounts)
+	}
+	if err := os.MkdirAll(cephfs.GetPath(), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cephfs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cephfs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"ceph:" + cephfs.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, mounter.Mounts)
+	}
+}
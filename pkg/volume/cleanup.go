@@ -0,0 +1,174 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/golang/glog"
+)
+
+// UnmountAllError reports the volumes UnmountAll or CleanupOrphanedPDs could
+// not tear down.
+type UnmountAllError struct {
+	// Failed maps the identifiers of the volumes that weren't torn down,
+	// as returned by CurrentVolume.Identifier, or the global mount paths of
+	// the disks that weren't detached, to why.
+	Failed map[string]error
+	// ScanErr, if set, describes the parts of the volume tree that couldn't
+	// be scanned, whose volumes may not have been torn down either.
+	ScanErr error
+}
+
+func (e *UnmountAllError) Error() string {
+	var msgs []string
+	for identifier, err := range e.Failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", identifier, err))
+	}
+	sort.Strings(msgs)
+	if e.ScanErr != nil {
+		msgs = append(msgs, e.ScanErr.Error())
+	}
+	return fmt.Sprintf("%d volume(s) could not be torn down: %s", len(e.Failed), strings.Join(msgs, "; "))
+}
+
+// UnmountAll tears down every volume found under rootDir, as when the node is
+// being decommissioned. A volume failing to tear down doesn't stop the
+// others; the failures are returned in an *UnmountAllError. Each volume's
+// TearDown only detaches a disk once no other volume on the host uses it.
+func UnmountAll(rootDir string) error {
+	currentVolumes, scanErr := GetCurrentVolumes(rootDir)
+	failed := map[string]error{}
+	for _, vol := range currentVolumes {
+		if err := TearDownWithEvents(vol.Cleaner, vol.PodID, vol.Name); err != nil {
+			failed[vol.Identifier()] = err
+		}
+	}
+	if len(failed) > 0 || scanErr != nil {
+		return &UnmountAllError{Failed: failed, ScanErr: scanErr}
+	}
+	return nil
+}
+
+// CleanupOrphanedPDs tears down the GCE persistent disk volumes of current,
+// as returned by GetCurrentVolumes, whose identifiers aren't in desired. It
+// then detaches the disks still mounted globally under rootDir that no
+// volume uses, as left behind when the kubelet crashes between tearing down
+// a disk's last volume and detaching the disk. Nothing else detaches those,
+// and each holds one of the instance's limited disk attachments. A failure
+// doesn't stop the cleanup of the other disks; the failures are returned in
+// an *UnmountAllError.
+func CleanupOrphanedPDs(rootDir string, desired util.StringSet, current []CurrentVolume) error {
+	return cleanupOrphanedPDs(rootDir, desired, current, newMounter(), &GCEDiskUtil{})
+}
+
+func cleanupOrphanedPDs(rootDir string, desired util.StringSet, current []CurrentVolume, m mounter, pdUtil gcePersistentDiskUtil) error {
+	failed := map[string]error{}
+	for _, vol := range current {
+		if vol.Kind != KindGCEPersistentDisk || desired.Has(vol.Identifier()) {
+			continue
+		}
+		glog.Infof("Orphaned %s volume %s found, tearing down volume", vol.Kind, vol.Identifier())
+		if err := TearDownWithEvents(vol.Cleaner, vol.PodID, vol.Name); err != nil {
+			failed[vol.Identifier()] = err
+		}
+	}
+	globalDir := makeGlobalPDName(rootDir, "", "")
+	entries, err := ioutil.ReadDir(globalDir)
+	if err != nil && !os.IsNotExist(err) {
+		failed[globalDir] = err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		globalPDPaths, err := globalPDPathsOf(m, path.Join(globalDir, entry.Name()))
+		if err != nil {
+			failed[path.Join(globalDir, entry.Name())] = err
+		}
+		for _, globalPDPath := range globalPDPaths {
+			if err := detachOrphanedPD(rootDir, globalPDPath, m, pdUtil); err != nil {
+				failed[globalPDPath] = err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &UnmountAllError{Failed: failed}
+	}
+	return nil
+}
+
+// globalPDPathsOf returns the global paths a disk may be mounted at: diskPath
+// for the whole disk, or, if the whole disk isn't mounted there, the
+// directories below it for its partitions.
+func globalPDPathsOf(m mounter, diskPath string) ([]string, error) {
+	mounted, err := m.IsMountPoint(diskPath)
+	if err != nil {
+		return nil, err
+	}
+	if mounted {
+		return []string{diskPath}, nil
+	}
+	paths := []string{diskPath}
+	entries, err := ioutil.ReadDir(diskPath)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			paths = append(paths, path.Join(diskPath, entry.Name()))
+		}
+	}
+	return paths, err
+}
+
+// detachOrphanedPD unmounts the disk mounted at globalPDPath and detaches it,
+// unless a volume's bind mount of the disk still references its device. A
+// global path with nothing mounted is left alone, as whether its disk is
+// still attached can't be told from the host.
+func detachOrphanedPD(rootDir, globalPDPath string, m mounter, pdUtil gcePersistentDiskUtil) error {
+	diskName, partition := parseGlobalPDName(rootDir, globalPDPath)
+	if diskName == "" {
+		return fmt.Errorf("%s is not a global PD path", globalPDPath)
+	}
+	// A SetUp of the disk between counting and detaching would lose its disk.
+	pdLocks.Lock(diskName)
+	defer pdLocks.Unlock(diskName)
+	devicePath, refCount, err := m.RefCount(globalMount(globalPDPath))
+	if errors.Is(err, errNotMountPoint) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if refCount > 1 {
+		return nil
+	}
+	glog.Infof("Disk %s is mounted at %s but used by no volume, detaching it", diskName, globalPDPath)
+	PD := &GCEPersistentDisk{
+		RootDir:    rootDir,
+		PDName:     diskName,
+		Partition:  partition,
+		SkipDetach: loadSkipPDDetach(),
+		mounter:    m,
+	}
+	return pdUtil.DetachDisk(PD, devicePath)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+)
+
+func TestUnmountAll(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "UnmountAll")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	for _, dir := range []string{
+		"pod-a/volumes/empty/cache",
+		"pod-a/volumes/empty/old.deleting~123",
+		"pod-b/volumes/empty/data",
+	} {
+		if err := os.MkdirAll(path.Join(tempDir, dir), 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := UnmountAll(tempDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, dir := range []string{"pod-a/volumes/empty/cache", "pod-b/volumes/empty/data"} {
+		if _, err := os.Stat(path.Join(tempDir, dir)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be torn down, got %v", dir, err)
+		}
+	}
+	// Directories of interrupted TearDowns aren't volumes.
+	if _, err := os.Stat(path.Join(tempDir, "pod-a/volumes/empty/old.deleting~123")); err != nil {
+		t.Errorf("Expected the deleting directory to be skipped, got %v", err)
+	}
+}
+
+func TestUnmountAllScanError(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "UnmountAllScanError")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	for _, dir := range []string{"pod-a/volumes/tape/backup", "pod-a/volumes/empty/cache"} {
+		if err := os.MkdirAll(path.Join(tempDir, dir), 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	err = UnmountAll(tempDir)
+	unmountErr, ok := err.(*UnmountAllError)
+	if !ok || unmountErr.ScanErr == nil || len(unmountErr.Failed) != 0 {
+		t.Fatalf("Expected an *UnmountAllError for the scan only, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(tempDir, "pod-a/volumes/empty/cache")); !os.IsNotExist(err) {
+		t.Errorf("Expected the volumes found to be torn down, got %v", err)
+	}
+}
+
+func TestUnmountAllErrorMessage(t *testing.T) {
+	err := &UnmountAllError{Failed: map[string]error{
+		"pod-b/data":  os.ErrPermission,
+		"pod-a/cache": os.ErrExist,
+	}}
+	expected := "2 volume(s) could not be torn down: pod-a/cache: file already exists; pod-b/data: permission denied"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestCleanupOrphanedPDs(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "CleanupOrphanedPDs")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	pdUtil := &FakeGCEPersistentDiskUtil{}
+	var current []CurrentVolume
+	for _, podID := range []string{"pod-a", "pod-b"} {
+		// The pods' bind mounts are gone; only their directories are left.
+		PD := &GCEPersistentDisk{Name: "data", PodID: podID, RootDir: tempDir, util: pdUtil, mounter: &FakeMounter{RefErr: errNotMountPoint}}
+		if err := os.MkdirAll(PD.GetPath(), 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		current = append(current, CurrentVolume{PodID: podID, Kind: KindGCEPersistentDisk, Name: "data", Cleaner: PD})
+	}
+	orphan := makeGlobalPDName(tempDir, "orphan-pd", "")
+	if err := os.MkdirAll(orphan, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter := &FakeMounter{Device: "/dev/sdb", Refs: 1}
+
+	err = cleanupOrphanedPDs(tempDir, util.NewStringSet("pod-b/data"), current, mounter, pdUtil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(current[0].Cleaner.(*GCEPersistentDisk).GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the orphaned volume to be torn down, got %v", err)
+	}
+	if _, err := os.Stat(current[1].Cleaner.(*GCEPersistentDisk).GetPath()); err != nil {
+		t.Errorf("Expected the desired volume to be left alone, got %v", err)
+	}
+	if !reflect.DeepEqual(pdUtil.DetachedDevices, []string{"/dev/sdb"}) {
+		t.Errorf("Expected the globally mounted disk to be detached, got %v", pdUtil.DetachedDevices)
+	}
+
+	// A disk a volume still bind mounts stays attached.
+	pdUtil.DetachedDevices = nil
+	mounter.Refs = 2
+	if err := cleanupOrphanedPDs(tempDir, util.NewStringSet(), nil, mounter, pdUtil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pdUtil.DetachedDevices) != 0 {
+		t.Errorf("Expected a disk in use to stay attached, got %v", pdUtil.DetachedDevices)
+	}
+}
+
+func TestGlobalPDPathsOf(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GlobalPDPathsOf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	diskPath := makeGlobalPDName(tempDir, "my-pd", "")
+	partitionPath := makeGlobalPDName(tempDir, "my-pd", "1")
+	if err := os.MkdirAll(partitionPath, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter := &FakeMounter{}
+	paths, err := globalPDPathsOf(mounter, diskPath)
+	if expected := []string{diskPath, partitionPath}; err != nil || !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, paths, err)
+	}
+	// The directories of a mounted whole disk are its contents.
+	mounter.MountPoints = map[string]bool{diskPath: true}
+	paths, err = globalPDPathsOf(mounter, diskPath)
+	if expected := []string{diskPath}; err != nil || !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, paths, err)
+	}
+	if name, partition := parseGlobalPDName(tempDir, partitionPath); name != "my-pd" || partition != "1" {
+		t.Errorf("Expected my-pd partition 1, got %s partition %q", name, partition)
+	}
+}
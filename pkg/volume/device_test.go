@@ -0,0 +1,47 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForDevice(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "WaitForDevice")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	devicePath := path.Join(tempDir, "google-my-pd")
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		ioutil.WriteFile(devicePath, nil, 0600)
+	}()
+	if err := waitForDevice(devicePath, time.Second, time.Millisecond); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err = waitForDevice(path.Join(tempDir, "google-missing-pd"), 5*time.Millisecond, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"path"
+	"sync"
+)
+
+// Operations reported to an EventRecorder.
+const (
+	OperationSetUp    = "SetUp"
+	OperationTearDown = "TearDown"
+)
+
+// EventPhase is the outcome of an operation an event is recorded for.
+type EventPhase string
+
+const (
+	EventSucceeded EventPhase = "Succeeded"
+	EventFailed    EventPhase = "Failed"
+)
+
+// EventRecorder is notified when setting up or tearing down a volume of a pod
+// fails, or succeeds where it last failed or was a different operation. The
+// kubelet implements it to emit events.
+type EventRecorder interface {
+	// RecordVolumeEvent is called with the outcome of operation on the
+	// volume. err is only set for EventFailed.
+	RecordVolumeEvent(podID, volumeName, operation string, phase EventPhase, err error)
+}
+
+var (
+	// eventRecorder is notified by SetUpWithEvents and TearDownWithEvents.
+	eventRecorder EventRecorder
+	// lastEvents holds the last operation that succeeded on each volume,
+	// keyed by pod ID and volume name, so that a SetUp repeated on every
+	// sync is only reported once.
+	lastEvents     = map[string]string{}
+	lastEventsLock sync.Mutex
+)
+
+// SetEventRecorder sets the recorder volume operations are reported to.
+// Passing nil stops reporting them.
+func SetEventRecorder(recorder EventRecorder) {
+	lastEventsLock.Lock()
+	defer lastEventsLock.Unlock()
+	eventRecorder = recorder
+	lastEvents = map[string]string{}
+}
+
+// SetUpWithEvents sets up builder, the volume volumeName of pod podID,
+// reporting the operation to the event recorder, if any.
+func SetUpWithEvents(builder Builder, podID, volumeName string) error {
+	return withEvents(podID, volumeName, OperationSetUp, builder.SetUp)
+}
+
+// TearDownWithEvents tears down cleaner, the volume volumeName of pod podID,
+// reporting the operation to the event recorder, if any.
+func TearDownWithEvents(cleaner Cleaner, podID, volumeName string) error {
+	return withEvents(podID, volumeName, OperationTearDown, cleaner.TearDown)
+}
+
+func withEvents(podID, volumeName, operation string, op func() error) error {
+	err := op()
+	if recorder, phase, ok := shouldRecord(podID, volumeName, operation, err); ok {
+		recorder.RecordVolumeEvent(podID, volumeName, operation, phase, err)
+	}
+	return err
+}
+
+// shouldRecord returns the recorder to report the outcome of operation on
+// the volume to, and false if there is none or the outcome was reported
+// already.
+func shouldRecord(podID, volumeName, operation string, err error) (EventRecorder, EventPhase, bool) {
+	lastEventsLock.Lock()
+	defer lastEventsLock.Unlock()
+	if eventRecorder == nil {
+		return nil, "", false
+	}
+	key := path.Join(podID, volumeName)
+	if err != nil {
+		delete(lastEvents, key)
+		return eventRecorder, EventFailed, true
+	}
+	if lastEvents[key] == operation {
+		return nil, "", false
+	}
+	if operation == OperationTearDown {
+		// The volume is gone, so nothing more is reported for it.
+		delete(lastEvents, key)
+	} else {
+		lastEvents[key] = operation
+	}
+	return eventRecorder, EventSucceeded, true
+}
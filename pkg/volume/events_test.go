@@ -0,0 +1,110 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type recordedEvent struct {
+	podID, volumeName, operation string
+	phase                        EventPhase
+	err                          error
+}
+
+type fakeEventRecorder struct {
+	events []recordedEvent
+}
+
+func (f *fakeEventRecorder) RecordVolumeEvent(podID, volumeName, operation string, phase EventPhase, err error) {
+	f.events = append(f.events, recordedEvent{podID, volumeName, operation, phase, err})
+}
+
+type fakeVolume struct {
+	err error
+}
+
+func (f *fakeVolume) GetPath() string { return "" }
+func (f *fakeVolume) SetUp() error    { return f.err }
+func (f *fakeVolume) TearDown() error { return f.err }
+
+func TestSetUpWithEvents(t *testing.T) {
+	recorder := &fakeEventRecorder{}
+	SetEventRecorder(recorder)
+	defer SetEventRecorder(nil)
+
+	// The kubelet sets up every volume on each sync; only the first success,
+	// and any failure, is reported.
+	failure := errors.New("mount failed")
+	for _, err := range []error{nil, nil, failure, failure, nil, nil} {
+		if result := SetUpWithEvents(&fakeVolume{err: err}, "my-pod", "data"); result != err {
+			t.Fatalf("Expected %v, got %v", err, result)
+		}
+	}
+	if err := SetUpWithEvents(&fakeVolume{}, "other-pod", "data"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []recordedEvent{
+		{"my-pod", "data", OperationSetUp, EventSucceeded, nil},
+		{"my-pod", "data", OperationSetUp, EventFailed, failure},
+		{"my-pod", "data", OperationSetUp, EventFailed, failure},
+		{"my-pod", "data", OperationSetUp, EventSucceeded, nil},
+		{"other-pod", "data", OperationSetUp, EventSucceeded, nil},
+	}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, recorder.events)
+	}
+}
+
+func TestTearDownWithEvents(t *testing.T) {
+	recorder := &fakeEventRecorder{}
+	SetEventRecorder(recorder)
+	defer SetEventRecorder(nil)
+
+	failure := errors.New("device busy")
+	if err := SetUpWithEvents(&fakeVolume{}, "my-pod", "data"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := TearDownWithEvents(&fakeVolume{err: failure}, "my-pod", "data"); err != failure {
+		t.Fatalf("Expected %v, got %v", failure, err)
+	}
+	if err := TearDownWithEvents(&fakeVolume{}, "my-pod", "data"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A volume set up again after being torn down is reported again.
+	if err := SetUpWithEvents(&fakeVolume{}, "my-pod", "data"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []recordedEvent{
+		{"my-pod", "data", OperationSetUp, EventSucceeded, nil},
+		{"my-pod", "data", OperationTearDown, EventFailed, failure},
+		{"my-pod", "data", OperationTearDown, EventSucceeded, nil},
+		{"my-pod", "data", OperationSetUp, EventSucceeded, nil},
+	}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, recorder.events)
+	}
+}
+
+func TestWithEventsNoRecorder(t *testing.T) {
+	failure := errors.New("mount failed")
+	if err := SetUpWithEvents(&fakeVolume{err: failure}, "my-pod", "data"); err != failure {
+		t.Errorf("Expected %v, got %v", failure, err)
+	}
+}
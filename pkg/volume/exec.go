@@ -0,0 +1,55 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// commandRunner runs commands on the host. It is replaced in tests.
+type commandRunner interface {
+	// Run executes cmd and returns its combined output. A command that
+	// exits non-zero returns a *commandExitError.
+	Run(cmd string, args ...string) ([]byte, error)
+}
+
+// commandExitError reports a command that ran but exited non-zero.
+type commandExitError struct {
+	Cmd        string
+	ExitStatus int
+	Output     []byte
+}
+
+func (e *commandExitError) Error() string {
+	return fmt.Sprintf("%s exited with status %d: %s", e.Cmd, e.ExitStatus, strings.TrimSpace(string(e.Output)))
+}
+
+// execRunner implements commandRunner with os/exec.
+type execRunner struct{}
+
+func (r *execRunner) Run(cmd string, args ...string) ([]byte, error) {
+	output, err := exec.Command(cmd, args...).CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return output, &commandExitError{Cmd: cmd, ExitStatus: status.ExitStatus(), Output: output}
+		}
+	}
+	return output, err
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+// FakeMounter is a mounter for tests that records the mounts and unmounts it
+// is asked to do instead of making them.
+type FakeMounter struct {
+	// Mounts records each mount as "fstype:target".
+	Mounts []string
+	// MountFlags records the flags of each mount.
+	MountFlags []uintptr
+	// MountData records the data of each mount.
+	MountData []string
+	// Unmounts records the target of each unmount.
+	Unmounts []string
+	// UnmountFlags records the flags of each unmount.
+	UnmountFlags []int
+	// UnmountErrs are returned by successive unmounts, then nil.
+	UnmountErrs []error
+	// MountErrs are returned by successive mounts, then nil.
+	MountErrs []error
+	// MountPoints are the targets IsMountPoint reports as mounted. A
+	// successful mount adds its target and a successful unmount removes it.
+	MountPoints map[string]bool
+	// Device, Refs and RefErr are returned by RefCount.
+	Device string
+	Refs   int
+	RefErr error
+}
+
+func (f *FakeMounter) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	f.Mounts = append(f.Mounts, fstype+":"+target)
+	f.MountFlags = append(f.MountFlags, flags)
+	f.MountData = append(f.MountData, data)
+	if len(f.MountErrs) > 0 {
+		err := f.MountErrs[0]
+		f.MountErrs = f.MountErrs[1:]
+		return err
+	}
+	if f.MountPoints == nil {
+		f.MountPoints = map[string]bool{}
+	}
+	f.MountPoints[target] = true
+	return nil
+}
+
+func (f *FakeMounter) Unmount(target string, flags int) error {
+	f.Unmounts = append(f.Unmounts, target)
+	f.UnmountFlags = append(f.UnmountFlags, flags)
+	if len(f.UnmountErrs) > 0 {
+		err := f.UnmountErrs[0]
+		f.UnmountErrs = f.UnmountErrs[1:]
+		return err
+	}
+	delete(f.MountPoints, target)
+	return nil
+}
+
+func (f *FakeMounter) RefCount(vol Interface) (string, int, error) {
+	return f.Device, f.Refs, f.RefErr
+}
+
+func (f *FakeMounter) IsMountPoint(file string) (bool, error) {
+	return f.MountPoints[file], nil
+}
+
+// FakeGCEPersistentDiskUtil is a gcePersistentDiskUtil for tests that records
+// the provider calls it is asked to make instead of making them.
+type FakeGCEPersistentDiskUtil struct {
+	// Calls records each call: "create", "attach", "mount" or "detach".
+	Calls []string
+	// DetachedDevices records the device path of each detach.
+	DetachedDevices []string
+	// CreateErr is returned by CreateDisk.
+	CreateErr error
+	// MountErrs are returned by successive MountDisk calls, then nil.
+	MountErrs []error
+	// DetachErr is returned by DetachDisk.
+	DetachErr error
+}
+
+func (f *FakeGCEPersistentDiskUtil) CreateDisk(PD *GCEPersistentDisk) error {
+	f.Calls = append(f.Calls, "create")
+	return f.CreateErr
+}
+
+func (f *FakeGCEPersistentDiskUtil) AttachDisk(PD *GCEPersistentDisk) error {
+	f.Calls = append(f.Calls, "attach")
+	return nil
+}
+
+func (f *FakeGCEPersistentDiskUtil) MountDisk(PD *GCEPersistentDisk) error {
+	f.Calls = append(f.Calls, "mount")
+	if len(f.MountErrs) > 0 {
+		err := f.MountErrs[0]
+		f.MountErrs = f.MountErrs[1:]
+		return err
+	}
+	return nil
+}
+
+func (f *FakeGCEPersistentDiskUtil) DetachDisk(PD *GCEPersistentDisk, devicePath string) error {
+	f.Calls = append(f.Calls, "detach")
+	f.DetachedDevices = append(f.DetachedDevices, devicePath)
+	return f.DetachErr
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"os"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// FlockerClient asks the Flocker control service where datasets are.
+type FlockerClient interface {
+	// GetDatasetPath returns the path on this host the named dataset is
+	// mounted at. It fails if the dataset isn't available on this host.
+	GetDatasetPath(datasetName string) (string, error)
+}
+
+// flockerClient resolves the datasets of Flocker volumes.
+var flockerClient FlockerClient
+
+// SetFlockerClient sets how Flocker volumes find their datasets. Until it is
+// called, setting up a Flocker volume fails.
+func SetFlockerClient(client FlockerClient) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	flockerClient = client
+}
+
+func loadFlockerClient() FlockerClient {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return flockerClient
+}
+
+// Flocker volumes are datasets that Flocker has mounted on the host, bind
+// mounted into the pod.
+type Flocker struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Name of the dataset.
+	DatasetName string
+	// Source of the datasets' paths.
+	client FlockerClient
+	// Mounter interface that provides system calls to mount the volume.
+	mounter mounter
+}
+
+func (flocker *Flocker) GetPath() string {
+	return VolumeHost{RootDir: flocker.RootDir}.PodVolumeDir(flocker.PodID, KindFlocker, flocker.Name)
+}
+
+// Bind mounts the dataset from where Flocker mounted it.
+func (flocker *Flocker) SetUp() error {
+	mountpoint, err := flocker.mounter.IsMountPoint(flocker.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if flocker.client == nil {
+		return errors.New("no Flocker control service is configured for Flocker volumes")
+	}
+	datasetPath, err := flocker.client.GetDatasetPath(flocker.DatasetName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(flocker.GetPath(), 0750); err != nil {
+		return err
+	}
+	return mountNew(flocker.mounter, datasetPath, flocker.GetPath(), "", MOUNT_MS_BIND, "")
+}
+
+// Unmounts the bind mount and removes its directory. The dataset stays
+// mounted on the host; Flocker decides when to move or unmount it.
+func (flocker *Flocker) TearDown() error {
+	mountpoint, err := flocker.mounter.IsMountPoint(flocker.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(flocker.mounter, flocker.GetPath(), true); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(flocker.GetPath())
+}
+
+// Interprets API volume as a Flocker dataset
+func createFlocker(volume *api.Volume, podID string, rootDir string) *Flocker {
+	return &Flocker{
+		Name:        volume.Name,
+		PodID:       podID,
+		RootDir:     rootDir,
+		DatasetName: volume.Source.Flocker.DatasetName,
+		client:      loadFlockerClient(),
+		mounter:     newMounter(),
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// fakeFlockerClient maps dataset names to the paths Flocker mounted them at.
+type fakeFlockerClient map[string]string
+
+func (f fakeFlockerClient) GetDatasetPath(datasetName string) (string, error) {
+	datasetPath, found := f[datasetName]
+	if !found {
+		return "", fmt.Errorf("dataset %q is not on this host", datasetName)
+	}
+	return datasetPath, nil
+}
+
+func TestFlockerSetUpTearDown(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "FlockerSetUpTearDown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &failingMounter{}
+	flocker := &Flocker{
+		Name:        "data",
+		PodID:       "my-id",
+		RootDir:     tempDir,
+		DatasetName: "my-dataset",
+		client:      fakeFlockerClient{"my-dataset": "/flocker/8c4a7e2b"},
+		mounter:     mounter,
+	}
+	if err := flocker.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"/flocker/8c4a7e2b"}; !reflect.DeepEqual(mounter.sources, expected) {
+		t.Errorf("Expected mounts from %v, got %v", expected, mounter.sources)
+	}
+	if expected := []string{":" + flocker.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, mounter.Mounts)
+	}
+	if err := flocker.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{flocker.GetPath()}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+		t.Errorf("Expected unmounts %v, got %v", expected, mounter.Unmounts)
+	}
+	if _, err := os.Stat(flocker.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the volume path to be removed, got %v", err)
+	}
+}
+
+func TestFlockerSetUpFailures(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "FlockerSetUpFailures")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		name   string
+		client FlockerClient
+		fail   map[string]bool
+	}{
+		{name: "no client"},
+		{name: "missing", client: fakeFlockerClient{}},
+		{name: "unmountable", client: fakeFlockerClient{"my-dataset": "/flocker/8c4a7e2b"}, fail: map[string]bool{"/flocker/8c4a7e2b": true}},
+	}
+	for _, test := range tests {
+		flocker := &Flocker{
+			Name:        test.name,
+			PodID:       "my-id",
+			RootDir:     tempDir,
+			DatasetName: "my-dataset",
+			client:      test.client,
+			mounter:     &failingMounter{failSources: test.fail},
+		}
+		if err := flocker.SetUp(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if _, err := os.Stat(flocker.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no volume path, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"github.com/golang/glog"
+)
+
+// defaultFSType is used to format disks whose volume does not specify one.
+// The type is never left to the kernel to detect, since it can guess wrong.
+const defaultFSType = "ext4"
+
+// blkid exits with this status when it finds no signature on the device.
+const blkidNoSignature = 2
+
+// formatIfNeeded creates a filesystem of type fstype on devicePath, but only
+// when blkid positively reports the device carries no filesystem or
+// partition table. Any other outcome, including blkid failing, leaves the
+// device untouched so that data can never be destroyed by a bad probe.
+func formatIfNeeded(runner commandRunner, devicePath, fstype string) error {
+	if fstype == "" {
+		fstype = defaultFSType
+	}
+	_, err := runner.Run("blkid", "-p", "-o", "export", devicePath)
+	if err == nil {
+		// blkid found a signature, the device is already formatted.
+		return nil
+	}
+	exitErr, ok := err.(*commandExitError)
+	if !ok || exitErr.ExitStatus != blkidNoSignature {
+		return err
+	}
+	args := []string{"-t", fstype}
+	if fstype == "ext3" || fstype == "ext4" {
+		// Don't prompt when formatting a whole disk rather than a partition.
+		args = append(args, "-F")
+	}
+	args = append(args, devicePath)
+	glog.Infof("Formatting empty device %s as %s", devicePath, fstype)
+	_, err = runner.Run("mkfs", args...)
+	return err
+}
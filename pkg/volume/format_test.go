@@ -0,0 +1,88 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records commands and returns canned outputs and results keyed by
+// command name.
+type fakeRunner struct {
+	commands []string
+	outputs  map[string]string
+	results  map[string]error
+}
+
+func (f *fakeRunner) Run(cmd string, args ...string) ([]byte, error) {
+	f.commands = append(f.commands, strings.Join(append([]string{cmd}, args...), " "))
+	return []byte(f.outputs[cmd]), f.results[cmd]
+}
+
+func TestFormatIfNeeded(t *testing.T) {
+	tests := []struct {
+		name     string
+		fstype   string
+		blkidErr error
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "empty device is formatted with the default type",
+			blkidErr: &commandExitError{Cmd: "blkid", ExitStatus: blkidNoSignature},
+			expected: []string{"blkid -p -o export /dev/sdb", "mkfs -t ext4 -F /dev/sdb"},
+		},
+		{
+			name:     "empty device is formatted with the requested type",
+			fstype:   "xfs",
+			blkidErr: &commandExitError{Cmd: "blkid", ExitStatus: blkidNoSignature},
+			expected: []string{"blkid -p -o export /dev/sdb", "mkfs -t xfs /dev/sdb"},
+		},
+		{
+			name:     "formatted device is left alone",
+			expected: []string{"blkid -p -o export /dev/sdb"},
+		},
+		{
+			name:     "blkid failure is not treated as empty",
+			blkidErr: &commandExitError{Cmd: "blkid", ExitStatus: 4},
+			expected: []string{"blkid -p -o export /dev/sdb"},
+			wantErr:  true,
+		},
+		{
+			name:     "blkid missing is not treated as empty",
+			blkidErr: errors.New("executable file not found"),
+			expected: []string{"blkid -p -o export /dev/sdb"},
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		runner := &fakeRunner{results: map[string]error{"blkid": test.blkidErr}}
+		err := formatIfNeeded(runner, "/dev/sdb", test.fstype)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(runner.commands, test.expected) {
+			t.Errorf("%s: expected commands %v, got %v", test.name, test.expected, runner.commands)
+		}
+	}
+}
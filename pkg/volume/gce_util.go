@@ -0,0 +1,228 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+	gce_cloud "github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider/gce"
+	"github.com/golang/glog"
+)
+
+// GCE symlinks attached disks as /dev/disk/by-id/google-<name>[-part<N>].
+var gceDevicePathRE = regexp.MustCompile(`^/dev/disk/by-id/google-(.+?)(?:-part([0-9]+))?$`)
+
+// How long to wait for the device of an attached disk to appear, then for the
+// device of its partition, and how often to check. Variables so tests can
+// shorten them.
+var (
+	gceDeviceWaitTimeout    = 10 * time.Second
+	gcePartitionWaitTimeout = 2 * time.Second
+	gceDeviceWaitInterval   = time.Second
+)
+
+type GCEDiskUtil struct{}
+
+func getGCECloud() (*gce_cloud.GCECloud, error) {
+	cloud, err := cloudprovider.GetCloudProvider("gce")
+	if err != nil {
+		return nil, err
+	}
+	gce, ok := cloud.(*gce_cloud.GCECloud)
+	if !ok {
+		return nil, errors.New("GCE cloud provider is not available")
+	}
+	return gce, nil
+}
+
+// Creates the disk specified by a volume.GCEPersistentDisk in the current zone.
+func (util *GCEDiskUtil) CreateDisk(GCEPD *GCEPersistentDisk) error {
+	gce, err := getGCECloud()
+	if err != nil {
+		return err
+	}
+	return gce.CreateDisk(GCEPD.PDName, GCEPD.SizeGB, GCEPD.DiskType)
+}
+
+// Attaches a disk specified by a volume.GCEPersistentDisk to the current kubelet.
+func (util *GCEDiskUtil) AttachDisk(GCEPD *GCEPersistentDisk) error {
+	gce, err := getGCECloud()
+	if err != nil {
+		return err
+	}
+	return gce.AttachDisk(GCEPD.PDName, GCEPD.ReadOnly)
+}
+
+// gceDevicePath returns the device of the given partition of the named disk,
+// or of the whole disk if partition is empty.
+func gceDevicePath(pdName, partition string) string {
+	devicePath := path.Join("/dev/disk/by-id/", "google-"+pdName)
+	if partition != "" {
+		devicePath += "-part" + partition
+	}
+	return devicePath
+}
+
+// waitForPartition waits for diskPath, the device of an attached disk, and
+// then for partitionPath, the device of the partition to mount, if that is
+// different. udev links a disk's partitions right after the disk, so one
+// still missing shortly after is reported as not existing rather than as a
+// timeout.
+func waitForPartition(diskPath, partitionPath string) error {
+	if err := waitForDevice(diskPath, gceDeviceWaitTimeout, gceDeviceWaitInterval); err != nil {
+		return err
+	}
+	if partitionPath == diskPath {
+		return nil
+	}
+	if err := waitForDevice(partitionPath, gcePartitionWaitTimeout, gceDeviceWaitInterval); err != nil {
+		return fmt.Errorf("partition %s of disk %s does not exist", partitionPath, diskPath)
+	}
+	return nil
+}
+
+// Waits for the device of a disk attached by AttachDisk and mounts the disk to
+// its global path, formatting it first if it is empty.
+func (util *GCEDiskUtil) MountDisk(GCEPD *GCEPersistentDisk) error {
+	gce, err := getGCECloud()
+	if err != nil {
+		return err
+	}
+	flags := uintptr(0)
+	if GCEPD.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	devicePath := gceDevicePath(GCEPD.PDName, GCEPD.Partition)
+	if err := waitForPartition(gceDevicePath(GCEPD.PDName, ""), devicePath); err != nil {
+		return err
+	}
+	if labels, err := gce.GetDiskLabels(GCEPD.PDName); err != nil {
+		glog.Warningf("Could not read labels of disk %s, skipping tuning: %v", GCEPD.PDName, err)
+	} else {
+		// Queue settings belong to the whole disk, not the partition.
+		applyDiskTuning(GCEPD.sysfs, path.Join("/dev/disk/by-id/", "google-"+GCEPD.PDName), labels)
+	}
+	globalPDPath := makeGlobalPDName(GCEPD.RootDir, GCEPD.PDName, GCEPD.Partition)
+	// Only mount the PD globally once.
+	mounted, err := GCEPD.mounter.IsMountPoint(globalPDPath)
+	if err == nil && !mounted {
+		// A read-only attachment can't be formatted; the mount will
+		// fail below if the disk turns out to be empty.
+		if !GCEPD.ReadOnly {
+			if err := formatIfNeeded(GCEPD.runner, devicePath, GCEPD.FSType); err != nil {
+				return err
+			}
+		}
+		err = os.MkdirAll(globalPDPath, 0750)
+		if err != nil {
+			return err
+		}
+		fstype := GCEPD.FSType
+		if fstype == "" {
+			fstype = defaultFSType
+		}
+		data := ""
+		if GCEPD.SELinuxContext != "" {
+			// Bind mounts can't be relabeled, so the pod mounts inherit this label.
+			data = selinuxMountOption(GCEPD.SELinuxContext)
+		}
+		err = GCEPD.mounter.Mount(devicePath, globalPDPath, fstype, flags, data)
+		if err == nil && GCEPD.ReadOnly {
+			// Every pod's bind mount inherits a read-only global mount, so
+			// make sure it is one.
+			if err = checkReadOnly(globalPDPath); err != nil {
+				if unmountErr := GCEPD.mounter.Unmount(globalPDPath, 0); unmountErr != nil {
+					glog.Errorf("Failed to unmount %s: %v", globalPDPath, unmountErr)
+					return err
+				}
+			}
+		}
+		if err != nil {
+			os.Remove(globalPDPath)
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	// The disk may have been grown since it was formatted. A failed resize
+	// leaves the filesystem usable at its old size.
+	if !GCEPD.ReadOnly {
+		if err := resizeFSIfNeeded(GCEPD.runner, devicePath, globalPDPath, GCEPD.FSType); err != nil {
+			glog.Warningf("Could not grow the filesystem of disk %s: %v", GCEPD.PDName, err)
+		}
+	}
+	return nil
+}
+
+// getDiskName returns the PD name and partition from a GCE device path such
+// as /dev/disk/by-id/google-mydisk-part1.
+func getDiskName(devicePath string) (string, string, error) {
+	match := gceDevicePathRE.FindStringSubmatch(devicePath)
+	if match == nil {
+		return "", "", fmt.Errorf("unexpected GCE device path: %s", devicePath)
+	}
+	return match[1], match[2], nil
+}
+
+// Unmounts the device and detaches the disk from the kubelet's host machine.
+// Expects a GCE device path symlink. Ex: /dev/disk/by-id/google-mydisk-part1
+// The disk stays attached while other partitions of it are mounted.
+func (util *GCEDiskUtil) DetachDisk(GCEPD *GCEPersistentDisk, devicePath string) error {
+	diskName, partition := GCEPD.PDName, GCEPD.Partition
+	if diskName == "" {
+		var err error
+		diskName, partition, err = getDiskName(devicePath)
+		if err != nil {
+			return err
+		}
+	}
+	globalPDPath := makeGlobalPDName(GCEPD.RootDir, diskName, partition)
+	if err := unmountWithRetry(GCEPD.mounter, globalPDPath, false); err != nil {
+		return err
+	}
+	// Only the empty mount point is removed: the disk's own directory may
+	// hold the mount points of its other partitions.
+	if err := os.Remove(globalPDPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if partition != "" {
+		os.Remove(path.Dir(globalPDPath))
+	}
+	mounted, err := diskMountedGlobally(GCEPD.mounter, GCEPD.RootDir, diskName)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		glog.V(1).Infof("Other partitions of disk %s are in use, leaving it attached", diskName)
+		return nil
+	}
+	if GCEPD.SkipDetach {
+		glog.Warningf("Leaving disk %s attached to this host, detaching is disabled", diskName)
+		return nil
+	}
+	gce, err := getGCECloud()
+	if err != nil {
+		return err
+	}
+	return gce.DetachDisk(diskName)
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+// EndpointsGetter looks up the endpoints of a service by name. The etcd
+// registry implements it.
+type EndpointsGetter interface {
+	GetEndpoints(name string) (*api.Endpoints, error)
+}
+
+// glusterfsEndpoints resolves the servers of Glusterfs volumes.
+var glusterfsEndpoints EndpointsGetter
+
+// SetEndpointsGetter sets how Glusterfs volumes find their servers. Until it
+// is called, setting up a Glusterfs volume fails.
+func SetEndpointsGetter(getter EndpointsGetter) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	glusterfsEndpoints = getter
+}
+
+func loadEndpointsGetter() EndpointsGetter {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return glusterfsEndpoints
+}
+
+// Glusterfs volumes are mounted from a Glusterfs cluster whose servers are
+// the endpoints of a service.
+type Glusterfs struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Name of the endpoints object listing the cluster's servers.
+	EndpointsName string
+	// Name of the Glusterfs volume.
+	Path string
+	// Specifies whether the volume will be mounted ReadOnly.
+	ReadOnly bool
+	// MountOptions are added to the Glusterfs mount's options.
+	MountOptions []string
+	// Source of the cluster's endpoints.
+	endpoints EndpointsGetter
+	// Mounter interface that provides system calls to mount the volume.
+	mounter mounter
+}
+
+func (glusterfs *Glusterfs) GetPath() string {
+	return VolumeHost{RootDir: glusterfs.RootDir}.PodVolumeDir(glusterfs.PodID, KindGlusterfs, glusterfs.Name)
+}
+
+// Mounts the volume from the first server that accepts the mount, with the
+// others as backup volfile servers.
+func (glusterfs *Glusterfs) SetUp() error {
+	mountpoint, err := glusterfs.mounter.IsMountPoint(glusterfs.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	servers, err := glusterfs.servers()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(glusterfs.GetPath(), 0750); err != nil {
+		return err
+	}
+	flags := uintptr(0)
+	if glusterfs.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	for i, server := range servers {
+		var backups []string
+		backups = append(backups, servers[i+1:]...)
+		backups = append(backups, servers[:i]...)
+		var extra []string
+		if len(backups) > 0 {
+			extra = append(extra, "backup-volfile-servers="+strings.Join(backups, ":"))
+		}
+		optionFlags, data := parseMountOptions(glusterfs.MountOptions, extra...)
+		source := server + ":" + glusterfs.Path
+		err = glusterfs.mounter.Mount(source, glusterfs.GetPath(), "glusterfs", flags|optionFlags, data)
+		if err == nil {
+			return nil
+		}
+		glog.Warningf("Failed to mount Glusterfs volume %s from %s: %v", glusterfs.Path, server, err)
+	}
+	os.RemoveAll(glusterfs.GetPath())
+	return fmt.Errorf("mounting Glusterfs volume %s: no server accepted the mount: %v", glusterfs.Path, err)
+}
+
+// servers returns the distinct hosts of the volume's endpoints.
+func (glusterfs *Glusterfs) servers() ([]string, error) {
+	if glusterfs.endpoints == nil {
+		return nil, errors.New("no source of endpoints is configured for Glusterfs volumes")
+	}
+	endpoints, err := glusterfs.endpoints.GetEndpoints(glusterfs.EndpointsName)
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	seen := map[string]bool{}
+	for _, endpoint := range endpoints.Endpoints {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			// Endpoints without a port are just a host.
+			host = endpoint
+		}
+		if !seen[host] {
+			seen[host] = true
+			servers = append(servers, host)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("endpoints %q list no Glusterfs servers", glusterfs.EndpointsName)
+	}
+	return servers, nil
+}
+
+// Unmounts the volume and removes its directory.
+func (glusterfs *Glusterfs) TearDown() error {
+	mountpoint, err := glusterfs.mounter.IsMountPoint(glusterfs.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(glusterfs.mounter, glusterfs.GetPath(), true); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(glusterfs.GetPath())
+}
+
+// Interprets API volume as a Glusterfs volume
+func createGlusterfs(volume *api.Volume, podID string, rootDir string) *Glusterfs {
+	source := volume.Source.Glusterfs
+	return &Glusterfs{
+		Name:          volume.Name,
+		PodID:         podID,
+		RootDir:       rootDir,
+		EndpointsName: source.EndpointsName,
+		Path:          source.Path,
+		ReadOnly:      source.ReadOnly,
+		MountOptions:  volume.MountOptions,
+		endpoints:     loadEndpointsGetter(),
+		mounter:       newMounter(),
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+type fakeEndpoints map[string][]string
+
+func (f fakeEndpoints) GetEndpoints(name string) (*api.Endpoints, error) {
+	endpoints, found := f[name]
+	if !found {
+		return nil, errors.New("not found")
+	}
+	return &api.Endpoints{Endpoints: endpoints}, nil
+}
+
+// failingMounter fails mounts from the given sources.
+type failingMounter struct {
+	FakeMounter
+	failSources map[string]bool
+	sources     []string
+}
+
+func (f *failingMounter) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	f.sources = append(f.sources, source)
+	if f.failSources[source] {
+		return errors.New("connection refused")
+	}
+	return f.FakeMounter.Mount(source, target, fstype, flags, data)
+}
+
+func TestGlusterfsSetUpTearDown(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GlusterfsSetUpTearDown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	endpoints := fakeEndpoints{"cluster": {"10.0.0.1:24007", "10.0.0.2:24007", "10.0.0.1:24008", "10.0.0.3"}}
+	mounter := &failingMounter{failSources: map[string]bool{"10.0.0.1:kube_vol": true}}
+	glusterfs := &Glusterfs{
+		Name:          "data",
+		PodID:         "my-id",
+		RootDir:       tempDir,
+		EndpointsName: "cluster",
+		Path:          "kube_vol",
+		endpoints:     endpoints,
+		mounter:       mounter,
+	}
+	if err := glusterfs.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"10.0.0.1:kube_vol", "10.0.0.2:kube_vol"}; !reflect.DeepEqual(mounter.sources, expected) {
+		t.Errorf("Expected mounts from %v, got %v", expected, mounter.sources)
+	}
+	if expected := []string{"glusterfs:" + glusterfs.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, mounter.Mounts)
+	}
+	if expected := []string{"backup-volfile-servers=10.0.0.3:10.0.0.1"}; !reflect.DeepEqual(mounter.MountData, expected) {
+		t.Errorf("Expected mount data %v, got %v", expected, mounter.MountData)
+	}
+	if err := glusterfs.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{glusterfs.GetPath()}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+		t.Errorf("Expected unmounts %v, got %v", expected, mounter.Unmounts)
+	}
+	if _, err := os.Stat(glusterfs.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the volume path to be removed, got %v", err)
+	}
+}
+
+func TestGlusterfsSetUpFailures(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GlusterfsSetUpFailures")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		name      string
+		endpoints EndpointsGetter
+		fail      map[string]bool
+	}{
+		{name: "unconfigured"},
+		{name: "missing", endpoints: fakeEndpoints{}},
+		{name: "empty", endpoints: fakeEndpoints{"cluster": nil}},
+		{name: "down", endpoints: fakeEndpoints{"cluster": {"10.0.0.1:24007"}}, fail: map[string]bool{"10.0.0.1:kube_vol": true}},
+	}
+	for _, test := range tests {
+		glusterfs := &Glusterfs{
+			Name:          test.name,
+			PodID:         "my-id",
+			RootDir:       tempDir,
+			EndpointsName: "cluster",
+			Path:          "kube_vol",
+			endpoints:     test.endpoints,
+			mounter:       &failingMounter{failSources: test.fail},
+		}
+		if err := glusterfs.SetUp(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if _, err := os.Stat(glusterfs.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no volume path, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// VolumeInventoryEntry describes a volume found on the node. It is meant for
+// diagnosing nodes, not for driving decisions.
+type VolumeInventoryEntry struct {
+	PodID string `json:"podID"`
+	Name  string `json:"name"`
+	// Kind is the volume's directory under the pod's volumes, e.g. "gce-pd".
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	// Mounted is true if the volume's path is in the mount table.
+	Mounted bool   `json:"mounted"`
+	Device  string `json:"device,omitempty"`
+	FSType  string `json:"fsType,omitempty"`
+	// SizeBytes is the total size of the files in the volume.
+	SizeBytes int64 `json:"sizeBytes"`
+	// SizeError, if set, is why the volume couldn't be fully walked; SizeBytes
+	// then only counts the files that were reached.
+	SizeError string `json:"sizeError,omitempty"`
+	// Spec is the source reconstructed from what is on disk. Fields that
+	// can't be recovered are left empty.
+	Spec *api.VolumeSource `json:"spec,omitempty"`
+}
+
+// SnapshotVolumeInventory lists the volumes under rootDir found by
+// GetCurrentVolumes, with their state in the mount table. If parts of the
+// tree can't be scanned, the volumes that were found are returned along with
+// the *ScanError.
+func SnapshotVolumeInventory(rootDir string) ([]VolumeInventoryEntry, error) {
+	var mounts []mountEntry
+	file, err := os.Open("/proc/mounts")
+	if err == nil {
+		defer file.Close()
+		if mounts, err = parseMounts(file); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return snapshotVolumeInventory(rootDir, mounts)
+}
+
+func snapshotVolumeInventory(rootDir string, mounts []mountEntry) ([]VolumeInventoryEntry, error) {
+	var entries []VolumeInventoryEntry
+	currentVolumes, scanErr := GetCurrentVolumes(rootDir)
+	for _, current := range currentVolumes {
+		var entry VolumeInventoryEntry
+		var mount *mountEntry
+		switch vol := current.Cleaner.(type) {
+		case *EmptyDirectory:
+			entry = VolumeInventoryEntry{PodID: vol.PodID, Name: vol.Name, Kind: KindEmptyDirectory, Path: vol.GetPath()}
+			mount = findMount(mounts, entry.Path)
+			source := &api.EmptyDirectory{}
+			if mount != nil && mount.FSType == "tmpfs" {
+				source.Medium = api.StorageTypeMemory
+				source.SizeLimit = mountSizeOption(mount)
+			}
+			entry.Spec = &api.VolumeSource{EmptyDirectory: source}
+		case *RamDisk:
+			entry = VolumeInventoryEntry{PodID: vol.PodID, Name: vol.Name, Kind: KindRamDisk, Path: vol.GetPath()}
+			mount = findMount(mounts, entry.Path)
+			source := &api.RamDisk{}
+			if mount != nil {
+				source.SizeBytes = mountSizeOption(mount)
+			}
+			entry.Spec = &api.VolumeSource{RamDisk: source}
+		case *GCEPersistentDisk:
+			entry = VolumeInventoryEntry{PodID: vol.PodID, Name: vol.Name, Kind: KindGCEPersistentDisk, Path: vol.GetPath()}
+			mount = findMount(mounts, entry.Path)
+			source := &api.GCEPersistentDisk{}
+			if mount != nil {
+				source.PDName, source.Partition = globalPDName(mounts, rootDir, mount.Device)
+				source.FSType = mount.FSType
+				source.ReadOnly = hasMountOption(mount, "ro")
+			}
+			entry.Spec = &api.VolumeSource{GCEPersistentDisk: source}
+		default:
+			continue
+		}
+		if mount != nil {
+			entry.Mounted = true
+			entry.Device = mount.Device
+			entry.FSType = mount.FSType
+		}
+		// One volume that can't be walked mustn't hide all the others.
+		size, err := dirSize(entry.Path)
+		if err != nil {
+			entry.SizeError = err.Error()
+		}
+		entry.SizeBytes = size
+		entries = append(entries, entry)
+	}
+	sort.Sort(byPodAndName(entries))
+	return entries, scanErr
+}
+
+// WriteVolumeInventory writes entries to w as indented JSON.
+func WriteVolumeInventory(w io.Writer, entries []VolumeInventoryEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+type byPodAndName []VolumeInventoryEntry
+
+func (e byPodAndName) Len() int      { return len(e) }
+func (e byPodAndName) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byPodAndName) Less(i, j int) bool {
+	if e[i].PodID != e[j].PodID {
+		return e[i].PodID < e[j].PodID
+	}
+	return e[i].Name < e[j].Name
+}
+
+func findMount(mounts []mountEntry, mountPoint string) *mountEntry {
+	for i := range mounts {
+		if mounts[i].MountPoint == mountPoint {
+			return &mounts[i]
+		}
+	}
+	return nil
+}
+
+func hasMountOption(mount *mountEntry, option string) bool {
+	for _, opt := range mount.Options {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// mountSizeOption returns the size= option of a tmpfs mount in bytes, or 0.
+func mountSizeOption(mount *mountEntry) int64 {
+	for _, opt := range mount.Options {
+		if !strings.HasPrefix(opt, "size=") {
+			continue
+		}
+		value := strings.TrimPrefix(opt, "size=")
+		multiplier := int64(1)
+		switch {
+		case strings.HasSuffix(value, "k"):
+			multiplier = 1 << 10
+		case strings.HasSuffix(value, "m"):
+			multiplier = 1 << 20
+		case strings.HasSuffix(value, "g"):
+			multiplier = 1 << 30
+		}
+		value = strings.TrimRight(value, "kmg")
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0
+		}
+		return size * multiplier
+	}
+	return 0
+}
+
+// globalPDName returns the name and partition of the PD whose global mount
+// is on device. Bind mounts of a PD show the same device as its global mount.
+func globalPDName(mounts []mountEntry, rootDir, device string) (string, int) {
+	for _, mount := range mounts {
+		if mount.Device != device {
+			continue
+		}
+		if name, partition := parseGlobalPDName(rootDir, mount.MountPoint); name != "" {
+			number, _ := strconv.Atoi(partition)
+			return name, number
+		}
+	}
+	return "", 0
+}
+
+// globalMountName returns the name of the mount point under globalDir that
+// device is mounted on, or "" if there is none.
+func globalMountName(mounts []mountEntry, globalDir, device string) string {
+	for _, mount := range mounts {
+		if mount.Device == device && path.Dir(mount.MountPoint) == globalDir {
+			return path.Base(mount.MountPoint)
+		}
+	}
+	return ""
+}
+
+// dirSize returns the total size of the regular files under dir. A variable
+// so tests can replace it.
+var dirSize = func(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
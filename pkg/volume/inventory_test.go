@@ -0,0 +1,108 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func TestSnapshotVolumeInventory(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "SnapshotVolumeInventory")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	cacheDir := path.Join(tempDir, "pod-a", "volumes", "empty", "cache")
+	ramDiskDir := path.Join(tempDir, "pod-a", "volumes", "ramdisk", "scratch")
+	pdDir := path.Join(tempDir, "pod-b", "volumes", "gce-pd", "data")
+	for _, dir := range []string{cacheDir, ramDiskDir, pdDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(cacheDir, "file"), []byte("hello"), 0640); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounts := []mountEntry{
+		{Device: "tmpfs", MountPoint: ramDiskDir, FSType: "tmpfs", Options: []string{"rw", "size=1024k"}},
+		{Device: "/dev/sdb", MountPoint: makeGlobalPDName(tempDir, "my-pd", ""), FSType: "ext4", Options: []string{"rw"}},
+		{Device: "/dev/sdb", MountPoint: pdDir, FSType: "ext4", Options: []string{"ro"}},
+	}
+
+	entries, err := snapshotVolumeInventory(tempDir, mounts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []VolumeInventoryEntry{
+		{
+			PodID: "pod-a", Name: "cache", Kind: "empty", Path: cacheDir, SizeBytes: 5,
+			Spec: &api.VolumeSource{EmptyDirectory: &api.EmptyDirectory{}},
+		},
+		{
+			PodID: "pod-a", Name: "scratch", Kind: "ramdisk", Path: ramDiskDir,
+			Mounted: true, Device: "tmpfs", FSType: "tmpfs",
+			Spec: &api.VolumeSource{RamDisk: &api.RamDisk{SizeBytes: 1 << 20}},
+		},
+		{
+			PodID: "pod-b", Name: "data", Kind: "gce-pd", Path: pdDir,
+			Mounted: true, Device: "/dev/sdb", FSType: "ext4",
+			Spec: &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd", FSType: "ext4", ReadOnly: true}},
+		},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, entries)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteVolumeInventory(&buf, entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded []VolumeInventoryEntry
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected the JSON to round trip, got %#v", decoded)
+	}
+
+	defer func(size func(string) (int64, error)) { dirSize = size }(dirSize)
+	dirSize = func(dir string) (int64, error) {
+		if dir == ramDiskDir {
+			return 0, errors.New("walk failed")
+		}
+		return 0, nil
+	}
+	entries, err = snapshotVolumeInventory(tempDir, mounts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected every volume despite a size error, got %#v", entries)
+	}
+	if entries[1].SizeError != "walk failed" || entries[0].SizeError != "" || entries[2].SizeError != "" {
+		t.Errorf("Expected only the ramdisk to report a size error, got %#v", entries)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Where udev links iSCSI devices, and how long to wait for the link to
+// appear after logging in. Variables so tests can replace them.
+var (
+	iscsiDeviceDir          = "/dev/disk/by-path"
+	iscsiDeviceWaitTimeout  = 10 * time.Second
+	iscsiDeviceWaitInterval = time.Second
+)
+
+// iscsiadm exits with this status when logging in to a target that already
+// has a session, as when another volume uses a different LUN of it.
+const iscsiSessionExists = 15
+
+// udev links iSCSI devices as ip-<portal>-iscsi-<iqn>-lun-<lun>.
+var iscsiDevicePathRE = regexp.MustCompile(`^ip-(.+)-iscsi-(.+)-lun-([0-9]+)$`)
+
+// ISCSIDisk volumes are iSCSI LUNs that are attached to the kubelet's host
+// machine and exposed to the pod. Like GCE PDs, each LUN is mounted once per
+// host and bind mounted into each pod using it.
+type ISCSIDisk struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Portal of the target, as IP or IP:port.
+	Portal string
+	// iSCSI Qualified Name of the target.
+	IQN string
+	// LUN number on the target.
+	Lun string
+	// Filesystem type, optional.
+	FSType string
+	// Specifies whether the LUN will be mounted ReadOnly.
+	ReadOnly bool
+	// MountOptions are applied to the bind mount into the pod.
+	MountOptions []string
+	// Mounter interface that provides system calls to mount the disks.
+	mounter mounter
+	// Runner used to run iscsiadm and to inspect and format the device.
+	runner commandRunner
+}
+
+func (disk *ISCSIDisk) GetPath() string {
+	return VolumeHost{RootDir: disk.RootDir}.PodVolumeDir(disk.PodID, KindISCSI, disk.Name)
+}
+
+// devicePath returns the udev link of the LUN.
+func (disk *ISCSIDisk) devicePath() string {
+	return path.Join(iscsiDeviceDir, fmt.Sprintf("ip-%s-iscsi-%s-lun-%s", disk.Portal, disk.IQN, disk.Lun))
+}
+
+// Logs in to the target, mounts the LUN globally and bind mounts it to the
+// volume path.
+func (disk *ISCSIDisk) SetUp() error {
+	lockName := iscsiLockName(disk.Portal, disk.IQN)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	mountpoint, err := disk.mounter.IsMountPoint(disk.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	devicePath, err := disk.attach()
+	if err != nil {
+		return err
+	}
+	globalPath := makeGlobalISCSIPath(disk.RootDir, path.Base(devicePath))
+	if err := disk.mountGlobal(devicePath, globalPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(disk.GetPath(), 0750); err != nil {
+		return err
+	}
+	return bindMount(disk.mounter, globalPath, disk.GetPath(), disk.ReadOnly, disk.MountOptions)
+}
+
+// attach logs in to the target and waits for the LUN's device to appear.
+func (disk *ISCSIDisk) attach() (string, error) {
+	if _, err := disk.runner.Run("iscsiadm", "-m", "discovery", "-t", "sendtargets", "-p", disk.Portal); err != nil {
+		return "", err
+	}
+	_, err := disk.runner.Run("iscsiadm", "-m", "node", "-p", disk.Portal, "-T", disk.IQN, "--login")
+	if exitErr, ok := err.(*commandExitError); ok && exitErr.ExitStatus == iscsiSessionExists {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	devicePath := disk.devicePath()
+	if err := waitForDevice(devicePath, iscsiDeviceWaitTimeout, iscsiDeviceWaitInterval); err != nil {
+		return "", err
+	}
+	return devicePath, nil
+}
+
+// mountGlobal mounts the device to globalPath, formatting it first if it is
+// empty, unless it is already mounted there. A directory left at globalPath
+// by a reboot or crash is mounted over, not mistaken for the mount.
+func (disk *ISCSIDisk) mountGlobal(devicePath, globalPath string) error {
+	mounted, err := disk.mounter.IsMountPoint(globalPath)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		return nil
+	}
+	if !disk.ReadOnly {
+		if err := formatIfNeeded(disk.runner, devicePath, disk.FSType); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(globalPath, 0750); err != nil {
+		return err
+	}
+	fstype := disk.FSType
+	if fstype == "" {
+		fstype = defaultFSType
+	}
+	flags := uintptr(0)
+	if disk.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	return mountNew(disk.mounter, devicePath, globalPath, fstype, flags, "")
+}
+
+// Unmounts the bind mount, and logs out of the target only if the volume was
+// the last reference to the LUN on the kubelet.
+func (disk *ISCSIDisk) TearDown() error {
+	if _, err := os.Stat(disk.GetPath()); os.IsNotExist(err) {
+		return nil
+	}
+	devicePath, _, err := disk.mounter.RefCount(disk)
+	if errors.Is(err, errNotMountPoint) {
+		return removeMountPoint(disk.mounter, disk.GetPath())
+	}
+	if err != nil {
+		return err
+	}
+	portal, iqn, err := parseISCSIDevicePath(devicePath)
+	if err != nil {
+		return err
+	}
+	lockName := iscsiLockName(portal, iqn)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	// The references are counted again now that no SetUp or TearDown of a
+	// LUN of the target can change them.
+	return tearDownBlockVolume(disk, disk.mounter, disk.detach)
+}
+
+// iscsiLockName returns the name a target is locked by in pdLocks. Logging
+// in and out affects every LUN of a target, so they share the lock.
+func iscsiLockName(portal, iqn string) string {
+	return path.Join(KindISCSI, portal, iqn)
+}
+
+// parseISCSIDevicePath returns the portal and IQN of the target of the LUN
+// udev linked at devicePath.
+func parseISCSIDevicePath(devicePath string) (portal, iqn string, err error) {
+	match := iscsiDevicePathRE.FindStringSubmatch(path.Base(devicePath))
+	if match == nil {
+		return "", "", fmt.Errorf("unexpected iSCSI device path: %s", devicePath)
+	}
+	return match[1], match[2], nil
+}
+
+// detach unmounts the global mount of the device and logs out of its target.
+func (disk *ISCSIDisk) detach(devicePath string) error {
+	portal, iqn, err := parseISCSIDevicePath(devicePath)
+	if err != nil {
+		return err
+	}
+	globalPath := makeGlobalISCSIPath(disk.RootDir, path.Base(devicePath))
+	if err := unmountWithRetry(disk.mounter, globalPath, false); err != nil {
+		return err
+	}
+	if err := os.Remove(globalPath); err != nil {
+		return err
+	}
+	// Logging out ends the session for every LUN of the target, so only do
+	// it once none of them are mounted.
+	if disk.targetInUse(portal, iqn) {
+		glog.V(1).Infof("Other LUNs of %s are in use, staying logged in", iqn)
+		return nil
+	}
+	_, err = disk.runner.Run("iscsiadm", "-m", "node", "-p", portal, "-T", iqn, "--logout")
+	return err
+}
+
+// targetInUse returns true if any LUN of the target is still mounted
+// globally, or if that can't be told, as logging out from under a mounted
+// LUN would fail its I/O.
+func (disk *ISCSIDisk) targetInUse(portal, iqn string) bool {
+	globalDir := makeGlobalISCSIPath(disk.RootDir, "")
+	entries, err := ioutil.ReadDir(globalDir)
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		glog.Warningf("Could not tell whether LUNs of %s are in use, assuming they are: %v", iqn, err)
+		return true
+	}
+	for _, entry := range entries {
+		match := iscsiDevicePathRE.FindStringSubmatch(entry.Name())
+		if match != nil && match[1] == portal && match[2] == iqn {
+			return true
+		}
+	}
+	return false
+}
+
+// makeGlobalISCSIPath returns the path a LUN is mounted to once per host,
+// named after its udev link.
+func makeGlobalISCSIPath(rootDir, deviceName string) string {
+	return VolumeHost{RootDir: rootDir}.GlobalDir(KindISCSI, deviceName)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestISCSIDisk(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "ISCSIDisk")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer func(dir string, timeout, interval time.Duration) {
+		iscsiDeviceDir, iscsiDeviceWaitTimeout, iscsiDeviceWaitInterval = dir, timeout, interval
+	}(iscsiDeviceDir, iscsiDeviceWaitTimeout, iscsiDeviceWaitInterval)
+	iscsiDeviceDir = path.Join(tempDir, "dev")
+	iscsiDeviceWaitTimeout = 2 * time.Millisecond
+	iscsiDeviceWaitInterval = time.Millisecond
+
+	runner := &fakeRunner{}
+	mounter := &FakeMounter{}
+	disk := &ISCSIDisk{
+		Name:    "data",
+		PodID:   "my-id",
+		RootDir: tempDir,
+		Portal:  "10.0.0.1:3260",
+		IQN:     "iqn.2014-10.com.example:storage",
+		Lun:     "1",
+		mounter: mounter,
+		runner:  runner,
+	}
+	// The device never appears.
+	if err := disk.SetUp(); err == nil {
+		t.Fatalf("Expected SetUp() to fail without the device")
+	}
+
+	deviceName := "ip-10.0.0.1:3260-iscsi-iqn.2014-10.com.example:storage-lun-1"
+	if err := os.MkdirAll(iscsiDeviceDir, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(iscsiDeviceDir, deviceName), []byte{}, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A global directory left behind by a crash is no sign of a mount.
+	globalPath := makeGlobalISCSIPath(tempDir, deviceName)
+	if err := os.MkdirAll(globalPath, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	runner.commands = nil
+	if err := disk.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	devicePath := path.Join(iscsiDeviceDir, deviceName)
+	expectedCommands := []string{
+		"iscsiadm -m discovery -t sendtargets -p 10.0.0.1:3260",
+		"iscsiadm -m node -p 10.0.0.1:3260 -T iqn.2014-10.com.example:storage --login",
+		"blkid -p -o export " + devicePath,
+	}
+	if !reflect.DeepEqual(runner.commands, expectedCommands) {
+		t.Errorf("Expected commands %v, got %v", expectedCommands, runner.commands)
+	}
+	expectedMounts := []string{"ext4:" + globalPath, ":" + disk.GetPath(), ":" + disk.GetPath()}
+	if !reflect.DeepEqual(mounter.Mounts, expectedMounts) {
+		t.Errorf("Expected mounts %v, got %v", expectedMounts, mounter.Mounts)
+	}
+
+	// The pod's bind mount and the global mount reference the device.
+	cleaner := &ISCSIDisk{Name: "data", PodID: "my-id", RootDir: tempDir, mounter: mounter, runner: runner}
+	mounter.Device, mounter.Refs = devicePath, 2
+	runner.commands = nil
+	if err := cleaner.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedUnmounts := []string{disk.GetPath(), globalPath}
+	if !reflect.DeepEqual(mounter.Unmounts, expectedUnmounts) {
+		t.Errorf("Expected unmounts %v, got %v", expectedUnmounts, mounter.Unmounts)
+	}
+	expectedCommands = []string{"iscsiadm -m node -p 10.0.0.1:3260 -T iqn.2014-10.com.example:storage --logout"}
+	if !reflect.DeepEqual(runner.commands, expectedCommands) {
+		t.Errorf("Expected commands %v, got %v", expectedCommands, runner.commands)
+	}
+}
+
+func TestISCSITargetInUse(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "ISCSITargetInUse")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	disk := &ISCSIDisk{RootDir: tempDir}
+	portal, iqn := "10.0.0.1:3260", "iqn.2014-10.com.example:storage"
+	if disk.targetInUse(portal, iqn) {
+		t.Errorf("Expected a target without global mounts not to be in use")
+	}
+	if err := os.MkdirAll(makeGlobalISCSIPath(tempDir, "ip-10.0.0.1:3260-iscsi-iqn.2014-10.com.example:storage-lun-2"), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !disk.targetInUse(portal, iqn) {
+		t.Errorf("Expected a target with another LUN mounted to be in use")
+	}
+	if disk.targetInUse(portal, "iqn.2014-10.com.example:other") {
+		t.Errorf("Expected another target's LUN not to count")
+	}
+
+	// The global directory can't be read.
+	disk.RootDir = path.Join(tempDir, "unreadable")
+	if err := os.MkdirAll(path.Dir(makeGlobalISCSIPath(disk.RootDir, "")), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(makeGlobalISCSIPath(disk.RootDir, ""), []byte{}, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !disk.targetInUse(portal, iqn) {
+		t.Errorf("Expected a target to be in use when its LUNs can't be listed")
+	}
+}
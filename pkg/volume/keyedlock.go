@@ -0,0 +1,73 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"sync"
+)
+
+// keyedMutex is a set of mutexes, one per key, so that operations on the same
+// key are serialized while operations on different keys run concurrently.
+// The zero value is ready to use.
+type keyedMutex struct {
+	mutex sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the mutex of a key and the number of callers holding or
+// waiting for it, so it can be forgotten once none are.
+type keyedLock struct {
+	sync.Mutex
+	users int
+}
+
+// Lock locks the mutex of key, waiting until it is available.
+func (k *keyedMutex) Lock(key string) {
+	k.mutex.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	lock, found := k.locks[key]
+	if !found {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.users++
+	k.mutex.Unlock()
+
+	lock.Lock()
+}
+
+// Unlock unlocks the mutex of key, which must be locked.
+func (k *keyedMutex) Unlock(key string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	lock, found := k.locks[key]
+	if !found {
+		panic("volume: unlock of unlocked key " + key)
+	}
+	lock.users--
+	if lock.users == 0 {
+		delete(k.locks, key)
+	}
+	lock.Unlock()
+}
+
+// pdLocks serializes the attaching, mounting, unmounting and detaching of each
+// GCE PD, by disk name, so pods sharing a disk don't race on its global mount.
+// Other kinds of disk are locked by their kind and name.
+var pdLocks keyedMutex
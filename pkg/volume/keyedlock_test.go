@@ -0,0 +1,64 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerializesKey(t *testing.T) {
+	var locks keyedMutex
+	locks.Lock("my-pd")
+	acquired := make(chan struct{})
+	go func() {
+		locks.Lock("my-pd")
+		close(acquired)
+		locks.Unlock("my-pd")
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("expected the second lock of my-pd to wait")
+	case <-time.After(10 * time.Millisecond):
+	}
+	locks.Unlock("my-pd")
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the second lock of my-pd to be acquired after unlock")
+	}
+}
+
+func TestKeyedMutexIndependentKeys(t *testing.T) {
+	var locks keyedMutex
+	locks.Lock("my-pd")
+	defer locks.Unlock("my-pd")
+	acquired := make(chan struct{})
+	go func() {
+		locks.Lock("other-pd")
+		locks.Unlock("other-pd")
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("expected other-pd not to wait for my-pd")
+	}
+	if _, found := locks.locks["other-pd"]; found {
+		t.Errorf("expected the unused lock of other-pd to be forgotten")
+	}
+}
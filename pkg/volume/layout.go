@@ -0,0 +1,80 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"path"
+)
+
+// Volume kinds, the directories pod volumes of each type are kept in. A
+// volume's kind must match between its GetPath and CreateVolumeCleaner, or
+// GetCurrentVolumes can't tear it down.
+const (
+	KindHostDirectory        = "host"
+	KindEmptyDirectory       = "empty"
+	KindRamDisk              = "ramdisk"
+	KindGCEPersistentDisk    = "gce-pd"
+	KindISCSI                = "iscsi"
+	KindAWSElasticBlockStore = "aws-ebs"
+	KindRBD                  = "rbd"
+	KindSecret               = "secret"
+	KindGlusterfs            = "glusterfs"
+	KindCephFS               = "cephfs"
+	KindAzureDisk            = "azure-disk"
+	KindFlocker              = "flocker"
+)
+
+// VolumeHost lays out the directories volumes use under the kubelet's root
+// directory. Each pod volume has its own directory:
+//
+//	(ROOT_DIR)/(POD_ID)/volumes/(VOLUME_KIND)/(VOLUME_NAME)
+//
+// and devices shared by the pods on the host are mounted once at:
+//
+//	(ROOT_DIR)/global/(KIND)/(NAME)
+//
+// The kubelet's own state about a pod's volumes is kept elsewhere under
+// (ROOT_DIR)/(POD_ID). GetCurrentVolumes walks the same layout to find the
+// volumes on the host.
+type VolumeHost struct {
+	RootDir string
+}
+
+// PodVolumesDir returns the directory holding the volumes of a pod, one
+// subdirectory per volume kind.
+func (host VolumeHost) PodVolumesDir(podID string) string {
+	return path.Join(host.RootDir, podID, "volumes")
+}
+
+// PodVolumeDir returns the directory of the named volume of a pod.
+func (host VolumeHost) PodVolumeDir(podID, kind, name string) string {
+	return path.Join(host.PodVolumesDir(podID), kind, name)
+}
+
+// PostMountSentinel returns the file recording that the post-mount command
+// of the named volume of a pod has succeeded. It is kept in the pod's
+// directory rather than in the volume, which the pod can write to, or may
+// be read-only.
+func (host VolumeHost) PostMountSentinel(podID, name string) string {
+	return path.Join(host.RootDir, podID, "post-mount", name)
+}
+
+// GlobalDir returns the path a device of the given kind is mounted to once
+// for the whole host, or with an empty name the directory holding them.
+func (host VolumeHost) GlobalDir(kind, name string) string {
+	return path.Join(host.RootDir, "global", kind, name)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVolumeHostLayoutRoundTrip(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "VolumeHostLayoutRoundTrip")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	host := VolumeHost{RootDir: tempDir}
+	if err := os.MkdirAll(host.PodVolumeDir("my-pod", "empty", "data"), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.MkdirAll(host.GlobalDir("pd", "my-pd"), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	volumes, err := GetCurrentVolumes(tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(volumes) != 1 {
+		t.Fatalf("Expected one volume, got %#v", volumes)
+	}
+	found := volumes[0]
+	if found.PodID != "my-pod" || found.Kind != "empty" || found.Name != "data" {
+		t.Errorf("Unexpected volume: %#v", found)
+	}
+	if path := found.Cleaner.(*EmptyDirectory).GetPath(); path != host.PodVolumeDir("my-pod", "empty", "data") {
+		t.Errorf("Expected the cleaner to use the volume's directory, got %s", path)
+	}
+}
+
+func TestEveryKindHasCleaner(t *testing.T) {
+	kinds := []string{
+		KindHostDirectory,
+		KindEmptyDirectory,
+		KindRamDisk,
+		KindGCEPersistentDisk,
+		KindISCSI,
+		KindAWSElasticBlockStore,
+		KindRBD,
+		KindSecret,
+		KindGlusterfs,
+		KindCephFS,
+		KindAzureDisk,
+		KindFlocker,
+	}
+	for _, kind := range kinds {
+		cleaner, err := CreateVolumeCleaner(kind, "data", "my-pod", "/root")
+		if err != nil {
+			t.Errorf("Unexpected error for kind %q: %v", kind, err)
+			continue
+		}
+		var dir string
+		switch vol := cleaner.(type) {
+		case *HostDirectory:
+			// Host directories are used in place; only their bind mounts
+			// are laid out by kind.
+			dir = vol.bindPath()
+		case Interface:
+			dir = vol.GetPath()
+		default:
+			t.Errorf("Cleaner for kind %q has no path", kind)
+			continue
+		}
+		if expected := (VolumeHost{RootDir: "/root"}).PodVolumeDir("my-pod", kind, "data"); dir != expected {
+			t.Errorf("Kind %q: expected path %s, got %s", kind, expected, dir)
+		}
+	}
+}
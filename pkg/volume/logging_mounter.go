@@ -0,0 +1,86 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// logMountsEnv is the environment variable that, when set to anything, has
+// volumes mount through a LoggingMounter, to debug mount failures on a node
+// without tracing the kubelet.
+const logMountsEnv = "KUBELET_LOG_MOUNTS"
+
+// newMounter returns the mounter volumes use on this host: a DiskMounter,
+// wrapped in a LoggingMounter if logMountsEnv is set.
+func newMounter() mounter {
+	if os.Getenv(logMountsEnv) != "" {
+		return &LoggingMounter{mounter: &DiskMounter{}}
+	}
+	return &DiskMounter{}
+}
+
+// LoggingMounter logs every call to the mounter it wraps, with its arguments
+// and result.
+type LoggingMounter struct {
+	mounter mounter
+}
+
+func (m *LoggingMounter) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	err := m.mounter.Mount(source, target, fstype, flags, data)
+	glog.Infof("Mount(%q, %q, %q, %#x, %q): %v", source, target, fstype, flags, redactMountData(data), err)
+	return err
+}
+
+// secretMountOptions are the mount options whose values are credentials,
+// such as the key a CephFS volume is mounted with.
+var secretMountOptions = []string{"secret", "password", "passwd"}
+
+// redactMountData returns the mount data with the values of
+// secretMountOptions replaced, so credentials are kept out of the log.
+func redactMountData(data string) string {
+	options := strings.Split(data, ",")
+	for i, option := range options {
+		for _, secret := range secretMountOptions {
+			if strings.HasPrefix(option, secret+"=") {
+				options[i] = secret + "=<redacted>"
+			}
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+func (m *LoggingMounter) Unmount(target string, flags int) error {
+	err := m.mounter.Unmount(target, flags)
+	glog.Infof("Unmount(%q, %#x): %v", target, flags, err)
+	return err
+}
+
+func (m *LoggingMounter) RefCount(vol Interface) (string, int, error) {
+	device, refs, err := m.mounter.RefCount(vol)
+	glog.Infof("RefCount(%q): %q, %d, %v", vol.GetPath(), device, refs, err)
+	return device, refs, err
+}
+
+func (m *LoggingMounter) IsMountPoint(file string) (bool, error) {
+	mountpoint, err := m.mounter.IsMountPoint(file)
+	glog.Infof("IsMountPoint(%q): %t, %v", file, mountpoint, err)
+	return mountpoint, err
+}
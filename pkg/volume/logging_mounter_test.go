@@ -0,0 +1,77 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoggingMounterDelegates(t *testing.T) {
+	fake := &FakeMounter{Device: "/dev/sdb", Refs: 2, UnmountErrs: []error{errors.New("busy")}}
+	m := &LoggingMounter{mounter: fake}
+	if err := m.Mount("/dev/sdb", "/mnt/a", "ext4", MOUNT_MS_RDONLY, "discard"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := m.Unmount("/mnt/a", 0); err == nil || err.Error() != "busy" {
+		t.Errorf("Expected the wrapped mounter's error, got %v", err)
+	}
+	device, refs, err := m.RefCount(volumePath("/mnt/a"))
+	if device != "/dev/sdb" || refs != 2 || err != nil {
+		t.Errorf("Expected the wrapped mounter's ref count, got %q, %d, %v", device, refs, err)
+	}
+	if expected := []string{"ext4:/mnt/a"}; !reflect.DeepEqual(fake.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, fake.Mounts)
+	}
+	if expected := []string{"/mnt/a"}; !reflect.DeepEqual(fake.Unmounts, expected) {
+		t.Errorf("Expected unmounts %v, got %v", expected, fake.Unmounts)
+	}
+}
+
+func TestRedactMountData(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "",
+		"discard":                           "discard",
+		"name=admin,secret=AQBkey==":        "name=admin,secret=<redacted>",
+		"password=hunter2,uid=1000":         "password=<redacted>,uid=1000",
+		"secretfile=/etc/ceph/admin.secret": "secretfile=/etc/ceph/admin.secret",
+	}
+	for data, expected := range tests {
+		if actual := redactMountData(data); actual != expected {
+			t.Errorf("%q: expected %q, got %q", data, expected, actual)
+		}
+	}
+}
+
+func TestNewMounterLogging(t *testing.T) {
+	defer os.Setenv(logMountsEnv, os.Getenv(logMountsEnv))
+
+	os.Setenv(logMountsEnv, "")
+	if _, ok := newMounter().(*DiskMounter); !ok {
+		t.Errorf("Expected a DiskMounter without %s", logMountsEnv)
+	}
+	os.Setenv(logMountsEnv, "1")
+	m, ok := newMounter().(*LoggingMounter)
+	if !ok {
+		t.Fatalf("Expected a LoggingMounter with %s set", logMountsEnv)
+	}
+	if _, ok := m.mounter.(*DiskMounter); !ok {
+		t.Errorf("Expected the LoggingMounter to wrap a DiskMounter, got %T", m.mounter)
+	}
+}
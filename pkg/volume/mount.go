@@ -0,0 +1,351 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// mountEntry is a single line of a mount table such as /proc/mounts.
+type mountEntry struct {
+	Device     string
+	MountPoint string
+	FSType     string
+	Options    []string
+}
+
+// parseMounts reads a mount table in the format of /proc/mounts.
+func parseMounts(r io.Reader) ([]mountEntry, error) {
+	var mounts []mountEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("malformed mount entry: %q", scanner.Text())
+		}
+		mounts = append(mounts, mountEntry{
+			Device:     unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			FSType:     fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// unescapeMountField undoes the octal escapes, such as \040 for a space, the
+// kernel writes for whitespace and backslashes in /proc/mounts fields.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if n, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// mountTable returns the host's mount table. A variable so tests can replace it.
+var mountTable = func() ([]mountEntry, error) {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseMounts(file)
+}
+
+// resolveMountPoint returns file as the mount table would list it: with
+// symlinks resolved, if it exists, and cleaned.
+func resolveMountPoint(file string) string {
+	if resolved, err := filepath.EvalSymlinks(file); err == nil {
+		file = resolved
+	}
+	return path.Clean(file)
+}
+
+// hasMountPoint returns whether the mount table mounts lists a mount at file.
+func hasMountPoint(mounts []mountEntry, file string) bool {
+	file = resolveMountPoint(file)
+	for _, mount := range mounts {
+		if mount.MountPoint == file {
+			return true
+		}
+	}
+	return false
+}
+
+// mountNew mounts source to target, a directory SetUp has just created, and
+// removes target if the mount fails, as Builder.SetUp promises. Only an
+// empty directory is removed, so nothing is lost if target was in use after all.
+func mountNew(m mounter, source string, target string, fstype string, flags uintptr, data string) error {
+	if err := m.Mount(source, target, fstype, flags, data); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// verifiedBindOptions are the options bindMount checks the mount table for
+// after applying them, those a pod must not be able to escape.
+var verifiedBindOptions = []string{"ro", "nodev", "nosuid", "noexec"}
+
+// bindMount bind mounts source to target, a directory SetUp has just created,
+// with the given mount options, and read-only if readOnly. mount(2) ignores
+// all flags but MS_BIND on a new bind, so the options are applied by
+// remounting it, then checked against the mount table since a mount missing
+// an option asked for must never be left behind. target is unmounted and
+// removed if any step fails.
+func bindMount(m mounter, source, target string, readOnly bool, options []string) error {
+	optionFlags, data := parseMountOptions(options)
+	if readOnly {
+		optionFlags |= MOUNT_MS_RDONLY
+		options = append([]string{"ro"}, options...)
+	}
+	if err := mountNew(m, source, target, "", MOUNT_MS_BIND, data); err != nil {
+		return err
+	}
+	err := m.Mount(source, target, "", MOUNT_MS_BIND|MOUNT_MS_REMOUNT|optionFlags, data)
+	if err == nil {
+		err = checkMountOptions(target, options)
+	}
+	if err != nil {
+		if unmountErr := m.Unmount(target, 0); unmountErr != nil {
+			glog.Errorf("Failed to unmount %s: %v", target, unmountErr)
+		} else {
+			os.Remove(target)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkMountOptions returns an error unless the mount at mountPoint has
+// every one of options that is in verifiedBindOptions.
+func checkMountOptions(mountPoint string, options []string) error {
+	var wanted []string
+	for _, option := range options {
+		for _, verified := range verifiedBindOptions {
+			if option == verified {
+				wanted = append(wanted, option)
+			}
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+	mount, err := currentMount(mountPoint)
+	if err != nil {
+		return err
+	}
+	if mount == nil {
+		return fmt.Errorf("%s is not in the mount table", mountPoint)
+	}
+	for _, option := range wanted {
+		if !hasMountOption(mount, option) {
+			return fmt.Errorf("%s is mounted without %s although it was asked for", mountPoint, option)
+		}
+	}
+	return nil
+}
+
+// currentMount returns the mount in use at mountPoint, or nil if nothing is
+// mounted there. Of several mounts at the same point, the last one made is
+// the one in use.
+func currentMount(mountPoint string) (*mountEntry, error) {
+	mounts, err := mountTable()
+	if err != nil {
+		return nil, err
+	}
+	resolved := resolveMountPoint(mountPoint)
+	var mount *mountEntry
+	for i := range mounts {
+		if mounts[i].MountPoint == resolved {
+			mount = &mounts[i]
+		}
+	}
+	return mount, nil
+}
+
+// isReadOnlyMount returns whether the mount at mountPoint is read-only, and
+// found false if nothing is mounted there.
+func isReadOnlyMount(mountPoint string) (readOnly, found bool, err error) {
+	mount, err := currentMount(mountPoint)
+	if err != nil {
+		return false, false, err
+	}
+	if mount == nil {
+		return false, false, nil
+	}
+	return hasMountOption(mount, "ro"), true, nil
+}
+
+// checkReadOnly returns an error unless the mount at mountPoint is read-only.
+func checkReadOnly(mountPoint string) error {
+	readOnly, found, err := isReadOnlyMount(mountPoint)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s is not in the mount table", mountPoint)
+	}
+	if !readOnly {
+		return fmt.Errorf("%s is mounted read-write although read-only was asked for", mountPoint)
+	}
+	return nil
+}
+
+// errNotMountPoint is returned, wrapped, by RefCount when the volume's path
+// isn't mounted.
+var errNotMountPoint = errors.New("not a mountpoint")
+
+// refCount finds the device mounted at mountPoint and counts the entries
+// in mounts that reference the same device.
+func refCount(mounts []mountEntry, mountPoint string) (string, int, error) {
+	var device string
+	found := false
+	resolved := resolveMountPoint(mountPoint)
+	for _, mount := range mounts {
+		if mount.MountPoint == resolved {
+			device = mount.Device
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", -1, fmt.Errorf("%s is %w", mountPoint, errNotMountPoint)
+	}
+	count := 0
+	for _, mount := range mounts {
+		if mount.Device == device {
+			count++
+		}
+	}
+	return device, count, nil
+}
+
+// parseMountOptions splits mount options into the mount(2) flags they stand
+// for and the remaining filesystem-specific options, joined as mount data.
+// extraData, such as a tmpfs size, is prepended to the data.
+func parseMountOptions(options []string, extraData ...string) (uintptr, string) {
+	flags := uintptr(0)
+	data := extraData
+	for _, option := range options {
+		if flag, ok := mountFlagOptions[option]; ok {
+			flags |= flag
+		} else {
+			data = append(data, option)
+		}
+	}
+	return flags, strings.Join(data, ",")
+}
+
+// selinuxMountOption returns the mount option that labels every file of a new
+// mount with context. The context is quoted as MLS levels may contain commas.
+func selinuxMountOption(context string) string {
+	return "context=\"" + context + "\""
+}
+
+// defaultMountTimeout bounds a DiskMounter's system calls when it doesn't set
+// its own Timeout.
+const defaultMountTimeout = 2 * time.Minute
+
+// ErrMountTimeout is returned, wrapped, when a mount or unmount doesn't
+// complete within the mounter's timeout.
+var ErrMountTimeout = errors.New("mount operation timed out")
+
+// withTimeout runs op, returning an error wrapping ErrMountTimeout if it
+// hasn't returned within timeout. A system call can't be interrupted, so op
+// keeps running after a timeout; a hung mount is left behind rather than
+// blocking the caller with it. A timeout of 0 means defaultMountTimeout.
+func withTimeout(timeout time.Duration, desc string, op func() error) error {
+	if timeout == 0 {
+		timeout = defaultMountTimeout
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w: %s did not complete within %v", ErrMountTimeout, desc, timeout)
+	}
+}
+
+// Retry parameters for unmounting busy mounts. Variables so tests can shorten them.
+var (
+	unmountRetries        = 5
+	unmountInitialBackoff = 100 * time.Millisecond
+)
+
+// unmountWithRetry unmounts target, retrying with exponential backoff while
+// the mount is busy, as it is when a container exiting during pod deletion
+// still holds it. Other errors are returned immediately. If the mount is
+// still busy after all retries and lazy is true, it is detached lazily so the
+// node isn't stuck with it; the kernel finishes the unmount once it is no
+// longer in use. lazy must be false if the caller goes on to release what is
+// behind the mount, such as detaching the disk.
+func unmountWithRetry(m mounter, target string, lazy bool) error {
+	backoff := unmountInitialBackoff
+	var err error
+	for i := 0; i <= unmountRetries; i++ {
+		if i > 0 {
+			glog.V(1).Infof("%s is busy, retrying unmount in %v", target, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = m.Unmount(target, 0)
+		if err != syscall.EBUSY {
+			return err
+		}
+	}
+	if !lazy {
+		return err
+	}
+	glog.Warningf("%s is still busy after %d retries, detaching it lazily; it stays in use until its last user exits", target, unmountRetries)
+	return m.Unmount(target, MOUNT_MNT_DETACH)
+}
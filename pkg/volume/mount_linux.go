@@ -0,0 +1,104 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+const MOUNT_MS_BIND = syscall.MS_BIND
+const MOUNT_MS_RDONLY = syscall.MS_RDONLY
+const MOUNT_MNT_DETACH = syscall.MNT_DETACH
+const MOUNT_MS_REMOUNT = syscall.MS_REMOUNT
+
+// openNoFollowFlags open a file without following a symlink at its path.
+// O_NONBLOCK keeps a FIFO swapped in for the file from blocking the open.
+const openNoFollowFlags = syscall.O_NOFOLLOW | syscall.O_NONBLOCK
+
+// mountFlagOptions maps mount options to the mount(2) flags they stand for.
+var mountFlagOptions = map[string]uintptr{
+	"ro":         syscall.MS_RDONLY,
+	"nodev":      syscall.MS_NODEV,
+	"nosuid":     syscall.MS_NOSUID,
+	"noexec":     syscall.MS_NOEXEC,
+	"noatime":    syscall.MS_NOATIME,
+	"nodiratime": syscall.MS_NODIRATIME,
+	"relatime":   syscall.MS_RELATIME,
+	"sync":       syscall.MS_SYNCHRONOUS,
+}
+
+// DiskMounter implements mounter using the mount(2) and umount(2) system calls.
+type DiskMounter struct {
+	// Timeout bounds each system call, so an unreachable storage server
+	// can't block the caller forever. 0 means defaultMountTimeout.
+	Timeout time.Duration
+}
+
+// Wraps syscall.Mount()
+func (mounter *DiskMounter) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	return withTimeout(mounter.Timeout, "mount of "+target, func() error {
+		return syscall.Mount(source, target, fstype, flags, data)
+	})
+}
+
+// Wraps syscall.Unmount()
+func (mounter *DiskMounter) Unmount(target string, flags int) error {
+	return withTimeout(mounter.Timeout, "unmount of "+target, func() error {
+		return syscall.Unmount(target, flags)
+	})
+}
+
+// filesystemUsage returns the bytes used and the total bytes of the
+// filesystem file is on. Blocks reserved for root count as used.
+func filesystemUsage(file string) (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(file, &stat); err != nil {
+		return 0, 0, err
+	}
+	capacity := int64(stat.Blocks) * stat.Bsize
+	available := int64(stat.Bavail) * stat.Bsize
+	return capacity - available, capacity, nil
+}
+
+// IsMountPoint looks file up in /proc/mounts. Unlike comparing the device
+// of file with that of its parent, this also finds bind mounts from the
+// same filesystem.
+func (mounter *DiskMounter) IsMountPoint(file string) (bool, error) {
+	mounts, err := mountTable()
+	if err != nil {
+		return false, err
+	}
+	return hasMountPoint(mounts, file), nil
+}
+
+// Examines /proc/mounts to find the source device of the volume and the
+// number of references to that device. Returns both the full device path
+// and the number of references.
+func (mounter *DiskMounter) RefCount(vol Interface) (string, int, error) {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return "", -1, err
+	}
+	defer file.Close()
+	mounts, err := parseMounts(file)
+	if err != nil {
+		return "", -1, err
+	}
+	return refCount(mounts, vol.GetPath())
+}
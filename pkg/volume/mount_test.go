@@ -0,0 +1,285 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const fakeProcMounts = `rootfs / rootfs rw 0 0
+/dev/sda1 / ext4 rw,relatime 0 0
+/dev/disk/by-id/google-my-pd /var/lib/kubelet/global/pd/my-pd ext4 rw,relatime 0 0
+/dev/disk/by-id/google-my-pd /var/lib/kubelet/pod1/volumes/gce-pd/vol ext4 rw,relatime 0 0
+/dev/disk/by-id/google-my-pd /var/lib/kubelet/pod2/volumes/gce-pd/vol ext4 rw,relatime 0 0
+`
+
+func TestRefCount(t *testing.T) {
+	mounts, err := parseMounts(strings.NewReader(fakeProcMounts))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	device, count, err := refCount(mounts, "/var/lib/kubelet/pod1/volumes/gce-pd/vol")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if device != "/dev/disk/by-id/google-my-pd" || count != 3 {
+		t.Errorf("Unexpected device %q and count %d", device, count)
+	}
+	if _, _, err := refCount(mounts, "/not/mounted"); err == nil {
+		t.Errorf("Expected error for a path that is not a mountpoint")
+	}
+}
+
+func TestParseMountOptions(t *testing.T) {
+	flags, data := parseMountOptions([]string{"nodev", "uid=1000", "nosuid"}, "size=1024")
+	if expected := mountFlagOptions["nodev"] | mountFlagOptions["nosuid"]; flags != expected {
+		t.Errorf("Expected flags %#x, got %#x", expected, flags)
+	}
+	// Options without a flag are passed to the filesystem, even where no
+	// flags are known.
+	if _, ok := mountFlagOptions["nodev"]; ok && data != "size=1024,uid=1000" {
+		t.Errorf("Unexpected data %q", data)
+	}
+	if flags, data := parseMountOptions(nil); flags != 0 || data != "" {
+		t.Errorf("Expected no flags or data, got %#x and %q", flags, data)
+	}
+}
+
+func TestUnmountWithRetry(t *testing.T) {
+	defer func(retries int, backoff time.Duration) {
+		unmountRetries, unmountInitialBackoff = retries, backoff
+	}(unmountRetries, unmountInitialBackoff)
+	unmountRetries = 3
+	unmountInitialBackoff = time.Millisecond
+
+	tests := []struct {
+		name        string
+		errs        []error
+		lazy        bool
+		expectFlags []int
+		expectErr   bool
+	}{
+		{
+			name:        "busy then unmounted",
+			errs:        []error{syscall.EBUSY, syscall.EBUSY},
+			lazy:        true,
+			expectFlags: []int{0, 0, 0},
+		},
+		{
+			name:        "still busy falls back to a lazy unmount",
+			errs:        []error{syscall.EBUSY, syscall.EBUSY, syscall.EBUSY, syscall.EBUSY},
+			lazy:        true,
+			expectFlags: []int{0, 0, 0, 0, MOUNT_MNT_DETACH},
+		},
+		{
+			name:        "still busy without lazy unmounts",
+			errs:        []error{syscall.EBUSY, syscall.EBUSY, syscall.EBUSY, syscall.EBUSY},
+			expectFlags: []int{0, 0, 0, 0},
+			expectErr:   true,
+		},
+		{
+			name:        "other errors are not retried",
+			errs:        []error{syscall.EINVAL},
+			lazy:        true,
+			expectFlags: []int{0},
+			expectErr:   true,
+		},
+	}
+	for _, test := range tests {
+		mounter := &FakeMounter{UnmountErrs: test.errs}
+		err := unmountWithRetry(mounter, "/mnt/vol", test.lazy)
+		if test.expectErr && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(mounter.UnmountFlags, test.expectFlags) {
+			t.Errorf("%s: expected unmounts with flags %v, got %v", test.name, test.expectFlags, mounter.UnmountFlags)
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	if err := withTimeout(time.Second, "mount of /a", func() error { return syscall.EINVAL }); err != syscall.EINVAL {
+		t.Errorf("Expected the operation's error, got %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	err := withTimeout(10*time.Millisecond, "mount of /b", func() error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, ErrMountTimeout) || !strings.Contains(err.Error(), "mount of /b") {
+		t.Errorf("Expected a timeout for /b, got %v", err)
+	}
+}
+
+func TestHasMountPoint(t *testing.T) {
+	mounts := []mountEntry{
+		{Device: "/dev/sda1", MountPoint: "/"},
+		{Device: "/dev/sda1", MountPoint: "/var/lib/kubelet/pods/my-id/volumes/kubernetes.io~host-path/etc"},
+	}
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{"/", true},
+		{"/var/lib/kubelet/pods/my-id/volumes/kubernetes.io~host-path/etc", true},
+		{"/var/lib/kubelet/pods/my-id/volumes/kubernetes.io~host-path/etc/", true},
+		{"/var/lib/kubelet/pods/my-id/volumes", false},
+	}
+	for _, test := range tests {
+		if mountpoint := hasMountPoint(mounts, test.file); mountpoint != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.file, test.expected, mountpoint)
+		}
+	}
+}
+
+func TestBindMount(t *testing.T) {
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	options := []string{"nodev", "nosuid"}
+	for _, tableOptions := range [][]string{{"ro", "nosuid", "nodev"}, {"ro", "nosuid"}} {
+		target, err := ioutil.TempDir("", "BindMount")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer os.RemoveAll(target)
+		mountTable = func() ([]mountEntry, error) {
+			return []mountEntry{
+				{MountPoint: target, Options: []string{"rw"}},
+				{MountPoint: target, Options: tableOptions},
+			}, nil
+		}
+		mounter := &FakeMounter{}
+		err = bindMount(mounter, "/global/my-pd", target, true, options)
+		// The options are only applied by a remount of the bind.
+		optionFlags, _ := parseMountOptions(options)
+		expectedFlags := []uintptr{MOUNT_MS_BIND, MOUNT_MS_BIND | MOUNT_MS_REMOUNT | MOUNT_MS_RDONLY | optionFlags}
+		if !reflect.DeepEqual(mounter.MountFlags, expectedFlags) {
+			t.Errorf("%v: expected mount flags %v, got %v", tableOptions, expectedFlags, mounter.MountFlags)
+		}
+		if len(tableOptions) == 3 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tableOptions, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: expected an error for a mount without nodev", tableOptions)
+		}
+		if expected := []string{target}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+			t.Errorf("%v: expected unmounts %v, got %v", tableOptions, expected, mounter.Unmounts)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Errorf("%v: expected the target to be removed, got %v", tableOptions, err)
+		}
+	}
+}
+
+func TestParseMountsUnescapes(t *testing.T) {
+	table := `/dev/sdb /var/lib/kubelet/my\040pod/volumes/gce-pd/back\134slash ext4 rw 0 0
+`
+	mounts, err := parseMounts(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := `/var/lib/kubelet/my pod/volumes/gce-pd/back\slash`; len(mounts) != 1 || mounts[0].MountPoint != expected {
+		t.Errorf("Expected mount point %q, got %v", expected, mounts)
+	}
+	if unescaped := unescapeMountField(`a\04`); unescaped != `a\04` {
+		t.Errorf("Expected a truncated escape to be kept, got %q", unescaped)
+	}
+}
+
+func TestHasMountPointSymlink(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "HasMountPointSymlink")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	target := path.Join(tempDir, "target")
+	if err := os.Mkdir(target, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	link := path.Join(tempDir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The mount table lists the resolved path; the temp dir may itself be
+	// behind a symlink.
+	mountPoint, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounts := []mountEntry{{Device: "/dev/sdb", MountPoint: mountPoint}}
+	if !hasMountPoint(mounts, link) {
+		t.Errorf("Expected %s, a link to %s, to be a mountpoint", link, mountPoint)
+	}
+	if device, count, err := refCount(mounts, link); err != nil || device != "/dev/sdb" || count != 1 {
+		t.Errorf("Expected %s to be counted as a mount of /dev/sdb, got %q, %d, %v", link, device, count, err)
+	}
+}
+
+func TestBindMountSymlinkedRoot(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "BindMountSymlinkedRoot")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	// The kubelet's root directory is a link to where its data really is.
+	realRoot := path.Join(tempDir, "data")
+	if err := os.Mkdir(realRoot, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rootDir := path.Join(tempDir, "kubelet")
+	if err := os.Symlink(realRoot, rootDir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	target := path.Join(rootDir, "my-id/volumes/gce-pd/vol")
+	if err := os.MkdirAll(target, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mountPoint, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	mountTable = func() ([]mountEntry, error) {
+		return []mountEntry{{MountPoint: mountPoint, Options: []string{"ro", "nodev"}}}, nil
+	}
+	mounter := &FakeMounter{}
+	if err := bindMount(mounter, "/global/my-pd", target, true, []string{"nodev"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkReadOnly(target); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(mounter.Unmounts) != 0 {
+		t.Errorf("Expected the verified mount to be kept, got unmounts %v", mounter.Unmounts)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"time"
+)
+
+const MOUNT_MS_BIND = 0
+const MOUNT_MS_RDONLY = 0
+const MOUNT_MNT_DETACH = 0
+const MOUNT_MS_REMOUNT = 0
+
+var mountFlagOptions = map[string]uintptr{}
+
+// openNoFollowFlags is empty as volumes are never set up on this platform.
+const openNoFollowFlags = 0
+
+var errUnsupportedPlatform = errors.New("mounting is not supported on this platform")
+
+// DiskMounter is a stub on platforms without mount(2).
+type DiskMounter struct {
+	Timeout time.Duration
+}
+
+func (mounter *DiskMounter) Mount(source string, target string, fstype string, flags uintptr, data string) error {
+	return errUnsupportedPlatform
+}
+
+func (mounter *DiskMounter) Unmount(target string, flags int) error {
+	return errUnsupportedPlatform
+}
+
+func filesystemUsage(file string) (int64, int64, error) {
+	return 0, 0, errUnsupportedPlatform
+}
+
+func (mounter *DiskMounter) IsMountPoint(file string) (bool, error) {
+	return false, nil
+}
+
+func (mounter *DiskMounter) RefCount(vol Interface) (string, int, error) {
+	return "", -1, errUnsupportedPlatform
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Permissions added for the volume's group. Directories are also setgid so
+// files created in them inherit the group.
+const (
+	groupDirMode  = 0070 | os.ModeSetgid
+	groupFileMode = 0060
+)
+
+// setVolumeOwnership gives group gid ownership of the volume at root and
+// makes it group writable. If recursive is true everything under root is
+// changed too; symlinks are left alone so they can't redirect the change
+// outside the volume. Files and directories are changed through a descriptor
+// opened without following symlinks, so one swapped in by a container while
+// the volume is walked is never followed either. Other special files only
+// have their group changed, as opening them can have side effects.
+func setVolumeOwnership(root string, gid int64, recursive bool) error {
+	if !recursive {
+		info, err := os.Lstat(root)
+		if err != nil {
+			return err
+		}
+		return setOwnership(root, info, gid)
+	}
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return setOwnership(path, info, gid)
+	})
+}
+
+func setOwnership(path string, info os.FileInfo, gid int64) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return os.Lchown(path, -1, int(gid))
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|openNoFollowFlags, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	opened, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, opened) {
+		return fmt.Errorf("%s was replaced while its ownership was being changed", path)
+	}
+	if err := f.Chown(-1, int(gid)); err != nil {
+		return err
+	}
+	mode := info.Mode() | groupFileMode
+	if info.IsDir() {
+		mode |= groupDirMode
+	}
+	return f.Chmod(mode)
+}
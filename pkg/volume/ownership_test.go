@@ -0,0 +1,98 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSetVolumeOwnership(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "SetVolumeOwnership")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	root := path.Join(tempDir, "vol")
+	if err := os.MkdirAll(path.Join(root, "sub"), 0700); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file := path.Join(root, "sub", "file")
+	if err := ioutil.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Changing to our own group works without privileges.
+	gid := int64(os.Getgid())
+
+	if err := setVolumeOwnership(root, gid, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectMode(t, root, 0770|os.ModeDir|os.ModeSetgid)
+	expectMode(t, path.Join(root, "sub"), 0700|os.ModeDir)
+	expectMode(t, file, 0600)
+
+	if err := setVolumeOwnership(root, gid, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectMode(t, path.Join(root, "sub"), 0770|os.ModeDir|os.ModeSetgid)
+	expectMode(t, file, 0660)
+}
+
+func TestSetVolumeOwnershipSymlinks(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "SetVolumeOwnershipSymlinks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	root := path.Join(tempDir, "vol")
+	if err := os.MkdirAll(root, 0700); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	outside := path.Join(tempDir, "outside")
+	if err := ioutil.WriteFile(outside, []byte("data"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Symlink(outside, path.Join(root, "link")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := setVolumeOwnership(root, int64(os.Getgid()), true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectMode(t, outside, 0600)
+
+	// The same goes for a symlink standing in for a file since the walk.
+	info, err := os.Lstat(outside)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := setOwnership(path.Join(root, "link"), info, int64(os.Getgid())); err == nil {
+		t.Errorf("Expected an error for a symlink swapped in for a file")
+	}
+	expectMode(t, outside, 0600)
+}
+
+func expectMode(t *testing.T, path string, expected os.FileMode) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Mode() != expected {
+		t.Errorf("Expected mode %v for %s, got %v", expected, path, info.Mode())
+	}
+}
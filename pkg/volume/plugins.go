@@ -0,0 +1,109 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+// PluginFactory is a function that returns a Builder for an *api.Volume.
+type PluginFactory func(volume *api.Volume, podID string, rootDir string) (Builder, error)
+
+// All registered volume plugins.
+var pluginsMutex sync.Mutex
+var plugins = make(map[string]PluginFactory)
+
+// RegisterVolumePlugin registers a PluginFactory by name. It is safe to call
+// concurrently, and returns an error if the name is already registered.
+func RegisterVolumePlugin(name string, factory PluginFactory) error {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	if _, found := plugins[name]; found {
+		return fmt.Errorf("volume plugin %q was registered twice", name)
+	}
+	glog.V(1).Infof("Registered volume plugin %q", name)
+	plugins[name] = factory
+	return nil
+}
+
+// UnregisterVolumePlugin removes the named plugin, if present. This is
+// intended for tests that need to clean up their registrations.
+func UnregisterVolumePlugin(name string) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	delete(plugins, name)
+}
+
+// GetVolumePlugin returns the PluginFactory registered under name, and
+// whether one was found.
+func GetVolumePlugin(name string) (PluginFactory, bool) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	factory, found := plugins[name]
+	return factory, found
+}
+
+// The built-in plugins, named after the api.VolumeSource field they handle.
+func init() {
+	builtins := map[string]PluginFactory{
+		"hostDir": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createHostDirectory(volume, podID, rootDir), nil
+		},
+		"emptyDir": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createEmptyDirectory(volume, podID, rootDir), nil
+		},
+		"persistentDisk": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createGCEPersistentDisk(volume, podID, rootDir), nil
+		},
+		"ramDisk": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createRamDisk(volume, podID, rootDir), nil
+		},
+		"iscsi": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createISCSIDisk(volume, podID, rootDir), nil
+		},
+		"awsElasticBlockStore": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createAWSElasticBlockStore(volume, podID, rootDir), nil
+		},
+		"glusterfs": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createGlusterfs(volume, podID, rootDir), nil
+		},
+		"secret": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createSecret(volume, podID, rootDir), nil
+		},
+		"rbd": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createRBDImage(volume, podID, rootDir), nil
+		},
+		"azureDisk": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createAzureDisk(volume, podID, rootDir), nil
+		},
+		"cephfs": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createCephFS(volume, podID, rootDir), nil
+		},
+		"flocker": func(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+			return createFlocker(volume, podID, rootDir), nil
+		},
+	}
+	for name, factory := range builtins {
+		if err := RegisterVolumePlugin(name, factory); err != nil {
+			panic(err)
+		}
+	}
+}
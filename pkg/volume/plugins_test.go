@@ -0,0 +1,103 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func fakePluginFactory(volume *api.Volume, podID string, rootDir string) (Builder, error) {
+	return &HostDirectory{Path: "/fake"}, nil
+}
+
+func TestRegisterVolumePluginDuplicate(t *testing.T) {
+	defer UnregisterVolumePlugin("fake-plugin")
+	if err := RegisterVolumePlugin("fake-plugin", fakePluginFactory); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := RegisterVolumePlugin("fake-plugin", fakePluginFactory); err == nil {
+		t.Errorf("Expected an error registering a duplicate plugin")
+	}
+	if _, found := GetVolumePlugin("fake-plugin"); !found {
+		t.Errorf("Expected plugin to be registered")
+	}
+	UnregisterVolumePlugin("fake-plugin")
+	if _, found := GetVolumePlugin("fake-plugin"); found {
+		t.Errorf("Expected plugin to be unregistered")
+	}
+}
+
+func TestRegisterVolumePluginConcurrent(t *testing.T) {
+	const count = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*count)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("concurrent-plugin-%d", i)
+		defer UnregisterVolumePlugin(name)
+		// Register every name twice so exactly one registration of each must fail.
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- RegisterVolumePlugin(name, fakePluginFactory)
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	failures := 0
+	for err := range errs {
+		if err != nil {
+			failures++
+		}
+	}
+	if failures != count {
+		t.Errorf("Expected %d duplicate registrations to fail, got %d", count, failures)
+	}
+	for i := 0; i < count; i++ {
+		if _, found := GetVolumePlugin(fmt.Sprintf("concurrent-plugin-%d", i)); !found {
+			t.Errorf("Expected plugin %d to be registered", i)
+		}
+	}
+}
+
+func TestCreateVolumeBuilderUsesPlugin(t *testing.T) {
+	builtin, found := GetVolumePlugin("hostDir")
+	if !found {
+		t.Fatalf("Expected the hostDir plugin to be registered")
+	}
+	UnregisterVolumePlugin("hostDir")
+	defer func() {
+		UnregisterVolumePlugin("hostDir")
+		RegisterVolumePlugin("hostDir", builtin)
+	}()
+	if err := RegisterVolumePlugin("hostDir", fakePluginFactory); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	volume := &api.Volume{Name: "vol", Source: &api.VolumeSource{HostDirectory: &api.HostDirectory{Path: "/data"}}}
+	builder, err := CreateVolumeBuilder(volume, "my-id", "/tmp")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if builder.GetPath() != "/fake" {
+		t.Errorf("Expected the registered plugin's builder, got %v", builder.GetPath())
+	}
+}
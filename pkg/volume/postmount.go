@@ -0,0 +1,101 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/golang/glog"
+)
+
+// ErrPostMountCommandNotAllowed is returned by CreateVolumeBuilder for a
+// post-mount command the administrator hasn't allowed.
+var ErrPostMountCommandNotAllowed = errors.New("post-mount command is not allowed")
+
+// allowedPostMountCommands are the commands post-mount commands may run. The
+// commands run as the kubelet, on the host, so none are allowed by default.
+var allowedPostMountCommands []string
+
+// SetAllowedPostMountCommands allows volumes created afterwards to run the
+// given commands, named exactly as volumes must name them, after being set up.
+func SetAllowedPostMountCommands(commands []string) {
+	allowed := append([]string(nil), commands...)
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	allowedPostMountCommands = allowed
+}
+
+// checkPostMountCommand returns an error unless the command of a post-mount
+// command has been allowed.
+func checkPostMountCommand(command []string) error {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	for _, allowed := range allowedPostMountCommands {
+		if command[0] == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrPostMountCommandNotAllowed, command[0])
+}
+
+// postMountBuilder runs a command on the host after the Builder it wraps has
+// been set up.
+type postMountBuilder struct {
+	Builder
+	// command is run with the volume's path appended as its last argument.
+	command []string
+	// sentinel is created once the command has succeeded.
+	sentinel string
+	runner   commandRunner
+}
+
+// SetUp sets up the wrapped volume and runs the command, unless it has
+// already succeeded since the volume was set up. If the command fails the
+// volume is torn down again, if it can be.
+func (b *postMountBuilder) SetUp() error {
+	volPath := b.GetPath()
+	if _, err := os.Stat(volPath); os.IsNotExist(err) {
+		// A sentinel left from an earlier volume of the same name is stale.
+		if err := os.Remove(b.sentinel); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := b.Builder.SetUp(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(b.sentinel); err == nil {
+		return nil
+	}
+	args := append(append([]string{}, b.command[1:]...), volPath)
+	if _, err := b.runner.Run(b.command[0], args...); err != nil {
+		glog.Errorf("Post-mount command for %s failed: %v", volPath, err)
+		if cleaner, ok := b.Builder.(Cleaner); ok {
+			if tearDownErr := cleaner.TearDown(); tearDownErr != nil {
+				glog.Errorf("Failed to tear down %s after its post-mount command failed: %v", volPath, tearDownErr)
+			}
+		}
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(b.sentinel), 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.sentinel, []byte{}, 0640)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func TestPostMountCommand(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "PostMountCommand")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	runner := &fakeRunner{}
+	emptyDir := &EmptyDirectory{Name: "data", PodID: "my-id", RootDir: tempDir, mounter: &FakeMounter{}}
+	sentinel := VolumeHost{RootDir: tempDir}.PostMountSentinel("my-id", "data")
+	builder := &postMountBuilder{Builder: emptyDir, command: []string{"setfacl", "-m", "u:1000:rwx"}, sentinel: sentinel, runner: runner}
+	if err := builder.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"setfacl -m u:1000:rwx " + emptyDir.GetPath()}
+	if !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, runner.commands)
+	}
+	if _, err := os.Stat(sentinel); err != nil {
+		t.Errorf("Expected the post-mount sentinel to be created: %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(emptyDir.GetPath()); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written into the volume, got %v", entries)
+	}
+	// The command has already succeeded for this volume, so it isn't run again.
+	if err := builder.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected the command to run once, got %v", runner.commands)
+	}
+	// A new volume of the same name gets the command again.
+	if err := emptyDir.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := builder.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(runner.commands) != 2 {
+		t.Errorf("Expected the command to run for the new volume, got %v", runner.commands)
+	}
+}
+
+func TestPostMountCommandAllowed(t *testing.T) {
+	defer SetAllowedPostMountCommands(nil)
+	tempDir, err := ioutil.TempDir("", "PostMountCommandAllowed")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	vol := &api.Volume{
+		Name:             "data",
+		Source:           &api.VolumeSource{EmptyDirectory: &api.EmptyDirectory{}},
+		PostMountCommand: []string{"/usr/bin/setfacl", "-m", "u:1000:rwx"},
+	}
+	if _, err := CreateVolumeBuilder(vol, "my-id", tempDir); !errors.Is(err, ErrPostMountCommandNotAllowed) {
+		t.Errorf("Expected commands not to be allowed by default, got %v", err)
+	}
+	SetAllowedPostMountCommands([]string{"/usr/bin/setfacl"})
+	if _, err := CreateVolumeBuilder(vol, "my-id", tempDir); err != nil {
+		t.Errorf("Unexpected error for an allowed command: %v", err)
+	}
+	vol.PostMountCommand = []string{"setfacl"}
+	if _, err := CreateVolumeBuilder(vol, "my-id", tempDir); !errors.Is(err, ErrPostMountCommandNotAllowed) {
+		t.Errorf("Expected only the allowed command to be allowed, got %v", err)
+	}
+}
+
+func TestPostMountCommandRollback(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "PostMountCommandRollback")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	runner := &fakeRunner{results: map[string]error{"false": errors.New("exit status 1")}}
+	emptyDir := &EmptyDirectory{Name: "data", PodID: "my-id", RootDir: tempDir, mounter: &FakeMounter{}}
+	builder := &postMountBuilder{Builder: emptyDir, command: []string{"false"}, sentinel: VolumeHost{RootDir: tempDir}.PostMountSentinel("my-id", "data"), runner: runner}
+	if err := builder.SetUp(); err == nil {
+		t.Fatalf("Expected the failed post-mount command to fail SetUp()")
+	}
+	if _, err := os.Stat(emptyDir.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be torn down after the failed command", emptyDir.GetPath())
+	}
+}
@@ -0,0 +1,385 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+// Where udev links mapped RBD images, as <pool>/<image>, and how long to
+// wait for the link to appear after mapping. Variables so tests can replace
+// them.
+var (
+	rbdDeviceDir          = "/dev/rbd"
+	rbdDeviceWaitTries    = 10
+	rbdDeviceWaitInterval = time.Second
+)
+
+// rbd exits with this status when adding a lock this host already holds, as
+// when another pod on the host uses the image.
+const rbdLockExists = 17
+
+// rbdLockIDPrefix is followed by the hostname in the ID of the exclusive lock
+// taken on images mapped read/write.
+const rbdLockIDPrefix = "kubelet_lock_magic_"
+
+// rbdHostname names the host in its locks. A variable so tests can replace it.
+var rbdHostname = os.Hostname
+
+// RBDImage volumes are Ceph RBD images that are mapped on the kubelet's host
+// machine and exposed to the pod. Like iSCSI LUNs, each image is mounted once
+// per host and bind mounted into each pod using it.
+type RBDImage struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Addresses of the Ceph monitors.
+	Monitors []string
+	// Pool the image is in.
+	Pool string
+	// Name of the image.
+	Image string
+	// Ceph user to map the image as, and the path of its keyring.
+	User    string
+	Keyring string
+	// Filesystem type, optional.
+	FSType string
+	// Specifies whether the image will be mapped ReadOnly. Images mapped
+	// read/write are locked against other hosts.
+	ReadOnly bool
+	// MountOptions are applied to the bind mount into the pod.
+	MountOptions []string
+	// Mounter interface that provides system calls to mount the image.
+	mounter mounter
+	// Runner used to run rbd and to inspect and format the device.
+	runner commandRunner
+}
+
+// rbdLock records how to reach the cluster holding an image's lock, so a
+// Cleaner, which only knows the image from its device, can release it.
+type rbdLock struct {
+	Monitors []string `json:"monitors"`
+	User     string   `json:"user"`
+	Keyring  string   `json:"keyring"`
+}
+
+func (rbd *RBDImage) GetPath() string {
+	return VolumeHost{RootDir: rbd.RootDir}.PodVolumeDir(rbd.PodID, KindRBD, rbd.Name)
+}
+
+// devicePath returns the udev link of the mapped image.
+func (rbd *RBDImage) devicePath() string {
+	return path.Join(rbdDeviceDir, rbd.Pool, rbd.Image)
+}
+
+// Maps the image, mounts it globally and bind mounts it to the volume path.
+func (rbd *RBDImage) SetUp() error {
+	lockName := rbdLockName(rbd.Pool, rbd.Image)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	mountpoint, err := rbd.mounter.IsMountPoint(rbd.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	devicePath, err := rbd.attach()
+	if err != nil {
+		return err
+	}
+	globalPath := makeGlobalRBDPath(rbd.RootDir, rbd.Pool, rbd.Image)
+	if err := rbd.mountGlobal(devicePath, globalPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(rbd.GetPath(), 0750); err != nil {
+		return err
+	}
+	return bindMount(rbd.mounter, globalPath, rbd.GetPath(), rbd.ReadOnly, rbd.MountOptions)
+}
+
+// attach maps the image, unless it is already mapped on this host, and waits
+// for its device to appear. Images mapped read/write are locked first.
+func (rbd *RBDImage) attach() (string, error) {
+	devicePath := rbd.devicePath()
+	if _, err := os.Stat(devicePath); err == nil {
+		return devicePath, nil
+	}
+	lock := rbdLock{Monitors: rbd.Monitors, User: rbd.User, Keyring: rbd.Keyring}
+	if !rbd.ReadOnly {
+		if err := rbd.lock(lock); err != nil {
+			return "", err
+		}
+	}
+	args := append([]string{"map", rbd.Image}, cephArgs(rbd.Pool, lock)...)
+	if rbd.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	if _, err := rbd.runner.Run("rbd", args...); err != nil {
+		rbd.unlockOnError()
+		return "", err
+	}
+	for i := 0; ; i++ {
+		_, err := os.Stat(devicePath)
+		if err == nil {
+			return devicePath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if i+1 == rbdDeviceWaitTries {
+			return "", fmt.Errorf("timed out waiting for %s to appear", devicePath)
+		}
+		time.Sleep(rbdDeviceWaitInterval)
+	}
+}
+
+// unlockOnError releases the lock taken by a failed attach, so the image
+// isn't held against other hosts. Any error is only logged.
+func (rbd *RBDImage) unlockOnError() {
+	if rbd.ReadOnly {
+		return
+	}
+	if err := unlockRBDImage(rbd.runner, rbd.RootDir, rbd.Pool, rbd.Image); err != nil {
+		glog.Errorf("Failed to unlock image %s/%s: %v", rbd.Pool, rbd.Image, err)
+	}
+}
+
+// lock takes this host's exclusive lock on the image and records how to
+// release it.
+func (rbd *RBDImage) lock(lock rbdLock) error {
+	lockID, err := rbdLockID()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"lock", "add", rbd.Image, lockID}, cephArgs(rbd.Pool, lock)...)
+	_, err = rbd.runner.Run("rbd", args...)
+	if exitErr, ok := err.(*commandExitError); ok && exitErr.ExitStatus == rbdLockExists {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("locking image %s/%s, it may be in use on another host: %v", rbd.Pool, rbd.Image, err)
+	}
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	lockPath := makeRBDLockPath(rbd.RootDir, rbd.Pool, rbd.Image)
+	if err := os.MkdirAll(path.Dir(lockPath), 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(lockPath, data, 0600)
+}
+
+// mountGlobal mounts the device to globalPath, formatting it first if it is
+// empty, unless it is already mounted there. A directory left at globalPath
+// by a reboot or crash is mounted over, not mistaken for the mount.
+func (rbd *RBDImage) mountGlobal(devicePath, globalPath string) error {
+	mounted, err := rbd.mounter.IsMountPoint(globalPath)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		return nil
+	}
+	if !rbd.ReadOnly {
+		if err := formatIfNeeded(rbd.runner, devicePath, rbd.FSType); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(globalPath, 0750); err != nil {
+		return err
+	}
+	fstype := rbd.FSType
+	if fstype == "" {
+		fstype = defaultFSType
+	}
+	flags := uintptr(0)
+	if rbd.ReadOnly {
+		flags = MOUNT_MS_RDONLY
+	}
+	return mountNew(rbd.mounter, devicePath, globalPath, fstype, flags, "")
+}
+
+// Unmounts the bind mount, and unmaps the image only if the volume was the
+// last reference to it on the kubelet.
+func (rbd *RBDImage) TearDown() error {
+	if _, err := os.Stat(rbd.GetPath()); os.IsNotExist(err) {
+		return nil
+	}
+	devicePath, _, err := rbd.mounter.RefCount(rbd)
+	if errors.Is(err, errNotMountPoint) {
+		return removeMountPoint(rbd.mounter, rbd.GetPath())
+	}
+	if err != nil {
+		return err
+	}
+	pool, image, err := parseRBDDevicePath(devicePath)
+	if err != nil {
+		return err
+	}
+	lockName := rbdLockName(pool, image)
+	pdLocks.Lock(lockName)
+	defer pdLocks.Unlock(lockName)
+	// The references are counted again now that no SetUp or TearDown of the
+	// image can change them.
+	return tearDownBlockVolume(rbd, rbd.mounter, rbd.detach)
+}
+
+// rbdLockName returns the name an image is locked by in pdLocks.
+func rbdLockName(pool, image string) string {
+	return path.Join(KindRBD, pool, image)
+}
+
+// parseRBDDevicePath returns the pool and image of a mapped image's device.
+func parseRBDDevicePath(devicePath string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(devicePath, rbdDeviceDir+"/"), "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("unexpected RBD device path: %s", devicePath)
+	}
+	return parts[0], parts[1], nil
+}
+
+// detach unmounts the global mount of the device, unmaps it and releases
+// this host's lock on the image.
+func (rbd *RBDImage) detach(devicePath string) error {
+	pool, image, err := parseRBDDevicePath(devicePath)
+	if err != nil {
+		return err
+	}
+	globalPath := makeGlobalRBDPath(rbd.RootDir, pool, image)
+	if err := unmountWithRetry(rbd.mounter, globalPath, false); err != nil {
+		return err
+	}
+	if err := os.Remove(globalPath); err != nil {
+		return err
+	}
+	if _, err := rbd.runner.Run("rbd", "unmap", devicePath); err != nil {
+		return err
+	}
+	return unlockRBDImage(rbd.runner, rbd.RootDir, pool, image)
+}
+
+// unlockRBDImage releases this host's lock on the image, if it took one.
+func unlockRBDImage(runner commandRunner, rootDir, pool, image string) error {
+	lockPath := makeRBDLockPath(rootDir, pool, image)
+	data, err := ioutil.ReadFile(lockPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var lock rbdLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return fmt.Errorf("reading %s: %v", lockPath, err)
+	}
+	lockID, err := rbdLockID()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"lock", "list", image, "--format", "json"}, cephArgs(pool, lock)...)
+	output, err := runner.Run("rbd", args...)
+	if err != nil {
+		return err
+	}
+	// Locks are listed by ID, each with the client that holds it.
+	locks := map[string]struct {
+		Locker string `json:"locker"`
+	}{}
+	if len(output) > 0 {
+		if err := json.Unmarshal(output, &locks); err != nil {
+			return fmt.Errorf("parsing locks of image %s/%s: %v", pool, image, err)
+		}
+	}
+	if held, found := locks[lockID]; found {
+		args := append([]string{"lock", "remove", image, lockID, held.Locker}, cephArgs(pool, lock)...)
+		if _, err := runner.Run("rbd", args...); err != nil {
+			return err
+		}
+	}
+	return os.Remove(lockPath)
+}
+
+// rbdLockID returns the ID of this host's locks.
+func rbdLockID() (string, error) {
+	hostname, err := rbdHostname()
+	if err != nil {
+		return "", err
+	}
+	return rbdLockIDPrefix + hostname, nil
+}
+
+// cephArgs returns the rbd arguments that select the pool and the cluster
+// and user to connect as.
+func cephArgs(pool string, lock rbdLock) []string {
+	return []string{"--pool", pool, "--id", lock.User, "-m", strings.Join(lock.Monitors, ","), "--keyring", lock.Keyring}
+}
+
+// makeGlobalRBDPath returns the path an image is mounted to once per host.
+func makeGlobalRBDPath(rootDir, pool, image string) string {
+	return VolumeHost{RootDir: rootDir}.GlobalDir(KindRBD, pool+"-image-"+image)
+}
+
+// makeRBDLockPath returns the path recording the lock this host holds on an
+// image. It is kept outside the global mount, which is gone by the time the
+// lock is released.
+func makeRBDLockPath(rootDir, pool, image string) string {
+	return VolumeHost{RootDir: rootDir}.GlobalDir("rbd-locks", pool+"-image-"+image)
+}
+
+// Interprets API volume as an RBDImage
+func createRBDImage(volume *api.Volume, podID string, rootDir string) *RBDImage {
+	source := volume.Source.RBD
+	pool := source.RBDPool
+	if pool == "" {
+		pool = "rbd"
+	}
+	user := source.RadosUser
+	if user == "" {
+		user = "admin"
+	}
+	keyring := source.Keyring
+	if keyring == "" {
+		keyring = "/etc/ceph/keyring"
+	}
+	return &RBDImage{
+		Name:         volume.Name,
+		PodID:        podID,
+		RootDir:      rootDir,
+		Monitors:     source.CephMonitors,
+		Pool:         pool,
+		Image:        source.RBDImage,
+		User:         user,
+		Keyring:      keyring,
+		FSType:       source.FSType,
+		ReadOnly:     source.ReadOnly,
+		MountOptions: volume.MountOptions,
+		mounter:      newMounter(),
+		runner:       &execRunner{},
+	}
+}
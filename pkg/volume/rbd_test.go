@@ -0,0 +1,199 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedRunner returns canned output and errors for whole command lines.
+type scriptedRunner struct {
+	commands []string
+	outputs  map[string]string
+	results  map[string]error
+}
+
+func (f *scriptedRunner) Run(cmd string, args ...string) ([]byte, error) {
+	line := strings.Join(append([]string{cmd}, args...), " ")
+	f.commands = append(f.commands, line)
+	return []byte(f.outputs[line]), f.results[line]
+}
+
+func TestRBDImage(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "RBDImage")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer func(dir string) { rbdDeviceDir = dir }(rbdDeviceDir)
+	rbdDeviceDir = path.Join(tempDir, "dev")
+	defer func(hostname func() (string, error)) { rbdHostname = hostname }(rbdHostname)
+	rbdHostname = func() (string, error) { return "node-1", nil }
+
+	devicePath := path.Join(rbdDeviceDir, "kube", "foo")
+	cephArgs := " --pool kube --id admin -m 10.0.0.1:6789,10.0.0.2:6789 --keyring /etc/ceph/keyring"
+	runner := &scriptedRunner{
+		outputs: map[string]string{
+			"rbd lock list foo --format json" + cephArgs: `{"kubelet_lock_magic_node-1":{"locker":"client.4123","address":"10.0.0.5:0/1012"}}`,
+		},
+		results: map[string]error{
+			"blkid -p -o export " + devicePath: &commandExitError{Cmd: "blkid", ExitStatus: blkidNoSignature},
+		},
+	}
+	mounter := &FakeMounter{}
+	rbd := &RBDImage{
+		Name:     "data",
+		PodID:    "my-id",
+		RootDir:  tempDir,
+		Monitors: []string{"10.0.0.1:6789", "10.0.0.2:6789"},
+		Pool:     "kube",
+		Image:    "foo",
+		User:     "admin",
+		Keyring:  "/etc/ceph/keyring",
+		mounter:  mounter,
+		runner:   runner,
+	}
+	// Mapping fails, so the lock is released again.
+	runner.results["rbd map foo"+cephArgs] = &commandExitError{Cmd: "rbd", ExitStatus: 1}
+	if err := rbd.SetUp(); err == nil {
+		t.Fatalf("Expected SetUp() to fail when mapping fails")
+	}
+	delete(runner.results, "rbd map foo"+cephArgs)
+	if _, err := os.Stat(makeRBDLockPath(tempDir, "kube", "foo")); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be released, got %v", err)
+	}
+
+	if err := os.MkdirAll(path.Dir(devicePath), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A global directory left behind by a crash is no sign of a mount.
+	globalPath := makeGlobalRBDPath(tempDir, "kube", "foo")
+	if err := os.MkdirAll(globalPath, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Stand in for udev: the link appears once the image is mapped.
+	runner.commands = nil
+	rbd.runner = &mappingRunner{scriptedRunner: runner, devicePath: devicePath}
+	if err := rbd.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedCommands := []string{
+		"rbd lock add foo kubelet_lock_magic_node-1" + cephArgs,
+		"rbd map foo" + cephArgs,
+		"blkid -p -o export " + devicePath,
+		"mkfs -t ext4 -F " + devicePath,
+	}
+	if !reflect.DeepEqual(runner.commands, expectedCommands) {
+		t.Errorf("Expected commands %v, got %v", expectedCommands, runner.commands)
+	}
+	expectedMounts := []string{"ext4:" + globalPath, ":" + rbd.GetPath(), ":" + rbd.GetPath()}
+	if !reflect.DeepEqual(mounter.Mounts, expectedMounts) {
+		t.Errorf("Expected mounts %v, got %v", expectedMounts, mounter.Mounts)
+	}
+
+	// The pod's bind mount and the global mount reference the device.
+	cleaner := &RBDImage{Name: "data", PodID: "my-id", RootDir: tempDir, mounter: mounter, runner: runner}
+	mounter.Device, mounter.Refs = devicePath, 2
+	runner.commands = nil
+	if err := cleaner.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedUnmounts := []string{rbd.GetPath(), globalPath}
+	if !reflect.DeepEqual(mounter.Unmounts, expectedUnmounts) {
+		t.Errorf("Expected unmounts %v, got %v", expectedUnmounts, mounter.Unmounts)
+	}
+	expectedCommands = []string{
+		"rbd unmap " + devicePath,
+		"rbd lock list foo --format json" + cephArgs,
+		"rbd lock remove foo kubelet_lock_magic_node-1 client.4123" + cephArgs,
+	}
+	if !reflect.DeepEqual(runner.commands, expectedCommands) {
+		t.Errorf("Expected commands %v, got %v", expectedCommands, runner.commands)
+	}
+}
+
+// mappingRunner creates the image's device link when it is mapped, as udev does.
+type mappingRunner struct {
+	*scriptedRunner
+	devicePath string
+}
+
+func (f *mappingRunner) Run(cmd string, args ...string) ([]byte, error) {
+	output, err := f.scriptedRunner.Run(cmd, args...)
+	if err == nil && cmd == "rbd" && args[0] == "map" {
+		err = ioutil.WriteFile(f.devicePath, []byte{}, 0600)
+	}
+	return output, err
+}
+
+func TestRBDImageLockedElsewhere(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "RBDImageLockedElsewhere")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer func(dir string) { rbdDeviceDir = dir }(rbdDeviceDir)
+	rbdDeviceDir = path.Join(tempDir, "dev")
+
+	// rbd exits with EBUSY when another host holds a lock on the image.
+	runner := &fakeRunner{results: map[string]error{"rbd": &commandExitError{Cmd: "rbd", ExitStatus: 16}}}
+	rbd := &RBDImage{Name: "data", PodID: "my-id", RootDir: tempDir, Monitors: []string{"10.0.0.1"}, Pool: "rbd", Image: "foo", mounter: &FakeMounter{}, runner: runner}
+	if err := rbd.SetUp(); err == nil {
+		t.Fatalf("Expected SetUp() to fail while the image is locked")
+	}
+	if len(runner.commands) != 1 || !strings.HasPrefix(runner.commands[0], "rbd lock add foo ") {
+		t.Errorf("Expected only the lock to be tried, got %v", runner.commands)
+	}
+}
+
+func TestRBDImageTearDownWaitsForLock(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "RBDImageTearDownWaitsForLock")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	cleaner := &RBDImage{Name: "data", PodID: "my-id", RootDir: tempDir, runner: &scriptedRunner{}}
+	if err := os.MkdirAll(cleaner.GetPath(), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Another pod's bind mount still references the image.
+	mounter := &FakeMounter{Device: path.Join(rbdDeviceDir, "kube", "foo"), Refs: 3}
+	cleaner.mounter = mounter
+
+	// A SetUp of the image holds its lock.
+	pdLocks.Lock(rbdLockName("kube", "foo"))
+	done := make(chan error)
+	go func() { done <- cleaner.TearDown() }()
+	select {
+	case err := <-done:
+		t.Fatalf("TearDown finished while the image was locked: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	pdLocks.Unlock(rbdLockName("kube", "foo"))
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{cleaner.GetPath()}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+		t.Errorf("Expected unmounts %v, got %v", expected, mounter.Unmounts)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+var (
+	ext4BlockCountRE = regexp.MustCompile(`(?m)^Block count:\s+([0-9]+)$`)
+	ext4BlockSizeRE  = regexp.MustCompile(`(?m)^Block size:\s+([0-9]+)$`)
+	xfsDataRE        = regexp.MustCompile(`(?m)^data\s+=\s+bsize=([0-9]+)\s+blocks=([0-9]+)`)
+)
+
+// resizeFSIfNeeded grows the fstype filesystem on devicePath, mounted at
+// mountPath, to fill the device when the device has grown since it was
+// formatted. Filesystems that already fill their device are left alone, as
+// are types that can't be grown online.
+func resizeFSIfNeeded(runner commandRunner, devicePath, mountPath, fstype string) error {
+	if fstype == "" {
+		fstype = defaultFSType
+	}
+	var resize func() error
+	var fsSize func() (int64, error)
+	switch fstype {
+	case "ext2", "ext3", "ext4":
+		fsSize = func() (int64, error) { return ext4Size(runner, devicePath) }
+		resize = func() error {
+			_, err := runner.Run("resize2fs", devicePath)
+			return err
+		}
+	case "xfs":
+		// xfs is queried and grown through its mount point.
+		fsSize = func() (int64, error) { return xfsSize(runner, mountPath) }
+		resize = func() error {
+			_, err := runner.Run("xfs_growfs", mountPath)
+			return err
+		}
+	default:
+		glog.V(1).Infof("Not checking the size of %s: can't grow %s filesystems", devicePath, fstype)
+		return nil
+	}
+	deviceSize, err := blockDeviceSize(runner, devicePath)
+	if err != nil {
+		return err
+	}
+	size, err := fsSize()
+	if err != nil {
+		return err
+	}
+	if size >= deviceSize {
+		return nil
+	}
+	glog.Infof("Growing the %s filesystem on %s from %d to %d bytes", fstype, devicePath, size, deviceSize)
+	return resize()
+}
+
+// blockDeviceSize returns the size of devicePath in bytes.
+func blockDeviceSize(runner commandRunner, devicePath string) (int64, error) {
+	output, err := runner.Run("blockdev", "--getsize64", devicePath)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size of %s: %q", devicePath, output)
+	}
+	return size, nil
+}
+
+// ext4Size returns the size of the ext filesystem on devicePath in bytes.
+func ext4Size(runner commandRunner, devicePath string) (int64, error) {
+	output, err := runner.Run("dumpe2fs", "-h", devicePath)
+	if err != nil {
+		return 0, err
+	}
+	count := ext4BlockCountRE.FindSubmatch(output)
+	blockSize := ext4BlockSizeRE.FindSubmatch(output)
+	if count == nil || blockSize == nil {
+		return 0, fmt.Errorf("could not find the size of the filesystem on %s", devicePath)
+	}
+	return blocksToBytes(string(count[1]), string(blockSize[1]))
+}
+
+// xfsSize returns the size of the xfs filesystem mounted at mountPath in bytes.
+func xfsSize(runner commandRunner, mountPath string) (int64, error) {
+	output, err := runner.Run("xfs_info", mountPath)
+	if err != nil {
+		return 0, err
+	}
+	match := xfsDataRE.FindSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("could not find the size of the filesystem at %s", mountPath)
+	}
+	return blocksToBytes(string(match[2]), string(match[1]))
+}
+
+func blocksToBytes(count, blockSize string) (int64, error) {
+	blocks, err := strconv.ParseInt(count, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(blockSize, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return blocks * size, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"reflect"
+	"testing"
+)
+
+const dumpe2fsOutput = `Filesystem volume name:   <none>
+Block count:              262144
+Reserved block count:     13107
+Block size:               4096
+`
+
+const xfsInfoOutput = `meta-data=/dev/sdb               isize=512    agcount=4, agsize=65536 blks
+data     =                       bsize=4096   blocks=262144, imaxpct=25
+naming   =version 2              bsize=4096   ascii-ci=0, ftype=1
+`
+
+func TestResizeFSIfNeeded(t *testing.T) {
+	tests := []struct {
+		name     string
+		fstype   string
+		outputs  map[string]string
+		expected []string
+	}{
+		{
+			name:    "grown device is resized",
+			outputs: map[string]string{"blockdev": "2147483648\n", "dumpe2fs": dumpe2fsOutput},
+			expected: []string{
+				"blockdev --getsize64 /dev/sdb",
+				"dumpe2fs -h /dev/sdb",
+				"resize2fs /dev/sdb",
+			},
+		},
+		{
+			name:    "filesystem filling the device is left alone",
+			fstype:  "ext4",
+			outputs: map[string]string{"blockdev": "1073741824\n", "dumpe2fs": dumpe2fsOutput},
+			expected: []string{
+				"blockdev --getsize64 /dev/sdb",
+				"dumpe2fs -h /dev/sdb",
+			},
+		},
+		{
+			name:    "xfs is grown through its mount point",
+			fstype:  "xfs",
+			outputs: map[string]string{"blockdev": "2147483648\n", "xfs_info": xfsInfoOutput},
+			expected: []string{
+				"blockdev --getsize64 /dev/sdb",
+				"xfs_info /mnt/pd",
+				"xfs_growfs /mnt/pd",
+			},
+		},
+		{
+			name:   "other filesystems are not checked",
+			fstype: "vfat",
+		},
+	}
+	for _, test := range tests {
+		runner := &fakeRunner{outputs: test.outputs}
+		if err := resizeFSIfNeeded(runner, "/dev/sdb", "/mnt/pd", test.fstype); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(runner.commands, test.expected) {
+			t.Errorf("%s: expected commands %v, got %v", test.name, test.expected, runner.commands)
+		}
+	}
+}
+
+func TestResizeFSIfNeededUnknownSize(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{"blockdev": "2147483648\n", "dumpe2fs": "garbage"}}
+	if err := resizeFSIfNeeded(runner, "/dev/sdb", "/mnt/pd", "ext4"); err == nil {
+		t.Errorf("expected an error")
+	}
+	for _, cmd := range runner.commands {
+		if cmd == "resize2fs /dev/sdb" {
+			t.Errorf("expected no resize without a known filesystem size")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/golang/glog"
+)
+
+// SecretGetter fetches the data of a secret by name, keyed by the file name
+// each value is written to.
+type SecretGetter interface {
+	GetSecret(name string) (map[string][]byte, error)
+}
+
+// secretSource fetches the data of Secret volumes.
+var secretSource SecretGetter
+
+// SetSecretGetter sets how Secret volumes fetch their data. Until it is
+// called, setting up a Secret volume fails.
+func SetSecretGetter(getter SecretGetter) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	secretSource = getter
+}
+
+func loadSecretGetter() SecretGetter {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return secretSource
+}
+
+// Secret volumes expose the data of a secret as files in a tmpfs, so it is
+// never written to the node's disk.
+type Secret struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Name of the secret to expose.
+	SecretName string
+	// Source of the secret's data.
+	secrets SecretGetter
+	// Mounter interface that provides system calls to mount the tmpfs.
+	mounter mounter
+}
+
+func (secret *Secret) GetPath() string {
+	return VolumeHost{RootDir: secret.RootDir}.PodVolumeDir(secret.PodID, KindSecret, secret.Name)
+}
+
+// Mounts a tmpfs at the volume path and writes each key of the secret to a
+// file readable only by its owner.
+func (secret *Secret) SetUp() error {
+	dir := secret.GetPath()
+	mountpoint, err := secret.mounter.IsMountPoint(dir)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if secret.secrets == nil {
+		return errors.New("no source of secrets is configured for Secret volumes")
+	}
+	data, err := secret.secrets.GetSecret(secret.SecretName)
+	if err != nil {
+		return err
+	}
+	for key := range data {
+		if !validSecretKey(key) {
+			return fmt.Errorf("secret %q has key %q, which is not a valid file name", secret.SecretName, key)
+		}
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	if err := mountNew(secret.mounter, "tmpfs", dir, "tmpfs", 0, ""); err != nil {
+		return err
+	}
+	for key, value := range data {
+		if err := ioutil.WriteFile(path.Join(dir, key), value, 0400); err != nil {
+			// Don't leave a partial secret behind for the next SetUp to skip.
+			if err := secret.TearDown(); err != nil {
+				glog.Errorf("Failed to clean up secret volume %s: %v", dir, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// validSecretKey reports whether key can be used as a file name directly
+// under the volume path.
+func validSecretKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.Contains(key, "/")
+}
+
+// Unmounts the tmpfs, discarding the secret's data, and removes the volume path.
+func (secret *Secret) TearDown() error {
+	path := secret.GetPath()
+	mountpoint, err := secret.mounter.IsMountPoint(path)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(secret.mounter, path, true); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(path)
+}
+
+// Interprets API volume as a Secret volume
+func createSecret(volume *api.Volume, podID string, rootDir string) *Secret {
+	return &Secret{
+		Name:       volume.Name,
+		PodID:      podID,
+		RootDir:    rootDir,
+		SecretName: volume.Source.Secret.Name,
+		secrets:    loadSecretGetter(),
+		mounter:    newMounter(),
+	}
+}
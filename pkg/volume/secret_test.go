@@ -0,0 +1,99 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+type fakeSecrets map[string]map[string][]byte
+
+func (f fakeSecrets) GetSecret(name string) (map[string][]byte, error) {
+	data, found := f[name]
+	if !found {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func TestSecretSetUpTearDown(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "SecretSetUpTearDown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &FakeMounter{}
+	secrets := fakeSecrets{"tls-certs": {"tls.crt": []byte("cert"), "tls.key": []byte("key")}}
+	secret := &Secret{Name: "certs", PodID: "my-id", RootDir: tempDir, SecretName: "tls-certs", secrets: secrets, mounter: mounter}
+	if err := secret.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"tmpfs:" + secret.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, mounter.Mounts)
+	}
+	for key, value := range secrets["tls-certs"] {
+		file := path.Join(secret.GetPath(), key)
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(data) != string(value) {
+			t.Errorf("Expected %s to contain %q, got %q", key, value, data)
+		}
+		expectMode(t, file, 0400)
+	}
+	if err := secret.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(secret.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the volume path to be removed, got %v", err)
+	}
+}
+
+func TestSecretSetUpFailures(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "SecretSetUpFailures")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		name    string
+		secrets SecretGetter
+	}{
+		{name: "unconfigured"},
+		{name: "missing", secrets: fakeSecrets{}},
+		{name: "escaping", secrets: fakeSecrets{"tls-certs": {"../tls.key": []byte("key")}}},
+	}
+	for _, test := range tests {
+		mounter := &FakeMounter{}
+		secret := &Secret{Name: test.name, PodID: "my-id", RootDir: tempDir, SecretName: "tls-certs", secrets: test.secrets, mounter: mounter}
+		if err := secret.SetUp(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if len(mounter.Mounts) != 0 {
+			t.Errorf("%s: expected no mounts, got %v", test.name, mounter.Mounts)
+		}
+		if _, err := os.Stat(secret.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no volume path, got %v", test.name, err)
+		}
+	}
+}
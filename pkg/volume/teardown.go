@@ -0,0 +1,74 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// tearDownBlockVolume unmounts vol, a pod's bind mount of a device that is
+// also mounted globally on the host, and removes its path. Once no other
+// pod's mount of the device is left, detach is called with the device path
+// to unmount the global mount and release the device. TearDown is retried
+// until it succeeds, so a volume already unmounted or removed by an earlier
+// call isn't an error.
+func tearDownBlockVolume(vol Interface, m mounter, detach func(devicePath string) error) error {
+	if _, err := os.Stat(vol.GetPath()); os.IsNotExist(err) {
+		return nil
+	}
+	devicePath, refCount, err := m.RefCount(vol)
+	if errors.Is(err, errNotMountPoint) {
+		return removeMountPoint(m, vol.GetPath())
+	}
+	if err != nil {
+		return err
+	}
+	// Not lazily: the device is released below once the last mount is gone.
+	if err := unmountWithRetry(m, vol.GetPath(), false); err != nil {
+		return err
+	}
+	if err := os.Remove(vol.GetPath()); err != nil {
+		return err
+	}
+	if isLastReference(refCount) {
+		return detach(devicePath)
+	}
+	return nil
+}
+
+// removeMountPoint removes dir, a volume path RefCount found nothing mounted
+// at, once IsMountPoint agrees. Only an empty directory is removed, so a disk
+// still mounted there can never lose its contents.
+func removeMountPoint(m mounter, dir string) error {
+	mountpoint, err := m.IsMountPoint(dir)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return fmt.Errorf("%s is still mounted", dir)
+	}
+	return os.Remove(dir)
+}
+
+// isLastReference returns true if refCount, the number of mounts of a device
+// counted before unmounting a pod's bind mount of it, leaves only the global
+// mount once the bind mount is gone.
+func isLastReference(refCount int) bool {
+	return refCount-1 == 1
+}
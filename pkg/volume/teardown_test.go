@@ -0,0 +1,133 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// volumePath is an Interface for a volume at a fixed path.
+type volumePath string
+
+func (p volumePath) GetPath() string {
+	return string(p)
+}
+
+func TestIsLastReference(t *testing.T) {
+	tests := []struct {
+		refCount int
+		expected bool
+	}{
+		// The pod's bind mount and the global mount.
+		{2, true},
+		// Another pod still has a bind mount of the device.
+		{3, false},
+		// The global mount is gone already, so whatever else holds the
+		// device isn't ours to release.
+		{1, false},
+	}
+	for _, test := range tests {
+		if actual := isLastReference(test.refCount); actual != test.expected {
+			t.Errorf("%d references: expected %v, got %v", test.refCount, test.expected, actual)
+		}
+	}
+}
+
+func TestTearDownBlockVolume(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "TearDownBlockVolume")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name     string
+		mounter  *FakeMounter
+		detached []string
+	}{
+		{"last reference", &FakeMounter{Device: "/dev/sdb", Refs: 2}, []string{"/dev/sdb"}},
+		{"shared", &FakeMounter{Device: "/dev/sdb", Refs: 3}, nil},
+		{"not mounted", &FakeMounter{RefErr: fmt.Errorf("%s is %w", "vol", errNotMountPoint)}, nil},
+	}
+	for _, test := range tests {
+		vol := volumePath(path.Join(tempDir, test.name))
+		if err := os.MkdirAll(vol.GetPath(), 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var detached []string
+		err := tearDownBlockVolume(vol, test.mounter, func(devicePath string) error {
+			detached = append(detached, devicePath)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if fmt.Sprint(detached) != fmt.Sprint(test.detached) {
+			t.Errorf("%s: expected detaches %v, got %v", test.name, test.detached, detached)
+		}
+		if _, err := os.Stat(vol.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the volume path to be removed, got %v", test.name, err)
+		}
+	}
+
+	// A volume removed by an earlier TearDown.
+	mounter := &FakeMounter{RefErr: errors.New("should not be called")}
+	if err := tearDownBlockVolume(volumePath(path.Join(tempDir, "gone")), mounter, nil); err != nil {
+		t.Errorf("Unexpected error for a removed volume: %v", err)
+	}
+
+	// The device is kept when the bind mount can't be unmounted.
+	vol := volumePath(path.Join(tempDir, "busy"))
+	if err := os.MkdirAll(vol.GetPath(), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter = &FakeMounter{Device: "/dev/sdb", Refs: 2, UnmountErrs: []error{errors.New("unmount failed")}}
+	err = tearDownBlockVolume(vol, mounter, func(string) error {
+		t.Errorf("Unexpected detach")
+		return nil
+	})
+	if err == nil {
+		t.Errorf("Expected an unmount error")
+	}
+
+	// RefCount missing a mount that IsMountPoint sees must never cost the
+	// volume its contents.
+	vol = volumePath(path.Join(tempDir, "mounted"))
+	if err := os.MkdirAll(vol.GetPath(), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data := path.Join(vol.GetPath(), "data")
+	if err := ioutil.WriteFile(data, []byte("data"), 0640); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter = &FakeMounter{RefErr: errNotMountPoint, MountPoints: map[string]bool{vol.GetPath(): true}}
+	if err := tearDownBlockVolume(vol, mounter, nil); err == nil {
+		t.Errorf("Expected an error for a volume that is still mounted")
+	}
+	mounter.MountPoints = nil
+	if err := tearDownBlockVolume(vol, mounter, nil); err == nil {
+		t.Errorf("Expected an error removing a volume path that isn't empty")
+	}
+	if _, err := os.Stat(data); err != nil {
+		t.Errorf("Expected the volume's contents to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+// sysfsWriter writes kernel settings under /sys. It is replaced in tests.
+type sysfsWriter interface {
+	// Write writes value to the sysfs file at path.
+	Write(path, value string) error
+}
+
+// realSysfs implements sysfsWriter by writing to the files.
+type realSysfs struct{}
+
+func (s *realSysfs) Write(path, value string) error {
+	return ioutil.WriteFile(path, []byte(value), 0644)
+}
+
+// diskTunable applies a disk label to a setting under /sys/block/<dev>/queue.
+type diskTunable struct {
+	// file is the name of the setting in the device's queue directory.
+	file string
+	// valid reports whether the label value can be written to file.
+	valid func(value string) bool
+}
+
+// diskTunables are the disk labels recognized as performance hints.
+var diskTunables = map[string]diskTunable{
+	"io-scheduler": {file: "scheduler", valid: func(value string) bool { return value != "" }},
+	"read-ahead-kb": {file: "read_ahead_kb", valid: func(value string) bool {
+		_, err := strconv.ParseUint(value, 10, 32)
+		return err == nil
+	}},
+}
+
+// applyDiskTuning applies the recognized performance labels of the disk at
+// devicePath to its sysfs queue settings. Unknown labels are ignored. The
+// hints are best-effort: failures are logged but don't fail the attach.
+func applyDiskTuning(sysfs sysfsWriter, devicePath string, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	// devicePath is a udev symlink; sysfs is keyed by the kernel's name for it.
+	device, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		glog.Warningf("Could not resolve %s, skipping tuning: %v", devicePath, err)
+		return
+	}
+	queueDir := path.Join("/sys/block", path.Base(device), "queue")
+	for label, value := range labels {
+		tunable, ok := diskTunables[label]
+		if !ok {
+			continue
+		}
+		if !tunable.valid(value) {
+			glog.Warningf("Ignoring invalid value %q for disk label %s on %s", value, label, devicePath)
+			continue
+		}
+		if err := sysfs.Write(path.Join(queueDir, tunable.file), value); err != nil {
+			glog.Warningf("Could not apply disk label %s=%s to %s: %v", label, value, devicePath, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// fakeSysfs records the values written to each sysfs path.
+type fakeSysfs struct {
+	writes map[string]string
+}
+
+func (f *fakeSysfs) Write(path, value string) error {
+	f.writes[path] = value
+	return nil
+}
+
+func TestApplyDiskTuning(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "ApplyDiskTuning")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	device := path.Join(tempDir, "sdb")
+	if err := ioutil.WriteFile(device, []byte{}, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	link := path.Join(tempDir, "google-my-pd")
+	if err := os.Symlink(device, link); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sysfs := &fakeSysfs{writes: map[string]string{}}
+	applyDiskTuning(sysfs, link, map[string]string{
+		"io-scheduler":  "none",
+		"read-ahead-kb": "lots",
+		"team":          "storage",
+	})
+	expected := map[string]string{"/sys/block/sdb/queue/scheduler": "none"}
+	if !reflect.DeepEqual(sysfs.writes, expected) {
+		t.Errorf("Expected writes %v, got %v", expected, sysfs.writes)
+	}
+}
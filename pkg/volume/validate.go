@@ -0,0 +1,155 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// ErrMultipleVolumeSources is returned for volumes with more than one source
+// set. Errors naming the conflicting sources wrap it.
+var ErrMultipleVolumeSources = errors.New("multiple volume sources")
+
+// setSources returns the names of the source fields that are set.
+func setSources(source *api.VolumeSource) []string {
+	var names []string
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"hostDir", source.HostDirectory != nil},
+		{"emptyDir", source.EmptyDirectory != nil},
+		{"persistentDisk", source.GCEPersistentDisk != nil},
+		{"ramDisk", source.RamDisk != nil},
+		{"iscsi", source.ISCSI != nil},
+		{"awsElasticBlockStore", source.AWSElasticBlockStore != nil},
+		{"glusterfs", source.Glusterfs != nil},
+		{"secret", source.Secret != nil},
+		{"rbd", source.RBD != nil},
+		{"azureDisk", source.AzureDisk != nil},
+		{"cephfs", source.CephFS != nil},
+		{"flocker", source.Flocker != nil},
+	} {
+		if field.set {
+			names = append(names, field.name)
+		}
+	}
+	return names
+}
+
+// volumeKind returns the name of the one source field volume sets, e.g.
+// "emptyDir", which is also the name its plugin is registered under. Volumes
+// setting no source or several are an error.
+func volumeKind(volume *api.Volume) (string, error) {
+	sources := setSources(volume.Source)
+	if len(sources) == 0 {
+		return "", ErrUnsupportedVolumeType
+	}
+	if len(sources) > 1 {
+		return "", fmt.Errorf("%w: volume %q sets %s", ErrMultipleVolumeSources, volume.Name, strings.Join(sources, ", "))
+	}
+	return sources[0], nil
+}
+
+// ValidateVolume checks that a Builder can be constructed for volume: that
+// exactly one source is set and that it has the fields SetUp needs. It does
+// not touch the filesystem or the provider. A volume without a source is the
+// deprecated implied form and is valid.
+func ValidateVolume(volume *api.Volume) error {
+	source := volume.Source
+	if source == nil {
+		return nil
+	}
+	if _, err := volumeKind(volume); err != nil {
+		return err
+	}
+	switch {
+	case source.HostDirectory != nil:
+		if source.HostDirectory.Path == "" {
+			return fmt.Errorf("volume %q: host directory path is required", volume.Name)
+		}
+	case source.EmptyDirectory != nil:
+		switch source.EmptyDirectory.Medium {
+		case api.StorageTypeDefault, api.StorageTypeMemory:
+		default:
+			return fmt.Errorf("volume %q: unknown storage medium %q", volume.Name, source.EmptyDirectory.Medium)
+		}
+		if source.EmptyDirectory.SizeLimit < 0 {
+			return fmt.Errorf("volume %q: negative size limit %d", volume.Name, source.EmptyDirectory.SizeLimit)
+		}
+	case source.GCEPersistentDisk != nil:
+		if source.GCEPersistentDisk.PDName == "" {
+			return fmt.Errorf("volume %q: persistent disk name is required", volume.Name)
+		}
+		if source.GCEPersistentDisk.SizeGB < 0 {
+			return fmt.Errorf("volume %q: negative disk size %d", volume.Name, source.GCEPersistentDisk.SizeGB)
+		}
+		if source.GCEPersistentDisk.Partition < 0 {
+			return fmt.Errorf("volume %q: invalid partition %d", volume.Name, source.GCEPersistentDisk.Partition)
+		}
+		if fstype := source.GCEPersistentDisk.FSType; fstype != "" && !api.SupportedPDFSTypes.Has(fstype) {
+			return fmt.Errorf("volume %q: unsupported filesystem type %q", volume.Name, fstype)
+		}
+	case source.RamDisk != nil:
+		if source.RamDisk.SizeBytes <= 0 {
+			return fmt.Errorf("volume %q: ramdisk size must be positive, got %d", volume.Name, source.RamDisk.SizeBytes)
+		}
+	case source.ISCSI != nil:
+		if source.ISCSI.TargetPortal == "" || source.ISCSI.IQN == "" {
+			return fmt.Errorf("volume %q: iSCSI target portal and IQN are required", volume.Name)
+		}
+		if source.ISCSI.Lun < 0 || source.ISCSI.Lun > 255 {
+			return fmt.Errorf("volume %q: iSCSI LUN %d out of range", volume.Name, source.ISCSI.Lun)
+		}
+	case source.AWSElasticBlockStore != nil:
+		if source.AWSElasticBlockStore.VolumeID == "" {
+			return fmt.Errorf("volume %q: EBS volume ID is required", volume.Name)
+		}
+		if source.AWSElasticBlockStore.Partition < 0 {
+			return fmt.Errorf("volume %q: invalid partition %d", volume.Name, source.AWSElasticBlockStore.Partition)
+		}
+	case source.Glusterfs != nil:
+		if source.Glusterfs.EndpointsName == "" || source.Glusterfs.Path == "" {
+			return fmt.Errorf("volume %q: Glusterfs endpoints and path are required", volume.Name)
+		}
+	case source.Secret != nil:
+		if source.Secret.Name == "" {
+			return fmt.Errorf("volume %q: secret name is required", volume.Name)
+		}
+	case source.RBD != nil:
+		if len(source.RBD.CephMonitors) == 0 || source.RBD.RBDImage == "" {
+			return fmt.Errorf("volume %q: RBD monitors and image are required", volume.Name)
+		}
+	case source.AzureDisk != nil:
+		if source.AzureDisk.DiskName == "" || source.AzureDisk.DataDiskURI == "" {
+			return fmt.Errorf("volume %q: Azure disk name and URI are required", volume.Name)
+		}
+	case source.CephFS != nil:
+		if len(source.CephFS.Monitors) == 0 {
+			return fmt.Errorf("volume %q: CephFS monitors are required", volume.Name)
+		}
+	case source.Flocker != nil:
+		if source.Flocker.DatasetName == "" {
+			return fmt.Errorf("volume %q: Flocker dataset name is required", volume.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volume
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+func TestValidateVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  *api.VolumeSource
+		wantErr bool
+	}{
+		{"implied", nil, false},
+		{"host", &api.VolumeSource{HostDirectory: &api.HostDirectory{Path: "/data"}}, false},
+		{"host without path", &api.VolumeSource{HostDirectory: &api.HostDirectory{}}, true},
+		{"empty", &api.VolumeSource{EmptyDirectory: &api.EmptyDirectory{Medium: api.StorageTypeMemory}}, false},
+		{"unknown medium", &api.VolumeSource{EmptyDirectory: &api.EmptyDirectory{Medium: "Tape"}}, true},
+		{"pd", &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd"}}, false},
+		{"pd without name", &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{}}, true},
+		{"xfs pd", &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd", FSType: "xfs"}}, false},
+		{"negative pd partition", &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd", Partition: -1}}, true},
+		{"btrfs pd", &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd", FSType: "btrfs"}}, true},
+		{"unsized ramdisk", &api.VolumeSource{RamDisk: &api.RamDisk{}}, true},
+		{"iscsi lun out of range", &api.VolumeSource{ISCSI: &api.ISCSIDisk{TargetPortal: "10.0.0.1", IQN: "iqn.2014-10.com.example:storage", Lun: 256}}, true},
+		{"no source", &api.VolumeSource{}, true},
+		{"two sources", &api.VolumeSource{HostDirectory: &api.HostDirectory{Path: "/data"}, GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd"}}, true},
+	}
+	for _, test := range tests {
+		err := ValidateVolume(&api.Volume{Name: "vol", Source: test.source})
+		if test.wantErr != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestVolumeKind(t *testing.T) {
+	tests := []struct {
+		source   *api.VolumeSource
+		expected string
+	}{
+		{&api.VolumeSource{HostDirectory: &api.HostDirectory{}}, "hostDir"},
+		{&api.VolumeSource{EmptyDirectory: &api.EmptyDirectory{}}, "emptyDir"},
+		{&api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{}}, "persistentDisk"},
+		{&api.VolumeSource{RamDisk: &api.RamDisk{}}, "ramDisk"},
+		{&api.VolumeSource{ISCSI: &api.ISCSIDisk{}}, "iscsi"},
+		{&api.VolumeSource{AWSElasticBlockStore: &api.AWSElasticBlockStore{}}, "awsElasticBlockStore"},
+		{&api.VolumeSource{Glusterfs: &api.Glusterfs{}}, "glusterfs"},
+		{&api.VolumeSource{Secret: &api.SecretSource{}}, "secret"},
+		{&api.VolumeSource{RBD: &api.RBDImage{}}, "rbd"},
+		{&api.VolumeSource{AzureDisk: &api.AzureDisk{}}, "azureDisk"},
+		{&api.VolumeSource{CephFS: &api.CephFS{}}, "cephfs"},
+		{&api.VolumeSource{Flocker: &api.Flocker{}}, "flocker"},
+	}
+	for _, test := range tests {
+		kind, err := volumeKind(&api.Volume{Name: "vol", Source: test.source})
+		if err != nil || kind != test.expected {
+			t.Errorf("Expected kind %s, got %q (%v)", test.expected, kind, err)
+			continue
+		}
+		if _, found := GetVolumePlugin(kind); !found {
+			t.Errorf("Expected a plugin for kind %s", kind)
+		}
+	}
+	if _, err := volumeKind(&api.Volume{Name: "vol", Source: &api.VolumeSource{}}); !errors.Is(err, ErrUnsupportedVolumeType) {
+		t.Errorf("Expected ErrUnsupportedVolumeType for a volume without a source, got %v", err)
+	}
+}
+
+func TestValidateVolumeMultipleSources(t *testing.T) {
+	volume := &api.Volume{
+		Name: "vol",
+		Source: &api.VolumeSource{
+			HostDirectory:     &api.HostDirectory{Path: "/data"},
+			GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd"},
+		},
+	}
+	err := ValidateVolume(volume)
+	if !errors.Is(err, ErrMultipleVolumeSources) {
+		t.Fatalf("Expected ErrMultipleVolumeSources, got %v", err)
+	}
+	expected := `multiple volume sources: volume "vol" sets hostDir, persistentDisk`
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+	if _, err := CreateVolumeBuilder(volume, "my-id", "/tmp"); !errors.Is(err, ErrMultipleVolumeSources) {
+		t.Errorf("Expected CreateVolumeBuilder to reject both sources, got %v", err)
+	}
+}
+
+func TestCreateVolumeBuilderValidates(t *testing.T) {
+	volume := &api.Volume{Name: "vol", Source: &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{}}}
+	if builder, err := CreateVolumeBuilder(volume, "my-id", "/tmp"); err == nil {
+		t.Errorf("Expected error for an invalid volume, got %v", builder)
+	}
+}
@@ -18,16 +18,29 @@ package volume
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	gce_cloud "github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider/gce"
 	"github.com/golang/glog"
 )
 
+// ErrUnsupportedVolumeType is returned for volumes of an unknown type. Errors
+// naming the offending type wrap it, so check for it with errors.Is.
 var ErrUnsupportedVolumeType = errors.New("unsupported volume type")
 
+// ErrInvalidPodID is returned for a pod ID that can't be used as a directory
+// name under the kubelet's root.
+var ErrInvalidPodID = errors.New("invalid pod ID")
+
 // Interface is a directory used by pods or hosts.
 // All method implementations of methods in the volume interface must be idempotent
 type Interface interface {
@@ -39,7 +52,9 @@ type Interface interface {
 type Builder interface {
 	// Uses Interface to provide the path for Docker binds.
 	Interface
-	// SetUp prepares and mounts/unpacks the volume to a directory path.
+	// SetUp prepares and mounts/unpacks the volume to a directory path. A
+	// SetUp that creates a directory and then fails to mount it removes the
+	// directory again, so a failed SetUp leaves nothing behind.
 	SetUp() error
 }
 
@@ -49,47 +64,338 @@ type Cleaner interface {
 	TearDown() error
 }
 
+// defaultDirMode is the mode of a volume directory whose spec doesn't set one.
+const defaultDirMode os.FileMode = 0750
+
+// dirMode returns mode, or defaultDirMode if mode is unset.
+func dirMode(mode os.FileMode) os.FileMode {
+	if mode == 0 {
+		return defaultDirMode
+	}
+	return mode & os.ModePerm
+}
+
+// makeDir creates path with the given mode. The mode is set explicitly
+// afterwards so that the kubelet's umask cannot narrow it.
+func makeDir(path string, mode os.FileMode) error {
+	if err := os.MkdirAll(path, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// Names of the node resources a volume can consume, as reported by
+// CapacityConsumer.
+const (
+	ResourceMemory = "memory"
+)
+
+// CapacityConsumer is implemented by volumes that consume a node resource
+// other than the disk under the kubelet's root directory.
+type CapacityConsumer interface {
+	// RequiredCapacity returns the name of the resource the volume consumes
+	// and the amount of it, in bytes.
+	RequiredCapacity() (string, int64)
+}
+
+// MetricsProvider is implemented by volumes that can report the usage of the
+// filesystem backing them.
+type MetricsProvider interface {
+	// Metrics returns the bytes used and the total bytes of the filesystem
+	// the volume's path is on. Volumes that share a filesystem, such as
+	// emptyDirs on the node's disk, report the same, shared usage.
+	Metrics() (used, capacity int64, err error)
+}
+
+// Mounter provides the system calls needed to mount and unmount volumes.
+type mounter interface {
+	// Mount mounts source to target as fstype with the given flags and data.
+	Mount(source string, target string, fstype string, flags uintptr, data string) error
+	// Unmount unmounts the given target.
+	Unmount(target string, flags int) error
+	// RefCount returns the device mounted at vol's path and the number
+	// of mounts that reference that device.
+	RefCount(vol Interface) (string, int, error)
+	// IsMountPoint returns whether something is mounted at file. A file
+	// that doesn't exist isn't a mount point.
+	IsMountPoint(file string) (bool, error)
+}
+
+// gcePersistentDiskUtil abstracts the provider calls that attach and detach disks.
+type gcePersistentDiskUtil interface {
+	// Creates the disk in the provider. Returns gce_cloud.ErrDiskAlreadyExists
+	// if a disk with the same name already exists.
+	CreateDisk(PD *GCEPersistentDisk) error
+	// Attaches the disk to the kubelet's host machine.
+	AttachDisk(PD *GCEPersistentDisk) error
+	// Waits for the attached disk's device and mounts it to its global path.
+	MountDisk(PD *GCEPersistentDisk) error
+	// Detaches the disk from the kubelet's host machine.
+	DetachDisk(PD *GCEPersistentDisk, devicePath string) error
+}
+
+// ErrHostPathNotAllowed is returned by SetUp for host directories outside the
+// allowed prefixes. Errors naming the path wrap it.
+var ErrHostPathNotAllowed = errors.New("host path is not allowed")
+
+// settingsLock guards the settings made by the package's Set functions, as
+// the kubelet may change them while volumes are being created.
+var settingsLock sync.RWMutex
+
+// allowedHostPaths are the prefixes host directories must be under, or nil to
+// allow any path.
+var allowedHostPaths []string
+
+// SetAllowedHostPaths restricts host directory volumes created afterwards to
+// paths under one of prefixes. Passing nil lifts the restriction. Prefixes are
+// resolved like the paths checked against them, where they exist.
+func SetAllowedHostPaths(prefixes []string) {
+	var allowed []string
+	for _, prefix := range prefixes {
+		prefix = filepath.Clean(prefix)
+		if resolved, err := filepath.EvalSymlinks(prefix); err == nil {
+			prefix = resolved
+		}
+		allowed = append(allowed, prefix)
+	}
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	allowedHostPaths = allowed
+}
+
+// loadAllowedHostPaths returns allowedHostPaths. The slice is replaced, never
+// changed, so it can be kept.
+func loadAllowedHostPaths() []string {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return allowedHostPaths
+}
+
+// skipPDDetach is given to GCE persistent disk volumes as SkipDetach.
+var skipPDDetach bool
+
+// SetSkipPDDetach has GCE persistent disk volumes created afterwards be left
+// attached to the host when torn down. It is meant for troubleshooting a disk
+// on the node, not for normal operation.
+func SetSkipPDDetach(skip bool) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	skipPDDetach = skip
+}
+
+func loadSkipPDDetach() bool {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return skipPDDetach
+}
+
 // Host Directory volumes represent a bare host directory mount.
-// The directory in Path will be directly exposed to the container.
+// The directory in Path will be directly exposed to the container, unless the
+// volume is ReadOnly.
 type HostDirectory struct {
 	Path string
+	// ReadOnly volumes expose a read-only bind mount of Path, private to the
+	// pod, instead of Path itself, so the host's own view stays writable.
+	ReadOnly bool
+	// Name, PodID and RootDir locate the read-only bind mount.
+	Name    string
+	PodID   string
+	RootDir string
+	// Mounter interface that provides system calls to mount the directory.
+	mounter mounter
+	// allowedPrefixes, if not nil, are the only paths Path may resolve under.
+	allowedPrefixes []string
+	// resolvedPath is Path as checked by SetUp. It, not Path, is what gets
+	// bound and exposed, so a symlink swapped in after the check is not
+	// followed.
+	resolvedPath string
 }
 
-// Host directory mounts require no setup or cleanup, but still
-// need to fulfill the interface definitions.
+// Read/write host directory mounts require no setup beyond checking Path.
+// Read-only ones are bind mounted and then remounted read-only, as mount(2)
+// ignores MS_RDONLY on a new bind.
 func (hostVol *HostDirectory) SetUp() error {
-	return nil
+	resolved, err := hostVol.resolve()
+	if err != nil {
+		return err
+	}
+	hostVol.resolvedPath = resolved
+	if !hostVol.ReadOnly {
+		return nil
+	}
+	bindPath := hostVol.bindPath()
+	mountpoint, err := hostVol.mounter.IsMountPoint(bindPath)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if err := os.MkdirAll(bindPath, 0750); err != nil {
+		return err
+	}
+	return bindMount(hostVol.mounter, resolved, bindPath, true, nil)
+}
+
+// resolve returns Path with symlinks and ".." resolved, or an error unless
+// that is under one of the allowed prefixes. Without allowed prefixes Path
+// is returned as is, as it need not exist yet.
+func (hostVol *HostDirectory) resolve() (string, error) {
+	if hostVol.allowedPrefixes == nil {
+		return hostVol.Path, nil
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(hostVol.Path))
+	if err != nil {
+		return "", err
+	}
+	for _, prefix := range hostVol.allowedPrefixes {
+		if resolved == prefix || strings.HasPrefix(resolved, prefix+"/") || prefix == "/" {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s resolves to %s, which is not under %s", ErrHostPathNotAllowed, hostVol.Path, resolved, strings.Join(hostVol.allowedPrefixes, ", "))
+}
+
+// bindPath returns where a read-only volume's bind mount is made.
+func (hostVol *HostDirectory) bindPath() string {
+	return VolumeHost{RootDir: hostVol.RootDir}.PodVolumeDir(hostVol.PodID, KindHostDirectory, hostVol.Name)
+}
+
+// Metrics reports the usage of the host filesystem the directory is on.
+func (hostVol *HostDirectory) Metrics() (int64, int64, error) {
+	return filesystemUsage(hostVol.Path)
 }
 
 func (hostVol *HostDirectory) GetPath() string {
+	if hostVol.ReadOnly {
+		return hostVol.bindPath()
+	}
+	if hostVol.resolvedPath != "" {
+		return hostVol.resolvedPath
+	}
 	return hostVol.Path
 }
 
+// TearDown removes the bind mount of a read-only volume. The host directory
+// itself is left alone.
+func (hostVol *HostDirectory) TearDown() error {
+	bindPath := hostVol.bindPath()
+	if _, err := os.Stat(bindPath); os.IsNotExist(err) {
+		return nil
+	}
+	mountpoint, err := hostVol.mounter.IsMountPoint(bindPath)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(hostVol.mounter, bindPath, true); err != nil {
+			return err
+		}
+	}
+	return os.Remove(bindPath)
+}
+
 // EmptyDirectory volumes are temporary directories exposed to the pod.
 // These do not persist beyond the lifetime of a pod.
 type EmptyDirectory struct {
 	Name    string
 	PodID   string
 	RootDir string
+	// Medium selects the storage backing the directory.
+	Medium api.StorageType
+	// SizeLimit is the maximum size of the directory in bytes, or 0 for no limit.
+	SizeLimit int64
+	// MountOptions are applied to the tmpfs. Only the "Memory" medium is mounted.
+	MountOptions []string
+	// SELinuxContext, if set, is the label given to the directory.
+	SELinuxContext string
+	// FSGroup, if set, is the group given ownership of the directory.
+	FSGroup *int64
+	// DirMode is the permission bits of the directory, or 0 for defaultDirMode.
+	DirMode os.FileMode
+	// Mounter interface that provides system calls to mount the tmpfs.
+	mounter mounter
+	// Runner used to label the directory.
+	runner commandRunner
 }
 
-// SetUp creates the new directory.
+// SetUp creates the new directory, backed by tmpfs if Medium is "Memory".
 func (emptyDir *EmptyDirectory) SetUp() error {
+	if err := emptyDir.setupMedium(); err != nil {
+		return err
+	}
+	if emptyDir.FSGroup != nil {
+		// The directory is new, so only its root needs changing.
+		return setVolumeOwnership(emptyDir.GetPath(), *emptyDir.FSGroup, false)
+	}
+	return nil
+}
+
+func (emptyDir *EmptyDirectory) setupMedium() error {
+	switch emptyDir.Medium {
+	case api.StorageTypeDefault:
+		if emptyDir.SizeLimit != 0 {
+			return fmt.Errorf("size limit is not supported for the default storage medium")
+		}
+		if len(emptyDir.MountOptions) != 0 {
+			return fmt.Errorf("mount options are not supported for the default storage medium")
+		}
+		if err := makeDir(emptyDir.GetPath(), dirMode(emptyDir.DirMode)); err != nil {
+			return err
+		}
+		if emptyDir.SELinuxContext != "" {
+			if _, err := emptyDir.runner.Run("chcon", emptyDir.SELinuxContext, emptyDir.GetPath()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case api.StorageTypeMemory:
+		return emptyDir.setupTmpfs()
+	default:
+		return fmt.Errorf("unknown storage medium %q", emptyDir.Medium)
+	}
+}
+
+func (emptyDir *EmptyDirectory) setupTmpfs() error {
 	path := emptyDir.GetPath()
-	err := os.MkdirAll(path, 0750)
+	if err := makeDir(path, dirMode(emptyDir.DirMode)); err != nil {
+		return err
+	}
+	mountpoint, err := emptyDir.mounter.IsMountPoint(path)
 	if err != nil {
 		return err
 	}
-	return nil
+	if mountpoint {
+		return nil
+	}
+	var extraData []string
+	if emptyDir.DirMode != 0 {
+		// The tmpfs root hides the directory, so it needs the mode too.
+		extraData = append(extraData, fmt.Sprintf("mode=%o", dirMode(emptyDir.DirMode)))
+	}
+	if emptyDir.SizeLimit > 0 {
+		extraData = append(extraData, fmt.Sprintf("size=%d", emptyDir.SizeLimit))
+	}
+	if emptyDir.SELinuxContext != "" {
+		extraData = append(extraData, selinuxMountOption(emptyDir.SELinuxContext))
+	}
+	flags, data := parseMountOptions(emptyDir.MountOptions, extraData...)
+	return mountNew(emptyDir.mounter, "tmpfs", path, "tmpfs", flags, data)
 }
 
 func (emptyDir *EmptyDirectory) GetPath() string {
-	return path.Join(emptyDir.RootDir, emptyDir.PodID, "volumes", "empty", emptyDir.Name)
+	return VolumeHost{RootDir: emptyDir.RootDir}.PodVolumeDir(emptyDir.PodID, KindEmptyDirectory, emptyDir.Name)
+}
+
+// Metrics reports the usage of the directory's medium: the tmpfs for the
+// memory medium, otherwise the node's disk.
+func (emptyDir *EmptyDirectory) Metrics() (int64, int64, error) {
+	return filesystemUsage(emptyDir.GetPath())
 }
 
 func (emptyDir *EmptyDirectory) renameDirectory() (string, error) {
 	oldPath := emptyDir.GetPath()
-	newPath, err := ioutil.TempDir(path.Dir(oldPath), emptyDir.Name+".deleting~")
+	newPath, err := ioutil.TempDir(path.Dir(oldPath), emptyDir.Name+deletingSuffix)
 	if err != nil {
 		return "", err
 	}
@@ -100,8 +406,17 @@ func (emptyDir *EmptyDirectory) renameDirectory() (string, error) {
 	return newPath, nil
 }
 
-// Simply delete everything in the directory.
+// Unmounts the tmpfs, if any, and deletes everything in the directory.
 func (emptyDir *EmptyDirectory) TearDown() error {
+	mountpoint, err := emptyDir.mounter.IsMountPoint(emptyDir.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(emptyDir.mounter, emptyDir.GetPath(), true); err != nil {
+			return err
+		}
+	}
 	tmpDir, err := emptyDir.renameDirectory()
 	if err != nil {
 		return err
@@ -113,18 +428,457 @@ func (emptyDir *EmptyDirectory) TearDown() error {
 	return nil
 }
 
+// RamDisk volumes are fixed-size tmpfs mounts exposed to the pod. Unlike a
+// memory-backed EmptyDirectory the size is required, and is accounted
+// against the node's memory.
+type RamDisk struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// SizeBytes is the size of the tmpfs. Writes beyond it fail with ENOSPC.
+	SizeBytes int64
+	// MountOptions are applied to the tmpfs.
+	MountOptions []string
+	// Mounter interface that provides system calls to mount the tmpfs.
+	mounter mounter
+}
+
+func (ramDisk *RamDisk) GetPath() string {
+	return VolumeHost{RootDir: ramDisk.RootDir}.PodVolumeDir(ramDisk.PodID, KindRamDisk, ramDisk.Name)
+}
+
+// RequiredCapacity reports the ramdisk's size as memory consumption.
+func (ramDisk *RamDisk) RequiredCapacity() (string, int64) {
+	return ResourceMemory, ramDisk.SizeBytes
+}
+
+// SetUp mounts a tmpfs of exactly SizeBytes at the volume path.
+func (ramDisk *RamDisk) SetUp() error {
+	if ramDisk.SizeBytes <= 0 {
+		return fmt.Errorf("ramdisk %s requires a positive size, got %d", ramDisk.Name, ramDisk.SizeBytes)
+	}
+	path := ramDisk.GetPath()
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return err
+	}
+	mountpoint, err := ramDisk.mounter.IsMountPoint(path)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	flags, data := parseMountOptions(ramDisk.MountOptions, fmt.Sprintf("size=%d", ramDisk.SizeBytes))
+	return mountNew(ramDisk.mounter, "tmpfs", path, "tmpfs", flags, data)
+}
+
+// TearDown unmounts the tmpfs, releasing its memory, and removes the directory.
+func (ramDisk *RamDisk) TearDown() error {
+	path := ramDisk.GetPath()
+	mountpoint, err := ramDisk.mounter.IsMountPoint(path)
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		if err := unmountWithRetry(ramDisk.mounter, path, true); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(path)
+}
+
+// GCEPersistentDisk volumes are disk resources provided by Google Compute Engine
+// that are attached to the kubelet's host machine and exposed to the pod.
+type GCEPersistentDisk struct {
+	Name    string
+	PodID   string
+	RootDir string
+	// Unique identifier of the PD, used to find the disk resource in the provider.
+	PDName string
+	// Filesystem type, optional.
+	FSType string
+	// Specifies the partition to mount
+	Partition string
+	// Specifies whether the disk will be attached as ReadOnly.
+	ReadOnly bool
+	// MountOptions are applied to the bind mount into the pod.
+	MountOptions []string
+	// SELinuxContext, if set, labels the disk's filesystem when it is first
+	// mounted on the host. Every pod using the disk on the host shares the label.
+	SELinuxContext string
+	// FSGroup, if set, is the group given ownership of the disk's contents.
+	FSGroup *int64
+	// SkipFSGroupRecursion limits the FSGroup change to the root of the disk.
+	SkipFSGroupRecursion bool
+	// DirMode, if not 0, is the permission bits given to the root of the
+	// disk's filesystem.
+	DirMode os.FileMode
+	// MountRetries is how many more times mounting is tried, MountRetryDelay
+	// apart, after the disk is attached. The device may appear late as
+	// attaching is eventually consistent.
+	MountRetries    int
+	MountRetryDelay time.Duration
+	// Size of the disk to create on first SetUp if it doesn't exist, or 0 to
+	// require a pre-existing disk.
+	SizeGB int64
+	// Type of the disk to create, e.g. "pd-ssd". Empty means the default type.
+	DiskType string
+	// SkipDetach has TearDown unmount the disk but leave it attached to the
+	// host, so its filesystem can be checked by hand.
+	SkipDetach bool
+	// Utility interface that provides API calls to the provider to attach/detach disks.
+	util gcePersistentDiskUtil
+	// Mounter interface that provides system calls to mount the disks.
+	mounter mounter
+	// Runner used to inspect and format the device.
+	runner commandRunner
+	// Writer used to apply performance labels to the device's sysfs settings.
+	sysfs sysfsWriter
+}
+
+func (PD *GCEPersistentDisk) GetPath() string {
+	return VolumeHost{RootDir: PD.RootDir}.PodVolumeDir(PD.PodID, KindGCEPersistentDisk, PD.Name)
+}
+
+// Metrics reports the usage of the disk's filesystem.
+func (PD *GCEPersistentDisk) Metrics() (int64, int64, error) {
+	return filesystemUsage(PD.GetPath())
+}
+
+// Attaches the disk and bind mounts to the volume path.
+func (PD *GCEPersistentDisk) SetUp() error {
+	pdLocks.Lock(PD.PDName)
+	defer pdLocks.Unlock(PD.PDName)
+	mountpoint, err := PD.mounter.IsMountPoint(PD.GetPath())
+	if err != nil {
+		return err
+	}
+	if mountpoint {
+		return nil
+	}
+	if PD.SizeGB > 0 {
+		if err := PD.provision(); err != nil {
+			return err
+		}
+	}
+	// After a kubelet restart the disk may still be attached and mounted for
+	// another pod; attaching it again would fail.
+	mounted, err := PD.mountedGlobally()
+	if err != nil {
+		return err
+	}
+	if mounted {
+		glog.V(1).Infof("Disk %s is already mounted on this host, skipping attach", PD.PDName)
+	} else if err = PD.util.AttachDisk(PD); err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = PD.mount()
+		if err == nil {
+			break
+		}
+		if attempt >= PD.MountRetries {
+			return err
+		}
+		glog.Warningf("Failed to mount disk %s, retrying in %v: %v", PD.PDName, PD.MountRetryDelay, err)
+		time.Sleep(PD.MountRetryDelay)
+	}
+	// A read-only disk can't be changed; its contents must already be usable.
+	if PD.ReadOnly {
+		return nil
+	}
+	// The directory made for the bind mount is hidden by it, so the mode is
+	// given to the root of the disk instead.
+	if PD.DirMode != 0 {
+		if err := os.Chmod(PD.GetPath(), PD.DirMode); err != nil {
+			PD.undoBindMount()
+			return err
+		}
+	}
+	if PD.FSGroup != nil {
+		if err := setVolumeOwnership(PD.GetPath(), *PD.FSGroup, !PD.SkipFSGroupRecursion); err != nil {
+			PD.undoBindMount()
+			return err
+		}
+	}
+	return nil
+}
+
+// undoBindMount removes the volume's bind mount so the next SetUp tries again.
+func (PD *GCEPersistentDisk) undoBindMount() {
+	if err := PD.mounter.Unmount(PD.GetPath(), 0); err != nil {
+		glog.Errorf("Failed to unmount %s: %v", PD.GetPath(), err)
+	} else {
+		os.Remove(PD.GetPath())
+	}
+}
+
+// mount mounts the attached disk globally, if needed, and bind mounts it to
+// the volume path.
+func (PD *GCEPersistentDisk) mount() error {
+	if err := PD.util.MountDisk(PD); err != nil {
+		return err
+	}
+	// Perform a bind mount to the full path to allow duplicate mounts of the same PD.
+	if err := makeDir(PD.GetPath(), defaultDirMode); err != nil {
+		return err
+	}
+	globalPDPath := makeGlobalPDName(PD.RootDir, PD.PDName, PD.Partition)
+	readOnly := PD.ReadOnly
+	if !readOnly {
+		// Another pod may have mounted the disk read-only, as it must be
+		// when attached read-only; its bind mounts have to be read-only too.
+		globalReadOnly, _, err := isReadOnlyMount(globalPDPath)
+		if err != nil {
+			os.Remove(PD.GetPath())
+			return err
+		}
+		if globalReadOnly {
+			glog.Warningf("Disk %s is mounted read-only on this host, so volume %s is read-only too", PD.PDName, PD.Name)
+			readOnly = true
+		}
+	}
+	return bindMount(PD.mounter, globalPDPath, PD.GetPath(), readOnly, PD.MountOptions)
+}
+
+// globalMount is the path a disk is mounted to once per host, as an
+// Interface so the mounter can count the references to it.
+type globalMount string
+
+func (m globalMount) GetPath() string {
+	return string(m)
+}
+
+// mountedGlobally returns true if the disk, or the partition of it the volume
+// uses, is already mounted to its global path.
+func (PD *GCEPersistentDisk) mountedGlobally() (bool, error) {
+	globalPDPath := makeGlobalPDName(PD.RootDir, PD.PDName, PD.Partition)
+	_, refs, err := PD.mounter.RefCount(globalMount(globalPDPath))
+	if errors.Is(err, errNotMountPoint) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return refs > 0, nil
+}
+
+// provision creates the disk backing the volume. Losing a creation race to
+// another pod or node is not an error, the disk it created is used instead.
+func (PD *GCEPersistentDisk) provision() error {
+	err := PD.util.CreateDisk(PD)
+	if err == gce_cloud.ErrDiskAlreadyExists {
+		glog.V(1).Infof("Disk %s already exists, reusing it", PD.PDName)
+		return nil
+	}
+	return err
+}
+
+// Unmounts the bind mount, and detaches the disk only if the PD
+// resource was the last reference to that disk on the kubelet.
+func (PD *GCEPersistentDisk) TearDown() error {
+	// TearDown is retried until it succeeds, so an earlier call may have
+	// already unmounted or removed the volume.
+	if _, err := os.Stat(PD.GetPath()); os.IsNotExist(err) {
+		return nil
+	}
+	devicePath, _, err := PD.mounter.RefCount(PD)
+	if errors.Is(err, errNotMountPoint) {
+		return removeMountPoint(PD.mounter, PD.GetPath())
+	}
+	if err != nil {
+		return err
+	}
+	diskName := PD.lockName(devicePath)
+	pdLocks.Lock(diskName)
+	defer pdLocks.Unlock(diskName)
+	// The references are counted again now that no SetUp or TearDown of the
+	// disk can change them.
+	return tearDownBlockVolume(PD, PD.mounter, func(devicePath string) error {
+		return PD.util.DetachDisk(PD, devicePath)
+	})
+}
+
+// lockName returns the name the disk mounted from devicePath is locked by in
+// pdLocks. Cleaners found on the host don't know their disk's name, so it is
+// read from the device path where possible.
+func (PD *GCEPersistentDisk) lockName(devicePath string) string {
+	if PD.PDName != "" {
+		return PD.PDName
+	}
+	if diskName, _, err := getDiskName(devicePath); err == nil {
+		return diskName
+	}
+	return devicePath
+}
+
+// makeGlobalPDName returns the path the disk, or the given partition of it, is
+// mounted to once per host, which pod volume paths are then bind mounted
+// from. Partitions are mounted below the disk's directory, <name>/<N>, so each
+// has its own path that can't be mistaken for another disk's.
+func makeGlobalPDName(rootDir, devName, partition string) string {
+	return path.Join(VolumeHost{RootDir: rootDir}.GlobalDir("pd", devName), partition)
+}
+
+// parseGlobalPDName returns the disk name and partition of a global PD mount
+// path created by makeGlobalPDName, or an empty name if it isn't one.
+func parseGlobalPDName(rootDir, globalPDPath string) (string, string) {
+	globalDir := makeGlobalPDName(rootDir, "", "")
+	if !strings.HasPrefix(globalPDPath, globalDir+"/") {
+		return "", ""
+	}
+	parts := strings.Split(strings.TrimPrefix(globalPDPath, globalDir+"/"), "/")
+	switch len(parts) {
+	case 1:
+		return parts[0], ""
+	case 2:
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+// diskMountedGlobally returns true if the disk or any partition of it is
+// still mounted to its global path.
+func diskMountedGlobally(m mounter, rootDir, diskName string) (bool, error) {
+	return mountedWithPartitions(m, makeGlobalPDName(rootDir, diskName, ""))
+}
+
+// mountedWithPartitions returns true if diskPath, or the mount point of a
+// partition below it, is mounted.
+func mountedWithPartitions(m mounter, diskPath string) (bool, error) {
+	mounted, err := m.IsMountPoint(diskPath)
+	if err != nil || mounted {
+		return mounted, err
+	}
+	entries, err := ioutil.ReadDir(diskPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		mounted, err := m.IsMountPoint(path.Join(diskPath, entry.Name()))
+		if err != nil || mounted {
+			return mounted, err
+		}
+	}
+	return false, nil
+}
+
 // Interprets API volume as a HostDirectory
-func createHostDirectory(volume *api.Volume) *HostDirectory {
-	return &HostDirectory{volume.Source.HostDirectory.Path}
+func createHostDirectory(volume *api.Volume, podID string, rootDir string) *HostDirectory {
+	return &HostDirectory{
+		Path:            volume.Source.HostDirectory.Path,
+		ReadOnly:        volume.Source.HostDirectory.ReadOnly,
+		Name:            volume.Name,
+		PodID:           podID,
+		RootDir:         rootDir,
+		mounter:         newMounter(),
+		allowedPrefixes: loadAllowedHostPaths(),
+	}
 }
 
 // Interprets API volume as an EmptyDirectory
 func createEmptyDirectory(volume *api.Volume, podID string, rootDir string) *EmptyDirectory {
-	return &EmptyDirectory{volume.Name, podID, rootDir}
+	return &EmptyDirectory{
+		Name:           volume.Name,
+		PodID:          podID,
+		RootDir:        rootDir,
+		Medium:         volume.Source.EmptyDirectory.Medium,
+		SizeLimit:      volume.Source.EmptyDirectory.SizeLimit,
+		MountOptions:   volume.MountOptions,
+		SELinuxContext: volume.SELinuxContext,
+		FSGroup:        volume.FSGroup,
+		DirMode:        os.FileMode(volume.Source.EmptyDirectory.DirMode),
+		mounter:        newMounter(),
+		runner:         &execRunner{},
+	}
+}
+
+// Interprets API volume as a RamDisk
+func createRamDisk(volume *api.Volume, podID string, rootDir string) *RamDisk {
+	return &RamDisk{
+		Name:         volume.Name,
+		PodID:        podID,
+		RootDir:      rootDir,
+		SizeBytes:    volume.Source.RamDisk.SizeBytes,
+		MountOptions: volume.MountOptions,
+		mounter:      newMounter(),
+	}
+}
+
+// Defaults for retrying a persistent disk's mount after it is attached.
+const (
+	defaultMountRetries    = 3
+	defaultMountRetryDelay = 2 * time.Second
+)
+
+// Interprets API volume as a GCEPersistentDisk
+func createGCEPersistentDisk(volume *api.Volume, podID string, rootDir string) *GCEPersistentDisk {
+	PDName := volume.Source.GCEPersistentDisk.PDName
+	FSType := volume.Source.GCEPersistentDisk.FSType
+	if FSType == "" {
+		FSType = defaultFSType
+	}
+	partition := strconv.Itoa(volume.Source.GCEPersistentDisk.Partition)
+	if partition == "0" {
+		partition = ""
+	}
+	readOnly := volume.Source.GCEPersistentDisk.ReadOnly
+	sizeGB := volume.Source.GCEPersistentDisk.SizeGB
+	// TODO: move these up into the Kubelet.
+	util := &GCEDiskUtil{}
+	mounter := newMounter()
+	return &GCEPersistentDisk{
+		Name:                 volume.Name,
+		PodID:                podID,
+		RootDir:              rootDir,
+		PDName:               PDName,
+		FSType:               FSType,
+		Partition:            partition,
+		ReadOnly:             readOnly,
+		MountOptions:         volume.MountOptions,
+		SELinuxContext:       volume.SELinuxContext,
+		FSGroup:              volume.FSGroup,
+		SkipFSGroupRecursion: volume.Source.GCEPersistentDisk.SkipFSGroupRecursion,
+		DirMode:              os.FileMode(volume.Source.GCEPersistentDisk.DirMode),
+		MountRetries:         defaultMountRetries,
+		MountRetryDelay:      defaultMountRetryDelay,
+		SizeGB:               sizeGB,
+		DiskType:             volume.Source.GCEPersistentDisk.DiskType,
+		SkipDetach:           loadSkipPDDetach(),
+		util:                 util,
+		mounter:              mounter,
+		runner:               &execRunner{},
+		sysfs:                &realSysfs{},
+	}
+}
+
+// Interprets API volume as an ISCSIDisk
+func createISCSIDisk(volume *api.Volume, podID string, rootDir string) *ISCSIDisk {
+	source := volume.Source.ISCSI
+	return &ISCSIDisk{
+		Name:         volume.Name,
+		PodID:        podID,
+		RootDir:      rootDir,
+		Portal:       source.TargetPortal,
+		IQN:          source.IQN,
+		Lun:          strconv.Itoa(source.Lun),
+		FSType:       source.FSType,
+		ReadOnly:     source.ReadOnly,
+		MountOptions: volume.MountOptions,
+		mounter:      newMounter(),
+		runner:       &execRunner{},
+	}
 }
 
 // CreateVolumeBuilder returns a Builder capable of mounting a volume described by an
-// *api.Volume, or an error.
+// *api.Volume, or an error. The Builder comes from the volume plugin registered
+// under the name of the volume's source field, e.g. "emptyDir".
 func CreateVolumeBuilder(volume *api.Volume, podID string, rootDir string) (Builder, error) {
 	source := volume.Source
 	// TODO(jonesdl) We will want to throw an error here when we no longer
@@ -132,15 +886,31 @@ func CreateVolumeBuilder(volume *api.Volume, podID string, rootDir string) (Buil
 	if source == nil {
 		return nil, nil
 	}
-	var vol Builder
-	// TODO(jonesdl) We should probably not check every pointer and directly
-	// resolve these types instead.
-	if source.HostDirectory != nil {
-		vol = createHostDirectory(volume)
-	} else if source.EmptyDirectory != nil {
-		vol = createEmptyDirectory(volume, podID, rootDir)
-	} else {
-		return nil, ErrUnsupportedVolumeType
+	if err := ValidateVolume(volume); err != nil {
+		return nil, err
+	}
+	kind, err := volumeKind(volume)
+	if err != nil {
+		return nil, err
+	}
+	factory, found := GetVolumePlugin(kind)
+	if !found {
+		return nil, fmt.Errorf("%w: no plugin for %q", ErrUnsupportedVolumeType, kind)
+	}
+	vol, err := factory(volume, podID, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if volume.PostMountCommand != nil {
+		if err := checkPostMountCommand(volume.PostMountCommand); err != nil {
+			return nil, err
+		}
+		vol = &postMountBuilder{
+			Builder:  vol,
+			command:  volume.PostMountCommand,
+			sentinel: VolumeHost{RootDir: rootDir}.PostMountSentinel(podID, volume.Name),
+			runner:   &execRunner{},
+		}
 	}
 	return vol, nil
 }
@@ -148,53 +918,206 @@ func CreateVolumeBuilder(volume *api.Volume, podID string, rootDir string) (Buil
 // CreateVolumeCleaner returns a Cleaner capable of tearing down a volume.
 func CreateVolumeCleaner(kind string, name string, podID string, rootDir string) (Cleaner, error) {
 	switch kind {
-	case "empty":
-		return &EmptyDirectory{name, podID, rootDir}, nil
+	case KindHostDirectory:
+		return &HostDirectory{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindEmptyDirectory:
+		return &EmptyDirectory{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindRamDisk:
+		return &RamDisk{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindISCSI:
+		return &ISCSIDisk{
+			Name:    name,
+			PodID:   podID,
+			RootDir: rootDir,
+			mounter: newMounter(),
+			runner:  &execRunner{},
+		}, nil
+	case KindAWSElasticBlockStore:
+		return &AWSElasticBlockStore{
+			Name:    name,
+			PodID:   podID,
+			RootDir: rootDir,
+			util:    &AWSDiskUtil{},
+			mounter: newMounter(),
+			runner:  &execRunner{},
+		}, nil
+	case KindRBD:
+		return &RBDImage{
+			Name:    name,
+			PodID:   podID,
+			RootDir: rootDir,
+			mounter: newMounter(),
+			runner:  &execRunner{},
+		}, nil
+	case KindSecret:
+		return &Secret{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindGlusterfs:
+		return &Glusterfs{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindCephFS:
+		return &CephFS{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindFlocker:
+		return &Flocker{Name: name, PodID: podID, RootDir: rootDir, mounter: newMounter()}, nil
+	case KindAzureDisk:
+		return &AzureDisk{
+			Name:    name,
+			PodID:   podID,
+			RootDir: rootDir,
+			util:    &AzureDiskUtil{},
+			mounter: newMounter(),
+			runner:  &execRunner{},
+		}, nil
+	case KindGCEPersistentDisk:
+		return &GCEPersistentDisk{
+			Name:       name,
+			PodID:      podID,
+			RootDir:    rootDir,
+			SkipDetach: loadSkipPDDetach(),
+			util:       &GCEDiskUtil{},
+			mounter:    newMounter(),
+			runner:     &execRunner{},
+		}, nil
 	default:
-		return nil, ErrUnsupportedVolumeType
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedVolumeType, kind)
+	}
+}
+
+// ScanError reports the parts of the volume directory tree that
+// GetCurrentVolumes could not read or interpret.
+type ScanError struct {
+	Errors []error
+}
+
+func (e *ScanError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
 	}
+	return fmt.Sprintf("%d error(s) scanning volumes: %s", len(e.Errors), strings.Join(msgs, "; "))
 }
 
+// deletingSuffix marks a volume directory that TearDown has renamed for removal.
+const deletingSuffix = ".deleting~"
+
+// CurrentVolume is a volume found on disk by GetCurrentVolumes.
+type CurrentVolume struct {
+	PodID string
+	// Kind is the volume kind directory, e.g. "empty" or "gce-pd".
+	Kind    string
+	Name    string
+	Cleaner Cleaner
+}
+
+// Identifier returns the volume's key in the format (POD_ID)/(VOLUME_NAME).
+func (v *CurrentVolume) Identifier() string {
+	return path.Join(v.PodID, v.Name)
+}
+
+// scanWorkers bounds how many pods' volume directories GetCurrentVolumes
+// reads at once.
+const scanWorkers = 8
+
 // Examines directory structure to determine volumes that are presently
-// active and mounted. Returns a map of Cleaner types.
-func GetCurrentVolumes(rootDirectory string) map[string]Cleaner {
-	currentVolumes := make(map[string]Cleaner)
-	mountPath := rootDirectory
-	podIDDirs, err := ioutil.ReadDir(mountPath)
-	if err != nil {
-		glog.Errorf("Could not read directory: %s, (%s)", mountPath, err)
-	}
-	// Volume information is extracted from the directory structure:
-	// (ROOT_DIR)/(POD_ID)/volumes/(VOLUME_KIND)/(VOLUME_NAME)
-	for _, podIDDir := range podIDDirs {
-		if !podIDDir.IsDir() {
+// active and mounted. Problems with parts of the tree don't stop the scan;
+// the volumes found are returned along with a *ScanError describing the rest.
+// Directories left behind by an interrupted TearDown are skipped. Pods are
+// scanned in parallel, but volumes are returned in directory order.
+func GetCurrentVolumes(rootDirectory string) ([]CurrentVolume, error) {
+	var currentVolumes []CurrentVolume
+	var errs []error
+	host := VolumeHost{RootDir: rootDirectory}
+	podIDDirs, err := ioutil.ReadDir(rootDirectory)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not read directory %s: %v", rootDirectory, err))
+	}
+	// Each pod's results go in its own slot, so workers don't share them and
+	// the order doesn't depend on which finishes first.
+	podVolumes := make([][]CurrentVolume, len(podIDDirs))
+	podErrs := make([][]error, len(podIDDirs))
+	indexes := make(chan int)
+	workers := scanWorkers
+	if len(podIDDirs) < workers {
+		workers = len(podIDDirs)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				podVolumes[i], podErrs[i] = scanPodVolumes(host, podIDDirs[i].Name())
+			}
+		}()
+	}
+	for i, podIDDir := range podIDDirs {
+		if podIDDir.IsDir() {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	for i := range podIDDirs {
+		currentVolumes = append(currentVolumes, podVolumes[i]...)
+		errs = append(errs, podErrs[i]...)
+	}
+	if len(errs) > 0 {
+		return currentVolumes, &ScanError{Errors: errs}
+	}
+	return currentVolumes, nil
+}
+
+// GetPodVolumes is GetCurrentVolumes for the pod podID alone: only the pod's
+// own directory is read, so reconciling one pod doesn't walk every pod on the
+// host. A pod without volumes has none, and isn't an error. A podID that
+// could name a directory outside the pod's own is rejected.
+func GetPodVolumes(rootDirectory string, podID string) ([]CurrentVolume, error) {
+	if podID == "" || podID == "." || strings.Contains(podID, "..") || strings.ContainsRune(podID, '/') || strings.ContainsRune(podID, filepath.Separator) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPodID, podID)
+	}
+	currentVolumes, errs := scanPodVolumes(VolumeHost{RootDir: rootDirectory}, podID)
+	if len(errs) > 0 {
+		return currentVolumes, &ScanError{Errors: errs}
+	}
+	return currentVolumes, nil
+}
+
+// scanPodVolumes returns the volumes of a pod found in the directory structure
+// laid out by VolumeHost, and the problems finding the rest.
+func scanPodVolumes(host VolumeHost, podID string) ([]CurrentVolume, []error) {
+	var currentVolumes []CurrentVolume
+	var errs []error
+	podIDPath := host.PodVolumesDir(podID)
+	volumeKindDirs, err := ioutil.ReadDir(podIDPath)
+	if os.IsNotExist(err) {
+		// The pod has no volumes.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("could not read directory %s: %v", podIDPath, err)}
+	}
+	for _, volumeKindDir := range volumeKindDirs {
+		if !volumeKindDir.IsDir() {
 			continue
 		}
-		podID := podIDDir.Name()
-		podIDPath := path.Join(mountPath, podID, "volumes")
-		volumeKindDirs, err := ioutil.ReadDir(podIDPath)
+		volumeKind := volumeKindDir.Name()
+		volumeKindPath := host.PodVolumeDir(podID, volumeKind, "")
+		volumeNameDirs, err := ioutil.ReadDir(volumeKindPath)
 		if err != nil {
-			glog.Errorf("Could not read directory: %s, (%s)", podIDPath, err)
+			errs = append(errs, fmt.Errorf("could not read directory %s: %v", volumeKindPath, err))
+			continue
 		}
-		for _, volumeKindDir := range volumeKindDirs {
-			volumeKind := volumeKindDir.Name()
-			volumeKindPath := path.Join(podIDPath, volumeKind)
-			volumeNameDirs, err := ioutil.ReadDir(volumeKindPath)
-			if err != nil {
-				glog.Errorf("Could not read directory: %s, (%s)", volumeKindPath, err)
+		for _, volumeNameDir := range volumeNameDirs {
+			volumeName := volumeNameDir.Name()
+			if !volumeNameDir.IsDir() || strings.Contains(volumeName, deletingSuffix) {
+				continue
 			}
-			for _, volumeNameDir := range volumeNameDirs {
-				volumeName := volumeNameDir.Name()
-				identifier := path.Join(podID, volumeName)
-				// TODO(thockin) This should instead return a reference to an extant volume object
-				cleaner, err := CreateVolumeCleaner(volumeKind, volumeName, podID, rootDirectory)
-				if err != nil {
-					glog.Errorf("Could not create volume cleaner: %s, (%s)", volumeNameDirs, err)
-					continue
-				}
-				currentVolumes[identifier] = cleaner
+			// TODO(thockin) This should instead return a reference to an extant volume object
+			cleaner, err := CreateVolumeCleaner(volumeKind, volumeName, podID, host.RootDir)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not create cleaner for volume %s of kind %s: %v", path.Join(podID, volumeName), volumeKind, err))
+				continue
 			}
+			currentVolumes = append(currentVolumes, CurrentVolume{PodID: podID, Kind: volumeKind, Name: volumeName, Cleaner: cleaner})
 		}
 	}
-	return currentVolumes
+	return currentVolumes, errs
 }
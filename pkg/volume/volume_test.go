@@ -17,12 +17,21 @@ limitations under the License.
 package volume
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	gce_cloud "github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider/gce"
 )
 
 func TestCreateVolumeBuilders(t *testing.T) {
@@ -41,7 +50,7 @@ func TestCreateVolumeBuilders(t *testing.T) {
 			api.Volume{
 				Name: "host-dir",
 				Source: &api.VolumeSource{
-					HostDirectory: &api.HostDirectory{"/dir/path"},
+					HostDirectory: &api.HostDirectory{Path: "/dir/path"},
 				},
 			},
 			"/dir/path",
@@ -98,7 +107,7 @@ func TestCreateVolumeBuilders(t *testing.T) {
 		}
 		vc, err := CreateVolumeCleaner(tt.kind, tt.volume.Name, tt.podID, tempDir)
 		if tt.kind == "" {
-			if err != ErrUnsupportedVolumeType {
+			if !errors.Is(err, ErrUnsupportedVolumeType) {
 				t.Errorf("Unexpected error: %v", err)
 			}
 			continue
@@ -113,6 +122,16 @@ func TestCreateVolumeBuilders(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeCleanerUnsupported(t *testing.T) {
+	_, err := CreateVolumeCleaner("tape", "backup", "my-id", "/tmp")
+	if !errors.Is(err, ErrUnsupportedVolumeType) {
+		t.Errorf("Expected ErrUnsupportedVolumeType, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), `"tape"`) {
+		t.Errorf("Expected the error to name the volume type, got %v", err)
+	}
+}
+
 func TestGetActiveVolumes(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "CreateVolumes")
 	if err != nil {
@@ -127,17 +146,1029 @@ func TestGetActiveVolumes(t *testing.T) {
 	}{
 		{"fakeName", "fakeID", "empty", "fakeID/fakeName"},
 		{"fakeName2", "fakeID2", "empty", "fakeID2/fakeName2"},
+		{"fakeName3", "fakeID3", "host", "fakeID3/fakeName3"},
 	}
-	expectedIdentifiers := []string{}
 	for _, test := range getActiveVolumesTests {
 		volumeDir := path.Join(tempDir, test.podID, "volumes", test.kind, test.name)
 		os.MkdirAll(volumeDir, 0750)
-		expectedIdentifiers = append(expectedIdentifiers, test.identifier)
 	}
-	volumeMap := GetCurrentVolumes(tempDir)
-	for _, name := range expectedIdentifiers {
-		if _, ok := volumeMap[name]; !ok {
-			t.Errorf("Expected volume map entry not found: %v", name)
+	volumes, err := GetCurrentVolumes(tempDir)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	found := map[string]CurrentVolume{}
+	for _, vol := range volumes {
+		found[vol.Identifier()] = vol
+	}
+	for _, test := range getActiveVolumesTests {
+		vol, ok := found[test.identifier]
+		if !ok {
+			t.Errorf("Expected volume not found: %v", test.identifier)
+			continue
+		}
+		if vol.PodID != test.podID || vol.Kind != test.kind || vol.Name != test.name {
+			t.Errorf("Expected volume %s of kind %s in pod %s, got %+v", test.name, test.kind, test.podID, vol)
+		}
+	}
+	if vol, ok := found["fakeID3/fakeName3"]; ok {
+		if err := vol.Cleaner.TearDown(); err != nil {
+			t.Errorf("Unexpected error tearing down a host directory: %v", err)
+		}
+	}
+}
+
+func TestGetCurrentVolumesPartialTree(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GetCurrentVolumesPartialTree")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	for _, dir := range []string{
+		"pod-a/volumes/empty/cache",
+		"pod-a/volumes/empty/old.deleting~123",
+		"pod-a/volumes/ramdisk",
+		"pod-b/volumes/tape/backup",
+		"pod-b/volumes/empty/data",
+		"pod-c",
+	} {
+		if err := os.MkdirAll(path.Join(tempDir, dir), 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	volumes, err := GetCurrentVolumes(tempDir)
+	scanErr, ok := err.(*ScanError)
+	if !ok || len(scanErr.Errors) != 1 {
+		t.Errorf("Expected a *ScanError for the unsupported volume kind only, got %v", err)
+	}
+	var identifiers []string
+	for _, vol := range volumes {
+		identifiers = append(identifiers, vol.Identifier())
+	}
+	sort.Strings(identifiers)
+	expected := []string{"pod-a/cache", "pod-b/data"}
+	if !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("Expected volumes %v, got %v", expected, identifiers)
+	}
+}
+
+func TestGetPodVolumes(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GetPodVolumes")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	for _, dir := range []string{
+		"pod-a/volumes/empty/cache",
+		"pod-a/volumes/empty/old.deleting~123",
+		"pod-a/volumes/host/etc",
+		"pod-a/volumes/tape/backup",
+		"pod-b/volumes/empty/data",
+		"pod-c",
+	} {
+		if err := os.MkdirAll(path.Join(tempDir, dir), 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	volumes, err := GetPodVolumes(tempDir, "pod-a")
+	scanErr, ok := err.(*ScanError)
+	if !ok || len(scanErr.Errors) != 1 {
+		t.Errorf("Expected a *ScanError for the unsupported volume kind only, got %v", err)
+	}
+	var identifiers []string
+	for _, vol := range volumes {
+		if vol.Cleaner == nil {
+			t.Errorf("Expected a cleaner for %s", vol.Identifier())
+		}
+		identifiers = append(identifiers, vol.Identifier())
+	}
+	if expected := []string{"pod-a/cache", "pod-a/etc"}; !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("Expected volumes %v, got %v", expected, identifiers)
+	}
+	for _, podID := range []string{"pod-c", "missing"} {
+		volumes, err := GetPodVolumes(tempDir, podID)
+		if err != nil || len(volumes) != 0 {
+			t.Errorf("%s: expected no volumes, got %v (%v)", podID, volumes, err)
+		}
+	}
+	for _, podID := range []string{"", ".", "..", "../pod-a", "pod-a/volumes/..", "/pod-a"} {
+		volumes, err := GetPodVolumes(path.Join(tempDir, "pod-b"), podID)
+		if !errors.Is(err, ErrInvalidPodID) || len(volumes) != 0 {
+			t.Errorf("%q: expected ErrInvalidPodID, got %v (%v)", podID, volumes, err)
+		}
+	}
+}
+
+func TestGetCurrentVolumesOrder(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GetCurrentVolumesOrder")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	// More pods than workers, so some workers scan several.
+	var expected []string
+	for i := 0; i < 3*scanWorkers; i++ {
+		podID := fmt.Sprintf("pod-%02d", i)
+		for _, name := range []string{"cache", "data"} {
+			if err := os.MkdirAll(path.Join(tempDir, podID, "volumes/empty", name), 0750); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected = append(expected, path.Join(podID, name))
+		}
+	}
+	volumes, err := GetCurrentVolumes(tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var identifiers []string
+	for _, vol := range volumes {
+		identifiers = append(identifiers, vol.Identifier())
+	}
+	if !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("Expected volumes %v, got %v", expected, identifiers)
+	}
+}
+
+func TestEmptyDirectoryMedium(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "EmptyDirectoryMedium")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &FakeMounter{}
+	emptyDir := &EmptyDirectory{Name: "cache", PodID: "my-id", RootDir: tempDir, Medium: api.StorageTypeMemory, mounter: mounter}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "tmpfs:" + emptyDir.GetPath()
+	if len(mounter.Mounts) != 1 || mounter.Mounts[0] != expected {
+		t.Errorf("Expected mounts %v, got %v", []string{expected}, mounter.Mounts)
+	}
+
+	emptyDir = &EmptyDirectory{Name: "tape", PodID: "my-id", RootDir: tempDir, Medium: "Tape", mounter: mounter}
+	if err := emptyDir.SetUp(); err == nil {
+		t.Errorf("Expected error for unknown medium")
+	}
+	if _, err := os.Stat(emptyDir.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("SetUp() with unknown medium created %v", emptyDir.GetPath())
+	}
+}
+
+func TestEmptyDirectorySizeLimit(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "EmptyDirectorySizeLimit")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &FakeMounter{}
+	emptyDir := &EmptyDirectory{Name: "cache", PodID: "my-id", RootDir: tempDir, Medium: api.StorageTypeMemory, SizeLimit: 1024, mounter: mounter}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mounter.MountData) != 1 || mounter.MountData[0] != "size=1024" {
+		t.Errorf("Expected tmpfs size option, got %v", mounter.MountData)
+	}
+
+	emptyDir = &EmptyDirectory{Name: "disk", PodID: "my-id", RootDir: tempDir, SizeLimit: 1024, mounter: mounter}
+	if err := emptyDir.SetUp(); err == nil {
+		t.Errorf("Expected error for a size limit on the default medium")
+	}
+
+	emptyDir = &EmptyDirectory{Name: "options", PodID: "my-id", RootDir: tempDir, MountOptions: []string{"mode=0700"}, mounter: mounter}
+	if err := emptyDir.SetUp(); err == nil {
+		t.Errorf("Expected error for mount options on the default medium")
+	}
+	emptyDir.Medium = api.StorageTypeMemory
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last := mounter.MountData[len(mounter.MountData)-1]; last != "mode=0700" {
+		t.Errorf("Expected tmpfs mount options, got %q", last)
+	}
+}
+
+func TestEmptyDirectoryDirMode(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "EmptyDirectoryDirMode")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		mode     os.FileMode
+		expected os.FileMode
+	}{
+		{0, 0750},
+		{0755, 0755},
+		{0700, 0700},
+	}
+	for _, test := range tests {
+		emptyDir := &EmptyDirectory{Name: fmt.Sprintf("mode-%o", test.mode), PodID: "my-id", RootDir: tempDir, DirMode: test.mode}
+		if err := emptyDir.SetUp(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := os.Stat(emptyDir.GetPath())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.Mode().Perm() != test.expected {
+			t.Errorf("Expected mode %o, got %o", test.expected, info.Mode().Perm())
+		}
+	}
+
+	mounter := &FakeMounter{}
+	emptyDir := &EmptyDirectory{Name: "cache", PodID: "my-id", RootDir: tempDir, Medium: api.StorageTypeMemory, DirMode: 0755, mounter: mounter}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mounter.MountData) != 1 || mounter.MountData[0] != "mode=755" {
+		t.Errorf("Expected tmpfs mode option, got %v", mounter.MountData)
+	}
+}
+
+func TestEmptyDirectorySELinuxContext(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "EmptyDirectorySELinuxContext")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	context := "system_u:object_r:svirt_sandbox_file_t:s0:c1,c2"
+	runner := &fakeRunner{}
+	emptyDir := &EmptyDirectory{Name: "disk", PodID: "my-id", RootDir: tempDir, SELinuxContext: context, runner: runner}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"chcon " + context + " " + emptyDir.GetPath()}
+	if !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, runner.commands)
+	}
+
+	mounter := &FakeMounter{}
+	emptyDir = &EmptyDirectory{Name: "cache", PodID: "my-id", RootDir: tempDir, Medium: api.StorageTypeMemory, SizeLimit: 1024, SELinuxContext: context, mounter: mounter}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := `size=1024,context="` + context + `"`; len(mounter.MountData) != 1 || mounter.MountData[0] != expected {
+		t.Errorf("Expected tmpfs data %q, got %v", expected, mounter.MountData)
+	}
+}
+
+func TestEmptyDirectoryFSGroup(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "EmptyDirectoryFSGroup")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	gid := int64(os.Getgid())
+	emptyDir := &EmptyDirectory{Name: "shared", PodID: "my-id", RootDir: tempDir, FSGroup: &gid}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectMode(t, emptyDir.GetPath(), 0770|os.ModeDir|os.ModeSetgid)
+}
+
+func TestRamDisk(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "RamDisk")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mounter := &FakeMounter{}
+	ramDisk := &RamDisk{Name: "scratch", PodID: "my-id", RootDir: tempDir, SizeBytes: 1 << 20, mounter: mounter}
+	if err := ramDisk.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "tmpfs:" + ramDisk.GetPath()
+	if len(mounter.Mounts) != 1 || mounter.Mounts[0] != expected {
+		t.Errorf("Expected mounts %v, got %v", []string{expected}, mounter.Mounts)
+	}
+	if len(mounter.MountData) != 1 || mounter.MountData[0] != "size=1048576" {
+		t.Errorf("Expected tmpfs size option, got %v", mounter.MountData)
+	}
+	if err := ramDisk.TearDown(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(ramDisk.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("TearDown() did not remove %v", ramDisk.GetPath())
+	}
+
+	ramDisk = &RamDisk{Name: "unsized", PodID: "my-id", RootDir: tempDir, mounter: mounter}
+	if err := ramDisk.SetUp(); err == nil {
+		t.Errorf("Expected error for a ramdisk without a size")
+	}
+	if _, err := os.Stat(ramDisk.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("SetUp() without a size created %v", ramDisk.GetPath())
+	}
+}
+
+func TestHostDirectoryReadOnly(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "HostDirectoryReadOnly")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	expectedPath := path.Join(tempDir, "my-id/volumes/host/etc")
+	hostMountTable := mountTable
+	defer func() { mountTable = hostMountTable }()
+	mountTable = func() ([]mountEntry, error) {
+		return []mountEntry{{MountPoint: expectedPath, Options: []string{"ro"}}}, nil
+	}
+	mounter := &FakeMounter{}
+	hostDir := &HostDirectory{Path: "/etc", ReadOnly: true, Name: "etc", PodID: "my-id", RootDir: tempDir, mounter: mounter}
+	if hostDir.GetPath() != expectedPath {
+		t.Errorf("Expected path %s, got %s", expectedPath, hostDir.GetPath())
+	}
+	if err := hostDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A bind mount, then its read-only remount.
+	if expected := []string{":" + expectedPath, ":" + expectedPath}; !reflect.DeepEqual(mounter.Mounts, expected) {
+		t.Errorf("Expected mounts %v, got %v", expected, mounter.Mounts)
+	}
+	// The cleaner uses the real mounter, which must not see the fake mount.
+	mountTable = hostMountTable
+	cleaner, err := CreateVolumeCleaner("host", "etc", "my-id", tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cleaner.TearDown(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(expectedPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the bind mount path to be removed, got %v", err)
+	}
+
+	writable := &HostDirectory{Path: "/data", mounter: mounter}
+	if err := writable.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if writable.GetPath() != "/data" || len(mounter.Mounts) != 2 {
+		t.Errorf("Expected a read/write host directory to be exposed directly")
+	}
+
+	// A remount that silently stays writable must not be left behind.
+	mountTable = func() ([]mountEntry, error) {
+		return []mountEntry{{MountPoint: expectedPath, Options: []string{"rw"}}}, nil
+	}
+	mounter = &FakeMounter{}
+	hostDir = &HostDirectory{Path: "/etc", ReadOnly: true, Name: "etc", PodID: "my-id", RootDir: tempDir, mounter: mounter}
+	if err := hostDir.SetUp(); err == nil {
+		t.Errorf("Expected an error for a writable remount")
+	}
+	if expected := []string{expectedPath}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+		t.Errorf("Expected unmounts %v, got %v", expected, mounter.Unmounts)
+	}
+}
+
+func TestHostDirectoryAllowedPaths(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "HostDirectoryAllowedPaths")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	allowed := path.Join(tempDir, "data")
+	for _, dir := range []string{path.Join(allowed, "logs"), path.Join(tempDir, "secret"), path.Join(tempDir, "data-other")} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := os.Symlink(path.Join(tempDir, "secret"), path.Join(allowed, "escape")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.Symlink(path.Join(allowed, "logs"), path.Join(allowed, "current")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer SetAllowedHostPaths(nil)
+	SetAllowedHostPaths([]string{allowed + "/"})
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{allowed, true},
+		{path.Join(allowed, "logs"), true},
+		{path.Join(allowed, "current"), true},
+		{path.Join(allowed, "logs/../../secret"), false},
+		{path.Join(allowed, "escape"), false},
+		{path.Join(tempDir, "data-other"), false},
+		{path.Join(tempDir, "secret"), false},
+	}
+	for _, test := range tests {
+		volume := &api.Volume{Name: "host", Source: &api.VolumeSource{HostDirectory: &api.HostDirectory{Path: test.path}}}
+		builder, err := CreateVolumeBuilder(volume, "my-id", tempDir)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.path, err)
+		}
+		err = builder.SetUp()
+		if test.allowed && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.path, err)
+		}
+		// The path checked, not the one asked for, is what gets exposed.
+		if resolved, _ := filepath.EvalSymlinks(test.path); test.allowed && builder.GetPath() != resolved {
+			t.Errorf("%s: expected path %s, got %s", test.path, resolved, builder.GetPath())
+		}
+		if !test.allowed && !errors.Is(err, ErrHostPathNotAllowed) {
+			t.Errorf("%s: expected ErrHostPathNotAllowed, got %v", test.path, err)
+		}
+	}
+}
+
+func TestSettingsConcurrentUse(t *testing.T) {
+	defer SetAllowedHostPaths(nil)
+	defer SetSkipPDDetach(false)
+	volume := &api.Volume{Name: "host", Source: &api.VolumeSource{HostDirectory: &api.HostDirectory{Path: "/data"}}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetAllowedHostPaths([]string{fmt.Sprintf("/data-%d", i)})
+				SetSkipPDDetach(j%2 == 0)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := CreateVolumeBuilder(volume, "my-id", "/var/lib/kubelet"); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if _, err := CreateVolumeCleaner(KindGCEPersistentDisk, "vol", "my-id", "/var/lib/kubelet"); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestVolumeMetrics(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "VolumeMetrics")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	emptyDir := &EmptyDirectory{Name: "cache", PodID: "my-id", RootDir: tempDir, mounter: &FakeMounter{}}
+	if err := emptyDir.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	volumes := []Builder{
+		&HostDirectory{Path: tempDir},
+		emptyDir,
+	}
+	for _, vol := range volumes {
+		provider, ok := vol.(MetricsProvider)
+		if !ok {
+			t.Fatalf("Expected %T to report metrics", vol)
+		}
+		used, capacity, err := provider.Metrics()
+		if err != nil {
+			t.Fatalf("%T: unexpected error: %v", vol, err)
+		}
+		if capacity <= 0 || used < 0 || used > capacity {
+			t.Errorf("%T: implausible usage %d of %d bytes", vol, used, capacity)
+		}
+	}
+	missing := &GCEPersistentDisk{Name: "missing", PodID: "my-id", RootDir: tempDir}
+	if _, _, err := missing.Metrics(); err == nil {
+		t.Errorf("Expected an error for a volume that isn't set up")
+	}
+}
+
+func TestWaitForPartition(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		gcePartitionWaitTimeout, gceDeviceWaitInterval = timeout, interval
+	}(gcePartitionWaitTimeout, gceDeviceWaitInterval)
+	gcePartitionWaitTimeout = 5 * time.Millisecond
+	gceDeviceWaitInterval = time.Millisecond
+
+	tempDir, err := ioutil.TempDir("", "WaitForPartition")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	diskPath := path.Join(tempDir, "google-my-pd")
+	partitionPath := diskPath + "-part1"
+	for _, file := range []string{diskPath, partitionPath} {
+		if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := waitForPartition(diskPath, diskPath); err != nil {
+		t.Errorf("Unexpected error for the whole disk: %v", err)
+	}
+	if err := waitForPartition(diskPath, partitionPath); err != nil {
+		t.Errorf("Unexpected error for an existing partition: %v", err)
+	}
+	err = waitForPartition(diskPath, diskPath+"-part7")
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Expected a missing partition error, got %v", err)
+	}
+}
+
+func TestGCEPersistentDiskDefaultFSType(t *testing.T) {
+	for fstype, expected := range map[string]string{"": "ext4", "xfs": "xfs"} {
+		volume := &api.Volume{
+			Name:   "data",
+			Source: &api.VolumeSource{GCEPersistentDisk: &api.GCEPersistentDisk{PDName: "my-pd", FSType: fstype}},
+		}
+		if PD := createGCEPersistentDisk(volume, "my-id", "/tmp"); PD.FSType != expected {
+			t.Errorf("Expected filesystem type %q for %q, got %q", expected, fstype, PD.FSType)
+		}
+	}
+}
+
+func TestRamDiskRequiredCapacity(t *testing.T) {
+	volume := &api.Volume{
+		Name:   "scratch",
+		Source: &api.VolumeSource{RamDisk: &api.RamDisk{SizeBytes: 64 << 20}},
+	}
+	builder, err := CreateVolumeBuilder(volume, "my-id", "/tmp")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	consumer, ok := builder.(CapacityConsumer)
+	if !ok {
+		t.Fatalf("Expected %T to report its required capacity", builder)
+	}
+	if resource, size := consumer.RequiredCapacity(); resource != ResourceMemory || size != 64<<20 {
+		t.Errorf("Expected %d bytes of %s, got %d bytes of %s", 64<<20, ResourceMemory, size, resource)
+	}
+	if _, ok := interface{}(&EmptyDirectory{}).(CapacityConsumer); ok {
+		t.Errorf("Expected disk-backed volumes not to report a required capacity")
+	}
+}
+
+func TestGCEPersistentDiskProvisioning(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskProvisioning")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		name      string
+		sizeGB    int64
+		createErr error
+		calls     []string
+		wantErr   bool
+	}{
+		{name: "existing", calls: []string{"attach", "mount"}},
+		{name: "created", sizeGB: 10, calls: []string{"create", "attach", "mount"}},
+		{name: "raced", sizeGB: 10, createErr: gce_cloud.ErrDiskAlreadyExists, calls: []string{"create", "attach", "mount"}},
+		{name: "failed", sizeGB: 10, createErr: errors.New("quota exceeded"), calls: []string{"create"}, wantErr: true},
+	}
+	for _, test := range tests {
+		util := &FakeGCEPersistentDiskUtil{CreateErr: test.createErr}
+		PD := &GCEPersistentDisk{
+			Name:    test.name,
+			PodID:   "my-id",
+			RootDir: tempDir,
+			PDName:  "my-pd",
+			SizeGB:  test.sizeGB,
+			util:    util,
+			mounter: &FakeMounter{},
+		}
+		err := PD.SetUp()
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(util.Calls, test.calls) {
+			t.Errorf("%s: expected calls %v, got %v", test.name, test.calls, util.Calls)
+		}
+	}
+}
+
+func TestGCEPersistentDiskMountRetries(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskMountRetries")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	deviceErr := errors.New("Could not attach disk: Timeout after 10s")
+	tests := []struct {
+		name      string
+		mountErrs []error
+		calls     []string
+		wantErr   bool
+	}{
+		{name: "transient", mountErrs: []error{deviceErr}, calls: []string{"attach", "mount", "mount"}},
+		{name: "persistent", mountErrs: []error{deviceErr, deviceErr, deviceErr}, calls: []string{"attach", "mount", "mount", "mount"}, wantErr: true},
+	}
+	for _, test := range tests {
+		util := &FakeGCEPersistentDiskUtil{MountErrs: test.mountErrs}
+		mounter := &FakeMounter{}
+		PD := &GCEPersistentDisk{
+			Name:            test.name,
+			PodID:           "my-id",
+			RootDir:         tempDir,
+			PDName:          "my-pd",
+			MountRetries:    2,
+			MountRetryDelay: time.Millisecond,
+			util:            util,
+			mounter:         mounter,
+		}
+		err := PD.SetUp()
+		if test.wantErr != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.wantErr, err)
+		}
+		if test.wantErr && len(mounter.Mounts) != 0 {
+			t.Errorf("%s: expected no bind mount, got %v", test.name, mounter.Mounts)
+		}
+		if !reflect.DeepEqual(util.Calls, test.calls) {
+			t.Errorf("%s: expected calls %v, got %v", test.name, test.calls, util.Calls)
+		}
+	}
+}
+
+func TestGCEPersistentDiskSetUpTearDown(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskSetUpTearDown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tests := []struct {
+		name string
+		// refs counts the pod's bind mount and the global mount, plus any
+		// other pods' bind mounts of the disk.
+		refs  int
+		calls []string
+	}{
+		{name: "last", refs: 2, calls: []string{"attach", "mount", "detach"}},
+		{name: "shared", refs: 3, calls: []string{"attach", "mount"}},
+	}
+	for _, test := range tests {
+		util := &FakeGCEPersistentDiskUtil{}
+		mounter := &FakeMounter{}
+		PD := &GCEPersistentDisk{
+			Name:    test.name,
+			PodID:   "my-id",
+			RootDir: tempDir,
+			PDName:  "my-pd",
+			util:    util,
+			mounter: mounter,
+		}
+		if err := PD.SetUp(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		// A bind mount, then its remount with the volume's options.
+		if expected := []string{":" + PD.GetPath(), ":" + PD.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+			t.Errorf("%s: expected mounts %v, got %v", test.name, expected, mounter.Mounts)
+		}
+		mounter.Device, mounter.Refs = "/dev/sdb", test.refs
+		if err := PD.TearDown(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if expected := []string{PD.GetPath()}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+			t.Errorf("%s: expected unmounts %v, got %v", test.name, expected, mounter.Unmounts)
+		}
+		if _, err := os.Stat(PD.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the volume path to be removed, got %v", test.name, err)
+		}
+		if !reflect.DeepEqual(util.Calls, test.calls) {
+			t.Errorf("%s: expected calls %v, got %v", test.name, test.calls, util.Calls)
+		}
+		if len(util.DetachedDevices) > 0 && util.DetachedDevices[0] != "/dev/sdb" {
+			t.Errorf("%s: expected /dev/sdb to be detached, got %v", test.name, util.DetachedDevices)
+		}
+	}
+}
+
+func TestGCEPersistentDiskSetUpAlreadyMounted(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskSetUpAlreadyMounted")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	util := &FakeGCEPersistentDiskUtil{}
+	// Another pod's volume still holds the disk after a kubelet restart.
+	mounter := &FakeMounter{Device: "/dev/sdb", Refs: 2}
+	PD := &GCEPersistentDisk{Name: "vol", PodID: "my-id", RootDir: tempDir, PDName: "my-pd", util: util, mounter: mounter}
+	if err := PD.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"mount"}; !reflect.DeepEqual(util.Calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, util.Calls)
+	}
+
+	mounter.RefErr = errors.New("no /proc/mounts")
+	PD.PodID = "other-id"
+	if err := PD.SetUp(); err == nil {
+		t.Errorf("Expected an error when the mounts can't be read")
+	}
+}
+
+func TestGCEPersistentDiskReadOnlyGlobalMount(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskReadOnlyGlobalMount")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	globalPDPath := makeGlobalPDName(tempDir, "my-pd", "")
+	for option, expectedFlags := range map[string]uintptr{"ro": MOUNT_MS_RDONLY, "rw": 0} {
+		mounter := &FakeMounter{}
+		PD := &GCEPersistentDisk{Name: "data", PodID: "my-id", RootDir: tempDir, PDName: "my-pd", util: &FakeGCEPersistentDiskUtil{}, mounter: mounter}
+		mountTable = func() ([]mountEntry, error) {
+			return []mountEntry{
+				{MountPoint: globalPDPath, Options: []string{option}},
+				{MountPoint: PD.GetPath(), Options: []string{option}},
+			}, nil
+		}
+		if err := PD.SetUp(); err != nil {
+			t.Errorf("%s: unexpected error: %v", option, err)
+		}
+		// A read-only global mount makes the bind mount read-only when it is remounted.
+		if expected := []uintptr{MOUNT_MS_BIND, MOUNT_MS_BIND | MOUNT_MS_REMOUNT | expectedFlags}; !reflect.DeepEqual(mounter.MountFlags, expected) {
+			t.Errorf("%s: expected mount flags %v, got %v", option, expected, mounter.MountFlags)
+		}
+		os.RemoveAll(PD.GetPath())
+	}
+}
+
+func TestGCEPersistentDiskDirMode(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskDirMode")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	volumePath := path.Join(tempDir, "my-id/volumes/gce-pd/vol")
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	mountTable = func() ([]mountEntry, error) {
+		return []mountEntry{{MountPoint: volumePath, Options: []string{"ro"}}}, nil
+	}
+	// The fake mounter mounts nothing, so the volume path stands in for the
+	// root of the disk.
+	tests := []struct {
+		readOnly bool
+		expected os.FileMode
+	}{
+		{false, 0755},
+		{true, defaultDirMode},
+	}
+	for _, test := range tests {
+		PD := &GCEPersistentDisk{Name: "vol", PodID: "my-id", RootDir: tempDir, PDName: "my-pd", ReadOnly: test.readOnly, DirMode: 0755, util: &FakeGCEPersistentDiskUtil{}, mounter: &FakeMounter{}}
+		if err := PD.SetUp(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := os.Stat(PD.GetPath())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.Mode().Perm() != test.expected {
+			t.Errorf("read-only %t: expected mode %o, got %o", test.readOnly, test.expected, info.Mode().Perm())
+		}
+		os.RemoveAll(PD.GetPath())
+	}
+}
+
+func TestGCEPersistentDiskTearDownIdempotent(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskTearDownIdempotent")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	util := &FakeGCEPersistentDiskUtil{}
+	mounter := &FakeMounter{}
+	PD := &GCEPersistentDisk{Name: "vol", PodID: "my-id", RootDir: tempDir, PDName: "my-pd", util: util, mounter: mounter}
+
+	// Never set up.
+	if err := PD.TearDown(); err != nil {
+		t.Errorf("Unexpected error tearing down a missing volume: %v", err)
+	}
+
+	// Unmounted by an earlier TearDown that failed before removing the path.
+	if err := os.MkdirAll(PD.GetPath(), 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter.RefErr = fmt.Errorf("%s is %w", PD.GetPath(), errNotMountPoint)
+	if err := PD.TearDown(); err != nil {
+		t.Errorf("Unexpected error tearing down an unmounted volume: %v", err)
+	}
+	if _, err := os.Stat(PD.GetPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the volume path to be removed, got %v", err)
+	}
+
+	// Torn down twice.
+	mounter.RefErr = nil
+	if err := PD.SetUp(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter.Device, mounter.Refs = "/dev/sdb", 2
+	for i := 0; i < 2; i++ {
+		if err := PD.TearDown(); err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		}
+	}
+	if len(mounter.Unmounts) != 1 {
+		t.Errorf("Expected a single unmount, got %v", mounter.Unmounts)
+	}
+	if expected := []string{"attach", "mount", "detach"}; !reflect.DeepEqual(util.Calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, util.Calls)
+	}
+}
+
+func TestGCEPersistentDiskReadOnly(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskReadOnly")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	for _, option := range []string{"ro", "rw"} {
+		mounter := &FakeMounter{}
+		PD := &GCEPersistentDisk{Name: "data", PodID: "my-id", RootDir: tempDir, PDName: "my-pd", ReadOnly: true, util: &FakeGCEPersistentDiskUtil{}, mounter: mounter}
+		mountTable = func() ([]mountEntry, error) {
+			return []mountEntry{
+				{MountPoint: PD.GetPath(), Options: []string{"rw"}},
+				{MountPoint: PD.GetPath(), Options: []string{option}},
+			}, nil
+		}
+		err := PD.SetUp()
+		// A bind mount, then its read-only remount.
+		if expected := []string{":" + PD.GetPath(), ":" + PD.GetPath()}; !reflect.DeepEqual(mounter.Mounts, expected) {
+			t.Errorf("%s: expected mounts %v, got %v", option, expected, mounter.Mounts)
+		}
+		if option == "ro" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", option, err)
+			}
+			os.RemoveAll(PD.GetPath())
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error for a writable mount", option)
+		}
+		if expected := []string{PD.GetPath()}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+			t.Errorf("%s: expected unmounts %v, got %v", option, expected, mounter.Unmounts)
+		}
+		if _, err := os.Stat(PD.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the volume path to be removed, got %v", option, err)
+		}
+	}
+}
+
+func TestGCEPersistentDiskSharedTearDown(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskSharedTearDown")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer func(table func() ([]mountEntry, error)) { mountTable = table }(mountTable)
+	mountTable = func() ([]mountEntry, error) {
+		host := VolumeHost{RootDir: tempDir}
+		return []mountEntry{
+			{MountPoint: host.PodVolumeDir("pod-a", KindGCEPersistentDisk, "data"), Options: []string{"ro"}},
+			{MountPoint: host.PodVolumeDir("pod-b", KindGCEPersistentDisk, "data"), Options: []string{"ro"}},
+		}, nil
+	}
+	util := &FakeGCEPersistentDiskUtil{}
+	mounter := &FakeMounter{Device: "/dev/sdb"}
+	var pods []*GCEPersistentDisk
+	for _, podID := range []string{"pod-a", "pod-b"} {
+		PD := &GCEPersistentDisk{Name: "data", PodID: podID, RootDir: tempDir, PDName: "my-pd", ReadOnly: true, util: util, mounter: mounter}
+		if err := PD.SetUp(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", podID, err)
+		}
+		pods = append(pods, PD)
+	}
+	for i, PD := range pods {
+		// The global mount plus the bind mounts not yet torn down.
+		mounter.Refs = 1 + len(pods) - i
+		if err := PD.TearDown(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", PD.PodID, err)
+		}
+		detaches := 0
+		for _, call := range util.Calls {
+			if call == "detach" {
+				detaches++
+			}
+		}
+		last := i == len(pods)-1
+		if last && detaches != 1 {
+			t.Errorf("%s: expected the last teardown to detach, got calls %v", PD.PodID, util.Calls)
+		}
+		if !last && detaches != 0 {
+			t.Errorf("%s: expected no detach while another pod uses the disk, got calls %v", PD.PodID, util.Calls)
+		}
+	}
+}
+
+func TestGCEPersistentDiskSkipDetach(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GCEPersistentDiskSkipDetach")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer SetSkipPDDetach(false)
+	SetSkipPDDetach(true)
+	cleaner, err := CreateVolumeCleaner(KindGCEPersistentDisk, "data", "my-id", tempDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cleaner.(*GCEPersistentDisk).SkipDetach {
+		t.Errorf("Expected cleaners to skip detaching once SetSkipPDDetach(true) is called")
+	}
+
+	mounter := &FakeMounter{}
+	PD := &GCEPersistentDisk{Name: "data", PodID: "my-id", RootDir: tempDir, PDName: "my-pd", SkipDetach: true, mounter: mounter}
+	globalPDPath := makeGlobalPDName(tempDir, "my-pd", "")
+	if err := os.MkdirAll(globalPDPath, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Reaching the cloud provider to detach would fail here.
+	if err := (&GCEDiskUtil{}).DetachDisk(PD, "/dev/disk/by-id/google-my-pd"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{globalPDPath}; !reflect.DeepEqual(mounter.Unmounts, expected) {
+		t.Errorf("Expected the global mount to be unmounted, got unmounts %v", mounter.Unmounts)
+	}
+	if _, err := os.Stat(globalPDPath); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", globalPDPath, err)
+	}
+}
+
+func TestGlobalPDNamePartitions(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "GlobalPDNamePartitions")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	whole := makeGlobalPDName(tempDir, "my-pd", "")
+	first := makeGlobalPDName(tempDir, "my-pd", "1")
+	second := makeGlobalPDName(tempDir, "my-pd", "2")
+	if whole == first || first == second {
+		t.Fatalf("Expected distinct global paths, got %s, %s and %s", whole, first, second)
+	}
+	if name, partition := parseGlobalPDName(tempDir, second); name != "my-pd" || partition != "2" {
+		t.Errorf("Expected my-pd partition 2, got %s partition %q", name, partition)
+	}
+	// A disk named like another's partition has a path of its own.
+	if lookalike := makeGlobalPDName(tempDir, "my-pd-part2", ""); lookalike == second {
+		t.Errorf("Expected disk my-pd-part2 not to share %s", second)
+	} else if name, partition := parseGlobalPDName(tempDir, lookalike); name != "my-pd-part2" || partition != "" {
+		t.Errorf("Expected disk my-pd-part2, got %s partition %q", name, partition)
+	}
+	if name, partition, err := getDiskName("/dev/disk/by-id/google-my-pd-part2"); err != nil || name != "my-pd" || partition != "2" {
+		t.Errorf("Expected my-pd partition 2, got %s partition %q (%v)", name, partition, err)
+	}
+	for _, partition := range []string{"", "2"} {
+		devicePath := gceDevicePath("my-pd", partition)
+		if name, actual, err := getDiskName(devicePath); err != nil || name != "my-pd" || actual != partition {
+			t.Errorf("Expected %s to be my-pd partition %q, got %s partition %q (%v)", devicePath, partition, name, actual, err)
+		}
+	}
+
+	// Only mount points count, not directories left behind.
+	mounter := &FakeMounter{}
+	if err := os.MkdirAll(first, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mounted, err := diskMountedGlobally(mounter, tempDir, "my-pd"); err != nil || mounted {
+		t.Errorf("Expected the disk not to be mounted, got %t (%v)", mounted, err)
+	}
+	if err := os.MkdirAll(second, 0750); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mounter.MountPoints = map[string]bool{second: true}
+	if mounted, err := diskMountedGlobally(mounter, tempDir, "my-pd"); err != nil || !mounted {
+		t.Errorf("Expected a mounted partition to keep the disk in use, got %t (%v)", mounted, err)
+	}
+	if mounted, err := diskMountedGlobally(mounter, tempDir, "other-pd"); err != nil || mounted {
+		t.Errorf("Expected another disk not to be in use, got %t (%v)", mounted, err)
+	}
+}
+
+func TestSetUpRemovesPathOnMountFailure(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "SetUpMountFailure")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	mountErr := errors.New("mount failed")
+	tests := []struct {
+		name    string
+		builder func(m *FakeMounter) Builder
+	}{
+		{"emptyDir", func(m *FakeMounter) Builder {
+			return &EmptyDirectory{Name: "cache", PodID: "my-id", RootDir: tempDir, Medium: api.StorageTypeMemory, mounter: m}
+		}},
+		{"ramDisk", func(m *FakeMounter) Builder {
+			return &RamDisk{Name: "scratch", PodID: "my-id", RootDir: tempDir, SizeBytes: 1 << 20, mounter: m}
+		}},
+		{"flocker", func(m *FakeMounter) Builder {
+			return &Flocker{Name: "data", PodID: "my-id", RootDir: tempDir, DatasetName: "my-dataset", client: fakeFlockerClient{"my-dataset": "/flocker/8c4a7e2b"}, mounter: m}
+		}},
+	}
+	for _, test := range tests {
+		mounter := &FakeMounter{MountErrs: []error{mountErr}}
+		builder := test.builder(mounter)
+		if err := builder.SetUp(); err != mountErr {
+			t.Errorf("%s: expected %v, got %v", test.name, mountErr, err)
+		}
+		if _, err := os.Stat(builder.GetPath()); !os.IsNotExist(err) {
+			t.Errorf("%s: failed SetUp() left %v behind", test.name, builder.GetPath())
 		}
 	}
 }